@@ -1,4 +1,5 @@
 import subprocess
+import copy
 import json
 import sys
 import os
@@ -50,10 +51,10 @@ def get_storage_layout(file_name):
 def is_struct_present(type_id,types):
     type = types[type_id]
     
-    if "members" in type:
+    if type.get("members") is not None:
         return True
     
-    if "base" in type:
+    if type.get("base") is not None:
         return is_struct_present(type["base"],types)
     else:
         return False    
@@ -82,21 +83,28 @@ def is_type_equal(old_type_id,new_type_id,old_types,new_types):
         return False
 
     #if one of the data types has a key named base and the other one does not they are not same
-    if ("base" in old_type and "base" not in new_type) or ("base" not in old_type and "base" in new_type):
+    #(the processed types have a base of None)
+    if (old_type.get("base") is None) != (new_type.get("base") is None):
         return False
     
     #if both have the base key check if the base type is equal
-    if "base" in old_type and "base" in new_type:
+    if old_type.get("base") is not None and new_type.get("base") is not None:
         res = is_type_equal(old_type["base"],new_type["base"],old_types,new_types)
         if res == False:
             return False
     
+    #mappings are equal only if their keys and values are equal
+    if old_type.get("key") != new_type.get("key"):
+        return False
+    if "value" in old_type and is_type_equal(old_type["value"],new_type["value"],old_types,new_types) == False:
+        return False
+
     #if one of the data types has a key named members and the other one does not they are not same
-    if ("members" in old_type and "members" not in new_type) or ("members" not in old_type and "members" in new_type):
+    if (old_type.get("members") is None) != (new_type.get("members") is None):
         return False
 
     #if both have the members key check if the members type is equal
-    if "members" in old_type and "members" in new_type:
+    if old_type.get("members") is not None and new_type.get("members") is not None:
         if len(old_type["members"]) == 0 or len(new_type["members"]) == 0:
             return False
         
@@ -124,6 +132,92 @@ def is_type_equal(old_type_id,new_type_id,old_types,new_types):
 
     return True
 
+#check if a storage object is a storage gap reserved for future variables
+def is_storage_gap(storage_object, types):
+    type = types.get(storage_object["type"])
+    return storage_object["label"].startswith("__gap") and type is not None and type["encoding"] == "inplace" and type.get("base") is not None
+
+#get the first slot after a storage object
+def get_end_slot(storage_object, types):
+    return int(storage_object["slot"]) + (int(types[storage_object["type"]]["numberOfBytes"]) + 31) // 32
+
+#get the name of the contract that declares a storage object without the path of its source
+def get_contract_name(storage_object):
+    return storage_object.get("contract","").split(":")[-1]
+
+#check if the variables of a layout are declared by several contracts of an inheritance chain, namespaced structs are stored at their own roots
+def is_inheritance_chain(storage_layout):
+    return len(set(get_contract_name(storage_object) for storage_object in storage_layout["storage"] if "namespace" not in storage_object)) > 1
+
+#find the contracts of the old contract that are renamed in the new contract, a contract that is missing from the new layout is renamed to the first contract
+#that is missing from the old layout and declares all its variables, so a removed base is not renamed to an added base that only shares some variable names
+def get_renamed_contracts(old_storage, new_storage):
+    old_contracts = {}
+    new_contracts = {}
+    for storage_object in old_storage:
+        old_contracts.setdefault(get_contract_name(storage_object), set()).add(storage_object["label"])
+    for storage_object in new_storage:
+        new_contracts.setdefault(get_contract_name(storage_object), set()).add(storage_object["label"])
+    renamed_contracts = {}
+    for old_contract, old_labels in old_contracts.items():
+        if old_contract in new_contracts:
+            continue
+        for new_contract, new_labels in new_contracts.items():
+            if new_contract not in old_contracts and new_contract not in renamed_contracts.values() and old_labels <= new_labels:
+                renamed_contracts[old_contract] = new_contract
+                break
+    return renamed_contracts
+
+#pair the storage objects of the old and the new contract by their declaring contract and their label first, so the variables of base contracts
+#are found when the inheritance order changes. The remaining storage objects are paired by their label in the order of the layouts, in inheritance chains
+#only if they belong to renamed contracts, so the variables of removed bases are dropped
+def pair_storage_objects(old_storage, new_storage):
+    pairs = {}
+    renamed_contracts = get_renamed_contracts(old_storage, new_storage)
+    #the variables of a single contract may be paired with the variables of any contract, e.g. of another account
+    is_chain = is_inheritance_chain({"storage": old_storage}) and is_inheritance_chain({"storage": new_storage})
+    for index, old_storage_object in enumerate(old_storage):
+        for new_index, new_storage_object in enumerate(new_storage):
+            if new_index not in pairs.values() and old_storage_object["label"] == new_storage_object["label"] and get_contract_name(old_storage_object) == get_contract_name(new_storage_object):
+                pairs[index] = new_index
+                break
+    for index, old_storage_object in enumerate(old_storage):
+        if index in pairs:
+            continue
+        for new_index, new_storage_object in enumerate(new_storage):
+            if new_index not in pairs.values() and old_storage_object["label"] == new_storage_object["label"] and (not is_chain or renamed_contracts.get(get_contract_name(old_storage_object)) == get_contract_name(new_storage_object)):
+                pairs[index] = new_index
+                break
+    return pairs
+
+#record the contracts that declare the variables of inheritance chains
+def set_declaring_contracts(common_object, old_storage_object, new_storage_object, old_json, new_json):
+    if not is_inheritance_chain(old_json) and not is_inheritance_chain(new_json):
+        return
+    common_object["contract"] = get_contract_name(old_storage_object)
+    if get_contract_name(new_storage_object) != common_object["contract"]:
+        common_object["newContract"] = get_contract_name(new_storage_object)
+
+#a gap may shrink by the slots of the variables inserted before it, its contents are not moved
+def get_storage_gap(old_storage_object, new_storage_object, old_json, new_json):
+    old_end = get_end_slot(old_storage_object, old_json["types"])
+    new_end = get_end_slot(new_storage_object, new_json["types"])
+    if new_end > old_end:
+        raise Exception("Storage gap "+old_storage_object["label"]+" overflows by "+str(new_end-old_end)+" slots")
+    gap = {
+        "label":old_storage_object["label"],
+        "type":old_storage_object["type"],
+        "oldSlot":int_to_256bit_hex_string(int(old_storage_object["slot"])),
+        "newSlot":int_to_256bit_hex_string(int(new_storage_object["slot"])),
+        "oldOffset":0,
+        "newOffset":0,
+    }
+    if not is_type_equal(old_storage_object["type"],new_storage_object["type"],old_json["types"],new_json["types"]):
+        gap["newType"] = new_storage_object["type"]
+    gap["gap"] = True
+    set_declaring_contracts(gap, old_storage_object, new_storage_object, old_json, new_json)
+    return gap
+
 def get_objects(old_json, new_json):
     old_storage = old_json["storage"] #storage in the old contract
     new_storage = new_json["storage"] #storage in the new contract
@@ -131,19 +225,37 @@ def get_objects(old_json, new_json):
     new_types = new_json["types"] #data types in the new contract
     
     common_objects = [] #list to hold storage objects both in old and new contract
+    pairs = pair_storage_objects(old_storage, new_storage)
     
-    for old_storage_object in old_storage:
-        for new_storage_object in new_storage:
-            #if the storage objects from the old and the new contract have the same label and their data types are the same then insert into common objects list
-            if old_storage_object["label"] == new_storage_object["label"] and is_type_equal(old_storage_object["type"],new_storage_object["type"],old_types,new_types) == True:
-                    common_objects.append({
-                        "label":old_storage_object["label"],
-                        "type":old_storage_object["type"],
-                        "oldSlot":int_to_256bit_hex_string(int(old_storage_object["slot"])),
-                        "newSlot":int_to_256bit_hex_string(int(new_storage_object["slot"])),
-                        "oldOffset":old_storage_object["offset"],
-                        "newOffset":new_storage_object["offset"],                       
-                    })
+    for index, old_storage_object in enumerate(old_storage):
+        if index not in pairs:
+            continue
+        new_storage_object = new_storage[pairs[index]]
+        if is_storage_gap(old_storage_object, old_types) != is_storage_gap(new_storage_object, new_types):
+            continue
+        if is_storage_gap(old_storage_object, old_types):
+            common_objects.append(get_storage_gap(old_storage_object, new_storage_object, old_json, new_json))
+            continue
+        #if the paired storage objects from the old and the new contract have the same or convertible data types then insert into common objects list
+        is_equal = is_type_equal(old_storage_object["type"],new_storage_object["type"],old_types,new_types)
+        is_conversion = not is_equal and is_value_type_conversion(old_storage_object["type"],new_storage_object["type"],old_types,new_types)
+        is_resize = not is_equal and (is_fixed_array_resize(old_storage_object["type"],new_storage_object["type"],old_types,new_types) or is_array_kind_conversion(old_storage_object["type"],new_storage_object["type"],old_types,new_types))
+        if is_equal == True or is_conversion == True or is_resize == True:
+                if contains_internal_function(old_storage_object["type"],old_types):
+                    raise Exception("Internal function pointers can not be reorganized: "+old_storage_object["label"])
+                common_object = {
+                    "label":old_storage_object["label"],
+                    "type":old_storage_object["type"],
+                    "oldSlot":int_to_256bit_hex_string(int(old_storage_object["slot"])),
+                    "newSlot":int_to_256bit_hex_string(int(new_storage_object["slot"])),
+                    "oldOffset":old_storage_object["offset"],
+                    "newOffset":new_storage_object["offset"],                       
+                }
+                #converted values keep their bytes, the new type is only recorded. Resized arrays need the new length
+                if is_conversion or is_resize:
+                    common_object["newType"] = new_storage_object["type"]
+                set_declaring_contracts(common_object, old_storage_object, new_storage_object, old_json, new_json)
+                common_objects.append(common_object)
     return common_objects
 
 """
@@ -176,6 +288,10 @@ def process_type(old_types, new_types, current_type, inserted_types, data_types)
     old_types[current_type]["type"] = current_type #add a key value pair named type
     old_types[current_type]["oldNumberOfBytes"] = int(old_types[current_type]["numberOfBytes"]) #add key value pair that contains the size of the data type in the old contract
     old_types[current_type]["newNumberOfBytes"] = int(new_types[current_type]["numberOfBytes"]) #add key value pair that contains the size of the data type in the new contract
+    #enum values change if the members of the enum were reordered, inserted or removed
+    enum_mapping = get_enum_mapping(old_types[current_type].pop("enumMembers",[]),new_types[current_type].get("enumMembers",[]))
+    if enum_mapping is not None:
+        old_types[current_type]["enumMapping"] = enum_mapping
 
     inserted_types.append(current_type)
     #if there is a base type process it too
@@ -195,45 +311,428 @@ def process_type(old_types, new_types, current_type, inserted_types, data_types)
         for member_in_new in new_types[current_type]["members"]:
             new_members[member_in_new["label"]] = member_in_new
         
+        common_members = []
         for member in old_types[current_type]["members"]:
-            if member["label"] not in new_members:
-                old_types[current_type]["members"].remove(member)
+            #members whose type changed are handled like a removed and an added member
+            if member["label"] not in new_members or not is_type_equal(member["type"],new_members[member["label"]]["type"],old_types,new_types):
                 continue
+            common_members.append(member)
             member_in_new = new_members[member["label"]]
             member["oldSlot"] = member["slot"]
             member["newSlot"] = member_in_new["slot"]
             member["oldOffset"] = member["offset"]
             member["newOffset"] = member_in_new["offset"]
             process_type(old_types,new_types,member["type"],inserted_types,data_types)
+        old_types[current_type]["members"] = common_members
     else:
         old_types[current_type]["members"] = None
 
+    #if the data type is a mapping then process the key and the value types
+    for field in ("key","value"):
+        if field in old_types[current_type]:
+            process_type(old_types,new_types,old_types[current_type][field],inserted_types,data_types)
+
 
     data_types.append(old_types[current_type])    
 
+#process a data type that is only used by the variables of the new contract
+def process_new_type(new_types, current_type, inserted_types, data_types):
+
+    if current_type in inserted_types:
+        return
+
+    new_type = dict(new_types[current_type])
+    new_type["type"] = current_type
+    new_type["oldNumberOfBytes"] = 0 #the data type does not exist in the old contract
+    new_type["newNumberOfBytes"] = int(new_type["numberOfBytes"])
+
+    inserted_types.append(current_type)
+    if "base" in new_type:
+        process_new_type(new_types,new_type["base"],inserted_types,data_types)
+    else:
+        new_type["base"] = None
+
+    if "members" in new_type:
+        members = []
+        for member_in_new in new_type["members"]:
+            member = dict(member_in_new)
+            member["oldSlot"] = 0
+            member["newSlot"] = member["slot"]
+            member["oldOffset"] = 0
+            member["newOffset"] = member["offset"]
+            members.append(member)
+            process_new_type(new_types,member["type"],inserted_types,data_types)
+        new_type["members"] = members
+    else:
+        new_type["members"] = None
+
+    new_type.pop("enumMembers",None)
+    for field in ("key","value"):
+        if field in new_type:
+            process_new_type(new_types,new_type[field],inserted_types,data_types)
+
+    data_types.append(new_type)
+
+#process a data type that is only used by the variables of the old contract
+def process_old_type(old_types, current_type, inserted_types, data_types):
+
+    if current_type in inserted_types:
+        return
+
+    old_type = dict(old_types[current_type])
+    old_type["type"] = current_type
+    old_type["oldNumberOfBytes"] = int(old_type["numberOfBytes"])
+    old_type["newNumberOfBytes"] = 0 #the data type does not exist in the new contract
+
+    inserted_types.append(current_type)
+    if "base" in old_type:
+        process_old_type(old_types,old_type["base"],inserted_types,data_types)
+    else:
+        old_type["base"] = None
+
+    if "members" in old_type:
+        members = []
+        for member_in_old in old_type["members"]:
+            member = dict(member_in_old)
+            member["oldSlot"] = member["slot"]
+            member["newSlot"] = 0
+            member["oldOffset"] = member["offset"]
+            member["newOffset"] = 0
+            members.append(member)
+            process_old_type(old_types,member["type"],inserted_types,data_types)
+        old_type["members"] = members
+    else:
+        old_type["members"] = None
+
+    old_type.pop("enumMembers",None)
+    for field in ("key","value"):
+        if field in old_type:
+            process_old_type(old_types,old_type[field],inserted_types,data_types)
+
+    data_types.append(old_type)
+
+#process a data type that may be present in only one of the contracts
+def process_any_type(old_types, new_types, current_type, inserted_types, data_types):
+    if current_type in old_types and current_type in new_types:
+        process_type(old_types,new_types,current_type,inserted_types,data_types)
+    elif current_type in new_types:
+        process_new_type(new_types,current_type,inserted_types,data_types)
+    else:
+        process_old_type(old_types,current_type,inserted_types,data_types)
+
 #find the data types of the storage objects that require reorganization
 def get_types(old_types, new_types, common_objects):
     inserted_types = []
     data_types = []
     
     for common_object in common_objects:
+        if "initialValue" in common_object or "transform" in common_object or "expression" in common_object or "newType" in common_object:
+            continue
         current_type = common_object["type"]
         process_type(old_types,new_types,current_type,inserted_types,data_types)
         if old_types.get(current_type,None) is None:
             raise Exception("Type not found....")
-    
+
+    #the transformed and converted variables may use types that are present in only one of the contracts
+    for common_object in common_objects:
+        if "transform" not in common_object and "expression" not in common_object and "newType" not in common_object:
+            continue
+        type_names = [common_object["type"]]
+        #the elements of a resized array keep their old and new sizes
+        if "newType" in common_object and (is_fixed_array_resize(common_object["type"],common_object["newType"],old_types,new_types) or is_array_kind_conversion(common_object["type"],common_object["newType"],old_types,new_types)):
+            type_names = [old_types[common_object["type"]]["base"],common_object["type"]]
+        if "newType" in common_object:
+            type_names.append(common_object["newType"])
+        for transform_input in common_object.get("inputs",[]):
+            type_names.append(transform_input["type"])
+        for type_name in type_names:
+            process_any_type(old_types,new_types,type_name,inserted_types,data_types)
+
+    #the types of the initialized variables are processed last so that types used by both contracts, e.g. by the inputs of transforms and expressions, keep their old size
+    for common_object in common_objects:
+        if "initialValue" in common_object and "transform" not in common_object:
+            process_new_type(new_types,common_object["type"],inserted_types,data_types)
+
     for type in data_types:
-        if type["members"] is not None:
-            for member in type["members"]:
-                member["slot"] = int_to_256bit_hex_string(int(member["slot"]))
-                member["oldSlot"] = int_to_256bit_hex_string(int(member["oldSlot"]))
-                member["newSlot"] = int_to_256bit_hex_string(int(member["newSlot"]))
-                member.pop("astId")
-                member.pop("contract")
-                member.pop("label")
-                member.pop("slot")
+        format_members(type)
     return data_types
 
+#convert the slots of the members of a processed data type into hex strings
+def format_members(type):
+    if type["members"] is not None:
+        for member in type["members"]:
+            member["slot"] = int_to_256bit_hex_string(int(member["slot"]))
+            member["oldSlot"] = int_to_256bit_hex_string(int(member["oldSlot"]))
+            member["newSlot"] = int_to_256bit_hex_string(int(member["newSlot"]))
+            member.pop("astId")
+            member.pop("contract")
+            member.pop("slot")
+
+#check if a member of a struct in the old contract is also present in the new contract with the same type
+def is_common_member(member, members, old_types, new_types):
+    for other in members:
+        if other["label"] == member["label"] and is_type_equal(member["type"],other["type"],old_types,new_types):
+            return True
+    return False
+
+#create the member of a data type that computes the value of a member that was added to a struct
+def get_added_member(new_member, spec, old_members):
+    added_member = {
+        "label":new_member["label"],
+        "type":new_member["type"],
+        "newSlot":int_to_256bit_hex_string(int(new_member["slot"])),
+        "newOffset":new_member["offset"],
+    }
+    input_labels = spec.get("inputs",[])
+    if "expression" in spec:
+        if "transform" in spec or "inputs" in spec or "initialValue" in spec:
+            raise Exception("Expression can not be combined with a transform, inputs or an initial value for member: "+new_member["label"])
+        added_member["expression"] = spec["expression"]
+        input_labels = get_expression_variables(spec["expression"])
+    elif "transform" in spec:
+        if "initialValue" in spec:
+            raise Exception("Transform can not be combined with an initial value for member: "+new_member["label"])
+        if len(input_labels) == 0:
+            raise Exception("Transform of added member requires inputs: "+new_member["label"])
+        added_member["transform"] = spec["transform"]
+    elif "initialValue" in spec:
+        added_member["initialValue"] = spec["initialValue"]
+    else:
+        raise Exception("No initial value, transform or expression for member: "+new_member["label"])
+    for input_label in input_labels:
+        old_member = next((member for member in old_members if member["label"] == input_label),None)
+        if old_member is None:
+            raise Exception("Input "+input_label+" of member "+new_member["label"]+" not found in the old struct")
+        added_member.setdefault("inputs",[]).append({
+            "label":old_member["label"],
+            "type":old_member["type"],
+            "oldSlot":int_to_256bit_hex_string(int(old_member["slot"])),
+            "oldOffset":old_member["offset"],
+        })
+    return added_member
+
+#add the members that were added to or removed from the structs of the data types. original_old_types are the types
+#of the old contract before get_types removed the members that are not present in the new contract
+def add_struct_changes(original_old_types, old_types, new_types, data_types, specs):
+    inserted_types = [type["type"] for type in data_types]
+    #the specs are processed in a fixed order so that the data types are always in the same order
+    for name in sorted(specs):
+        spec = specs[name]
+        struct_types = [type for type in data_types if type["label"] == "struct "+name and type["oldNumberOfBytes"] != 0 and type["newNumberOfBytes"] != 0]
+        if len(struct_types) == 0:
+            raise Exception("Struct not found in both contracts: "+name)
+        if spec.get("removed","report") not in ("report","archive"):
+            raise Exception("Invalid policy for removed members "+spec["removed"]+" of "+name)
+        struct_type = struct_types[-1]
+        old_members = original_old_types[struct_type["type"]]["members"]
+        new_members = new_types[struct_type["type"]]["members"]
+        member_specs = spec.get("members",{})
+        for label in member_specs:
+            if label not in [member["label"] for member in new_members]:
+                raise Exception("Member "+label+" not found in the new struct "+name)
+        added_members = []
+        archived_members = []
+        type_names = []
+        for new_member in new_members:
+            if new_member["label"] not in member_specs:
+                continue
+            if is_common_member(new_member,old_members,new_types,original_old_types):
+                raise Exception("Member "+new_member["label"]+" of "+name+" is not added")
+            added_member = get_added_member(new_member,member_specs[new_member["label"]],old_members)
+            added_members.append(added_member)
+            type_names.append(added_member["type"])
+            for transform_input in added_member.get("inputs",[]):
+                type_names.append(transform_input["type"])
+        if spec.get("removed") == "archive":
+            for old_member in old_members:
+                if is_common_member(old_member,new_members,original_old_types,new_types):
+                    continue
+                archived_members.append({
+                    "label":old_member["label"],
+                    "type":old_member["type"],
+                    "oldSlot":int_to_256bit_hex_string(int(old_member["slot"])),
+                    "oldOffset":old_member["offset"],
+                })
+                type_names.append(old_member["type"])
+        number_of_types = len(data_types)
+        for type_name in type_names:
+            process_any_type(old_types,new_types,type_name,inserted_types,data_types)
+        for type in data_types[number_of_types:]:
+            format_members(type)
+        if len(added_members) != 0:
+            struct_type["addedMembers"] = added_members
+        if len(archived_members) != 0:
+            struct_type["archivedMembers"] = archived_members
+
+#create storage objects that initialize the variables that are only present in the new contract
+def get_initializers(old_json, new_json, initial_values):
+    old_labels = [old_storage_object["label"] for old_storage_object in old_json["storage"]]
+    new_labels = [new_storage_object["label"] for new_storage_object in new_json["storage"]]
+
+    for label in initial_values:
+        if label not in new_labels:
+            raise Exception("Initialized variable not found in the new contract: "+label)
+        if label in old_labels:
+            raise Exception("Initialized variable already present in the old contract: "+label)
+
+    initializers = []
+    for new_storage_object in new_json["storage"]:
+        if new_storage_object["label"] not in initial_values:
+            continue
+        initializers.append({
+            "label":new_storage_object["label"],
+            "type":new_storage_object["type"],
+            "oldSlot":int_to_256bit_hex_string(0),
+            "newSlot":int_to_256bit_hex_string(int(new_storage_object["slot"])),
+            "oldOffset":0,
+            "newOffset":new_storage_object["offset"],
+            "initialValue":initial_values[new_storage_object["label"]],
+        })
+    return initializers
+
+#find the old variables referenced by a transform expression in the order of their first use.
+#string literals and numbers are skipped and identifiers followed by "(" are casts or functions
+def get_expression_variables(expression):
+    variables = []
+    for match in re.finditer(r'"(?:[^"\\]|\\.)*"|\d[\w$]*|([A-Za-z_$][\w$]*)(\s*\()?', expression):
+        name = match.group(1)
+        if name is None or match.group(2) is not None or name in ("true","false"):
+            continue
+        if name not in variables:
+            variables.append(name)
+    return variables
+
+#add the keys whose values are reorganized to the storage objects of mappings, the keys are given as a list or as an
+#object that also marks them as complete
+def add_mapping_keys(old_json, common_objects, mapping_keys):
+    for label in mapping_keys:
+        keys = mapping_keys[label]
+        if not isinstance(keys, dict):
+            keys = {"keys": keys}
+        storage_objects = [storage_object for storage_object in common_objects if storage_object["label"] == label]
+        if len(storage_objects) == 0:
+            raise Exception("Keys given for a mapping that is not present in both contracts: "+label)
+        for storage_object in storage_objects:
+            if old_json["types"][storage_object["type"]]["encoding"] not in ("mapping","vyper_hashmap"):
+                raise Exception("Keys given for a variable that is not a mapping: "+label)
+            storage_object["keys"] = keys["keys"]
+            if keys.get("complete", False):
+                storage_object["complete"] = True
+
+#add the truncation policies of the arrays that shrink or are converted into fixed size arrays to their storage objects
+def add_truncation_policies(old_json, new_json, common_objects, policies):
+    for label in policies:
+        if policies[label] not in ("fail","export"):
+            raise Exception("Invalid truncation policy "+policies[label]+" of "+label)
+        storage_objects = [storage_object for storage_object in common_objects if storage_object["label"] == label and "newType" in storage_object and "transform" not in storage_object and "expression" not in storage_object and "initialValue" not in storage_object and (is_fixed_array_resize(storage_object["type"],storage_object["newType"],old_json["types"],new_json["types"]) or is_array_kind_conversion(storage_object["type"],storage_object["newType"],old_json["types"],new_json["types"]))]
+        if len(storage_objects) == 0:
+            raise Exception("Truncation policy given for a variable that is not a resized array: "+label)
+        for storage_object in storage_objects:
+            storage_object["truncate"] = policies[label]
+
+#find a storage object or a member of a struct by its path, e.g. info.name. The slot of the result is the absolute slot of the member
+def find_field(storage_layout, path):
+    labels = path.split(".")
+    items = [item for item in storage_layout["storage"] if item["label"] == labels[0]]
+    if len(items) == 0:
+        return None
+    item = items[0]
+    slot = int(item["slot"])
+    for label in labels[1:]:
+        members = [member for member in storage_layout["types"].get(item["type"],{}).get("members",[]) if member["label"] == label]
+        if len(members) == 0:
+            return None
+        item = members[0]
+        slot += int(item["slot"])
+    return {"label":path,"type":item["type"],"slot":slot,"offset":item["offset"]}
+
+#create storage objects that move single fields between variables and struct members, keyed by the paths in the new contract
+def get_field_mappings(old_json, new_json, field_mappings, common_objects):
+    result = []
+    common_labels = [common_object["label"] for common_object in common_objects]
+    for new_path in sorted(field_mappings):
+        old_path = field_mappings[new_path]
+        new_field = find_field(new_json, new_path)
+        if new_field is None:
+            raise Exception("Mapped field not found in the new contract: "+new_path)
+        old_field = find_field(old_json, old_path)
+        if old_field is None:
+            raise Exception("Mapped field not found in the old contract: "+old_path)
+        if not is_type_equal(old_field["type"],new_field["type"],old_json["types"],new_json["types"]):
+            raise Exception("Mapped fields have different types: "+old_path+" and "+new_path)
+        #the variables that are present in both contracts are already moved as a whole
+        if new_path.split(".")[0] in common_labels:
+            raise Exception("Mapped field belongs to a variable that is present in both contracts: "+new_path)
+        result.append({
+            "label":new_path,
+            "type":old_field["type"],
+            "oldSlot":int_to_256bit_hex_string(old_field["slot"]),
+            "newSlot":int_to_256bit_hex_string(new_field["slot"]),
+            "oldOffset":old_field["offset"],
+            "newOffset":new_field["offset"],
+        })
+    return result
+
+#create storage objects whose values are computed by transforms from the values of old variables
+def get_transforms(old_json, new_json, transforms):
+    old_storage_objects = {old_storage_object["label"]:old_storage_object for old_storage_object in old_json["storage"]}
+    new_labels = [new_storage_object["label"] for new_storage_object in new_json["storage"]]
+
+    for label in transforms:
+        if label not in new_labels:
+            raise Exception("Transformed variable not found in the new contract: "+label)
+
+    result = []
+    for new_storage_object in new_json["storage"]:
+        if new_storage_object["label"] not in transforms:
+            continue
+        transform = transforms[new_storage_object["label"]]
+        transformed_object = {
+            "label":new_storage_object["label"],
+            "type":new_storage_object["type"],
+            "oldSlot":int_to_256bit_hex_string(0),
+            "newSlot":int_to_256bit_hex_string(int(new_storage_object["slot"])),
+            "oldOffset":0,
+            "newOffset":new_storage_object["offset"],
+        }
+        input_labels = transform.get("inputs",[])
+        #expressions take the old variables they reference as inputs
+        if "expression" in transform:
+            if "transform" in transform or len(input_labels) != 0:
+                raise Exception("Expression can not be combined with a transform or inputs: "+new_storage_object["label"])
+            transformed_object["expression"] = transform["expression"]
+            input_labels = get_expression_variables(transform["expression"])
+        elif "transform" not in transform:
+            raise Exception("No transform or expression for: "+new_storage_object["label"])
+        else:
+            transformed_object["transform"] = transform["transform"]
+        #without inputs the old value of the variable itself is transformed
+        if "expression" not in transform and len(input_labels) == 0:
+            if new_storage_object["label"] not in old_storage_objects:
+                raise Exception("Transformed variable not found in the old contract: "+new_storage_object["label"])
+            old_storage_object = old_storage_objects[new_storage_object["label"]]
+            transformed_object["type"] = old_storage_object["type"]
+            transformed_object["oldSlot"] = int_to_256bit_hex_string(int(old_storage_object["slot"]))
+            transformed_object["oldOffset"] = old_storage_object["offset"]
+            if old_storage_object["type"] != new_storage_object["type"]:
+                transformed_object["newType"] = new_storage_object["type"]
+        for input_label in input_labels:
+            if input_label not in old_storage_objects:
+                raise Exception("Transform input not found in the old contract: "+input_label)
+            old_storage_object = old_storage_objects[input_label]
+            transformed_object.setdefault("inputs",[]).append({
+                "label":input_label,
+                "type":old_storage_object["type"],
+                "oldSlot":int_to_256bit_hex_string(int(old_storage_object["slot"])),
+                "oldOffset":old_storage_object["offset"],
+            })
+        result.append(transformed_object)
+    return result
+
+def readJSON(file_name):
+    with open(file_name) as json_file:
+        return json.load(json_file)
+
 def writeJSON(file_name,data):
     with open(file_name, 'w') as json_file:
         json.dump(data, json_file, indent=2)
@@ -252,8 +751,125 @@ def get_directories_in_path(directory_path):
 def modify_struct_types(text):
     pattern = r't_struct\((.*?)\)[a-zA-Z0-9]+_storage'
     result = re.sub(pattern, r't_struct(\1)_storage', text)
+    #enum, contract and user defined value type ids also contain the ast id of their definition
+    result = re.sub(r't_(enum|contract|userDefinedValueType)\((.*?)\)[0-9]+', r't_\1(\2)', result)
     return result
 
+#add the names of the enum members to the enum types, solc does not include them in the storage layout
+def add_enum_members(storage_layout, file_name):
+    with open(file_name) as source_file:
+        source = source_file.read()
+    enums = {}
+    for match in re.finditer(r'\benum\s+(\w+)\s*\{([^}]*)\}', source):
+        enums[match.group(1)] = [member.strip() for member in match.group(2).split(",") if member.strip() != ""]
+    for type_def in storage_layout["types"].values():
+        if type_def["label"].startswith("enum "):
+            name = type_def["label"].split(".")[-1]
+            if name in enums:
+                type_def["enumMembers"] = enums[name]
+
+#add the underlying types to the user defined value types, solc does not include them in the storage layout
+def add_underlying_types(storage_layout, file_name):
+    with open(file_name) as source_file:
+        source = source_file.read()
+    underlying_types = {}
+    for match in re.finditer(r'\btype\s+(\w+)\s+is\s+(\w+)\s*;', source):
+        underlying_types[match.group(1)] = match.group(2)
+    for type_id,type_def in storage_layout["types"].items():
+        if type_id.startswith("t_userDefinedValueType"):
+            name = type_def["label"].split(".")[-1]
+            if name in underlying_types:
+                type_def["underlyingType"] = underlying_types[name]
+
+#find the category of a value type from its type id, None if it is not a value type
+def get_value_type_category(type_id, type_def):
+    if type_def["encoding"] != "inplace" or "base" in type_def or "members" in type_def:
+        return None
+    for prefix,category in (("t_function_internal","internal_function"),("t_function_external","external_function"),("t_userDefinedValueType","user_defined"),("t_contract","contract"),("t_enum","enum"),("t_address","address")):
+        if type_id.startswith(prefix):
+            return category
+    if type_id == "t_bool":
+        return "bool"
+    return "elementary"
+
+#check if a data type contains internal function pointers, which are code positions of the old contract
+def contains_internal_function(type_id, types):
+    if type_id not in types:
+        return False
+    type_def = types[type_id]
+    if get_value_type_category(type_id,type_def) == "internal_function":
+        return True
+    for field in ("base","value"):
+        if field in type_def and contains_internal_function(type_def[field],types):
+            return True
+    for member in type_def.get("members",[]):
+        if contains_internal_function(member["type"],types):
+            return True
+    return False
+
+#check if a value can be copied without changing its bytes although its type changed. Contracts and addresses
+#can be converted into each other, user defined value types into their underlying types and back
+def is_value_type_conversion(old_type_id, new_type_id, old_types, new_types):
+    if old_type_id not in old_types or new_type_id not in new_types:
+        return False
+    old_type = old_types[old_type_id]
+    new_type = new_types[new_type_id]
+    if old_type["numberOfBytes"] != new_type["numberOfBytes"]:
+        return False
+    old_category = get_value_type_category(old_type_id,old_type)
+    new_category = get_value_type_category(new_type_id,new_type)
+    if old_category in ("address","contract") and new_category in ("address","contract"):
+        return True
+    if old_category == "user_defined" and new_category == "user_defined":
+        return "underlyingType" in old_type and old_type["underlyingType"] == new_type.get("underlyingType")
+    if old_category == "user_defined":
+        return old_type.get("underlyingType") == new_type["label"]
+    if new_category == "user_defined":
+        return new_type.get("underlyingType") == old_type["label"]
+    return False
+
+#get the length of a fixed size array from its label e.g. 3 for uint8[3], None if the type is not a fixed size array
+def get_array_length(label):
+    match = re.search(r'\[(\d+)\]$', label)
+    if match is None:
+        return None
+    return int(match.group(1))
+
+#check if the length of a fixed size array changed while its base type stayed the same, e.g. uint64[4] to uint64[6]
+def is_fixed_array_resize(old_type_id, new_type_id, old_types, new_types):
+    if old_type_id not in old_types or new_type_id not in new_types:
+        return False
+    old_type = old_types[old_type_id]
+    new_type = new_types[new_type_id]
+    if old_type["encoding"] != "inplace" or new_type["encoding"] != "inplace" or "base" not in old_type or "base" not in new_type:
+        return False
+    old_length = get_array_length(old_type["label"])
+    new_length = get_array_length(new_type["label"])
+    if old_length is None or new_length is None or old_length == new_length:
+        return False
+    return is_type_equal(old_type["base"],new_type["base"],old_types,new_types)
+
+#check if a fixed size array was converted into a dynamic array or back while its base type stayed the same, e.g. address[10] to address[]
+def is_array_kind_conversion(old_type_id, new_type_id, old_types, new_types):
+    if old_type_id not in old_types or new_type_id not in new_types:
+        return False
+    old_type = old_types[old_type_id]
+    new_type = new_types[new_type_id]
+    if "base" not in old_type or "base" not in new_type:
+        return False
+    if (old_type["encoding"],new_type["encoding"]) not in (("inplace","dynamic_array"),("dynamic_array","inplace")):
+        return False
+    return is_type_equal(old_type["base"],new_type["base"],old_types,new_types)
+
+#build the table that translates the old values of an enum into the new values, -1 if a member was removed
+def get_enum_mapping(old_members, new_members):
+    if len(old_members) == 0 or len(new_members) == 0:
+        return None
+    mapping = [new_members.index(member) if member in new_members else -1 for member in old_members]
+    if mapping == list(range(len(old_members))):
+        return None
+    return mapping
+
 def clean_types(storage_layout):
     storage = storage_layout["storage"]
     types = storage_layout["types"]
@@ -265,11 +881,11 @@ def clean_types(storage_layout):
     all_keys = list(types.keys())
     for key in all_keys:
         new_key = modify_struct_types(key)
-        if "base" in types[key]:
-            base = types[key]["base"]
-            new_base = modify_struct_types(base)
-            if new_base != base:
-                types[key]["base"] = new_base
+        for field in ("base","key","value"):
+            if field in types[key]:
+                types[key][field] = modify_struct_types(types[key][field])
+        for member in types[key].get("members",[]):
+            member["type"] = modify_struct_types(member["type"])
         if new_key != key:
             types[new_key] = types.pop(key)
 
@@ -278,6 +894,104 @@ def clean_types(storage_layout):
 
 
 
+#read the options of the plan of a test directory, keyed by the names of their files
+def read_plan_options(current_directory):
+    options = {}
+    for name in ("field_mappings","mapping_keys","initial_values","transforms","truncation_policies","struct_members"):
+        if os.path.exists(current_directory+"/"+name+".json"):
+            options[name] = readJSON(current_directory+"/"+name+".json")
+    return options
+
+#keep the options that refer to the variables of the contract of a target of a split, struct changes and field mappings only apply to the reorganized account
+def filter_plan_options(options, storage_layout):
+    labels = [storage_object["label"] for storage_object in storage_layout["storage"]]
+    return {name: {label: value for label, value in options[name].items() if label in labels} for name in ("mapping_keys","initial_values","transforms","truncation_policies") if name in options}
+
+#add the data types of the plan of a target of a split, a data type used by several plans must be reorganized the same way
+def merge_data_types(data_types, target_data_types, account):
+    for target_data_type in target_data_types:
+        data_type = next((data_type for data_type in data_types if data_type["type"] == target_data_type["type"]), None)
+        if data_type is None:
+            data_types.append(target_data_type)
+        elif data_type != target_data_type:
+            raise Exception("Type "+target_data_type["type"]+" is reorganized differently for account "+account)
+
+#check that the variables of a merged layout do not share the bytes of a slot, the layout of a merge is often written by hand from the layouts of the sources
+def check_slot_collisions(storage_layout):
+    ranges = []
+    for storage_object in storage_layout["storage"]:
+        start = int(storage_object["slot"])*32+storage_object["offset"]
+        end = start+int(storage_layout["types"][storage_object["type"]]["numberOfBytes"])
+        for label, other_start, other_end in ranges:
+            if start < other_end and other_start < end:
+                raise Exception("Slot collision at slot "+str(start//32)+" between "+label+" and "+storage_object["label"])
+        ranges.append((storage_object["label"], start, end))
+
+#generate the plan that merges the storage of the sources into the reorganized account, the variables that are not in the old layout are read from the source that declares them
+#a variable declared by several accounts collides unless the owners name the account that keeps it, the zero address for the reorganized account
+def get_merge_plan(old_storage_layout, new_storage_layout, sources, owners, options):
+    check_slot_collisions(new_storage_layout)
+    zero_address = "0x"+"0"*40
+    old_labels = [storage_object["label"] for storage_object in old_storage_layout["storage"]]
+    new_labels = [storage_object["label"] for storage_object in new_storage_layout["storage"]]
+    for label in owners:
+        if label not in new_labels:
+            raise Exception("Owner given for a variable that is not present in the new layout: "+label)
+    source_owners = {}
+    for label in new_labels:
+        accounts = [zero_address] if label in old_labels else []
+        accounts += [source["account"] for source in sources if any(storage_object["label"] == label for storage_object in source["storage_layout"]["storage"])]
+        if label in owners:
+            owner = next((account for account in accounts if account.lower() == owners[label].lower()), None)
+            if owner is None:
+                raise Exception("Owner "+owners[label]+" of variable "+label+" does not declare it")
+        elif len(accounts) > 1:
+            raise Exception("Variable "+label+" collides, it is declared by account "+accounts[0]+" and account "+accounts[1])
+        elif len(accounts) == 1:
+            owner = accounts[0]
+        else:
+            continue
+        if owner != zero_address:
+            source_owners[label] = owner
+    account_storage_layout = {"storage": [storage_object for storage_object in new_storage_layout["storage"] if storage_object["label"] not in source_owners], "types": copy.deepcopy(new_storage_layout["types"])}
+    account_options = filter_plan_options(options, account_storage_layout)
+    account_options.update({name: options[name] for name in ("field_mappings","struct_members") if name in options})
+    result, data_types = get_plan(old_storage_layout, account_storage_layout, account_options)
+    for source in sources:
+        source_storage_layout = {"storage": [storage_object for storage_object in new_storage_layout["storage"] if source_owners.get(storage_object["label"]) == source["account"]], "types": copy.deepcopy(new_storage_layout["types"])}
+        source_result, source_data_types = get_plan(source["storage_layout"], source_storage_layout, filter_plan_options(options, source_storage_layout))
+        for storage_object in source_result:
+            storage_object["source"] = source["account"]
+        result += source_result
+        merge_data_types(data_types, source_data_types, source["account"])
+    return result, data_types
+
+#generate the storage objects and the data types that reorganize the storage from the old to the new contract, the types of the old layout are modified
+def get_plan(old_storage_layout, new_storage_layout, options):
+    result = get_objects(old_storage_layout, new_storage_layout)
+    #fields that are moved into or out of structs
+    if "field_mappings" in options:
+        result += get_field_mappings(old_storage_layout, new_storage_layout, options["field_mappings"], result)
+    #the values of mappings are only reorganized for the given keys
+    if "mapping_keys" in options:
+        add_mapping_keys(old_storage_layout, result, options["mapping_keys"])
+    #the initial values of the new variables are optional
+    if "initial_values" in options:
+        result += get_initializers(old_storage_layout, new_storage_layout, options["initial_values"])
+    #transformed variables are computed instead of being copied
+    if "transforms" in options:
+        result = [storage_object for storage_object in result if storage_object["label"] not in options["transforms"]]
+        result += get_transforms(old_storage_layout, new_storage_layout, options["transforms"])
+    #the dropped elements of shrinking fixed size arrays must be zero unless they are exported
+    if "truncation_policies" in options:
+        add_truncation_policies(old_storage_layout, new_storage_layout, result, options["truncation_policies"])
+    original_old_types = copy.deepcopy(old_storage_layout["types"])
+    data_types = get_types(old_storage_layout["types"],new_storage_layout["types"],result)
+    #added members of structs are computed and removed members can be archived
+    if "struct_members" in options:
+        add_struct_changes(original_old_types, old_storage_layout["types"], new_storage_layout["types"], data_types, options["struct_members"])
+    return result, data_types
+
 if __name__ == "__main__":
     
     target_directory = "../Tests"
@@ -290,12 +1004,41 @@ if __name__ == "__main__":
         new_file = current_directory+"/"+"New.sol"
         old_storage_layout = get_storage_layout(old_file)
         clean_types(old_storage_layout)
+        add_enum_members(old_storage_layout, old_file)
+        add_underlying_types(old_storage_layout, old_file)
         new_storage_layout = get_storage_layout(new_file)
         clean_types(new_storage_layout)
+        add_enum_members(new_storage_layout, new_file)
+        add_underlying_types(new_storage_layout, new_file)
+        #the layouts are written before get_types modifies the types
+        writeJSON(current_directory+"/"+"old_layout.json",old_storage_layout)
+        writeJSON(current_directory+"/"+"new_layout.json",new_storage_layout)
         
-        result = get_objects(old_storage_layout, new_storage_layout)
-        #nested,flat = get_types(old_storage_layout,result)
-        data_types = get_types(old_storage_layout["types"],new_storage_layout["types"],result)
+        #the storage of several contracts is merged into the reorganized account
+        if os.path.exists(current_directory+"/"+"merge.json"):
+            sources = [{"account": source["account"], "storage_layout": readJSON(current_directory+"/"+source["layout"])} for source in readJSON(current_directory+"/"+"merge.json")["sources"]]
+            result, data_types = get_merge_plan(old_storage_layout, new_storage_layout, sources, readJSON(current_directory+"/"+"merge.json").get("owners", {}), read_plan_options(current_directory))
+            writeJSON(current_directory+"/"+"storage_reorg_info.json",result)
+            writeJSON(current_directory+"/"+"data_types.json",data_types)
+            continue
+
+        #the storage of a split contract is moved into the accounts of the targets as well
+        split = readJSON(current_directory+"/"+"split.json") if os.path.exists(current_directory+"/"+"split.json") else {"targets":[]}
+        original_old_storage_layout = copy.deepcopy(old_storage_layout)
+        options = read_plan_options(current_directory)
+        account_options = options
+        #the options of all the accounts are given together
+        if len(split["targets"]) != 0:
+            account_options = filter_plan_options(options, new_storage_layout)
+            account_options.update({name: options[name] for name in ("field_mappings","struct_members") if name in options})
+        result, data_types = get_plan(old_storage_layout, new_storage_layout, account_options)
+        for target in split["targets"]:
+            target_storage_layout = readJSON(current_directory+"/"+target["layout"])
+            target_result, target_data_types = get_plan(copy.deepcopy(original_old_storage_layout), target_storage_layout, filter_plan_options(options, target_storage_layout))
+            for storage_object in target_result:
+                storage_object["account"] = target["account"]
+            result += target_result
+            merge_data_types(data_types, target_data_types, target["account"])
         #print(json.dumps(data_types,indent=2))
         
         writeJSON(current_directory+"/"+"storage_reorg_info.json",result)
@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    enum Color { Red, Green, Blue }
+
+    struct Item {
+        uint8 id;
+        Color color;
+    }
+
+    Color favorite;
+    Item item;
+    Color[3] palette;
+    Color[] history;
+    mapping(address => Color) choices;
+
+    function compute() public {
+
+        favorite = Color.Blue;
+        item = Item(7, Color.Green);
+        palette = [Color.Red, Color.Green, Color.Blue];
+        history.push(Color.Blue);
+        history.push(Color.Red);
+        history.push(Color.Green);
+        choices[0x5B38Da6a701c568545dCfcB03FcB875f56beddC4] = Color.Green;
+        choices[0xAb8483F64d9C6d1EcF9b849Ae677dD3315835cb2] = Color.Blue;
+    }
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+interface Ownable {
+    function owner() external view returns (address);
+}
+
+contract MyContract{
+
+    type Price is uint128;
+
+    // the token is stored as an address, the raw amount becomes a Price and the owner an Ownable contract
+    address token;
+    bool active;
+    int64 delta;
+    Price price;
+    Price rawAmount;
+    Ownable owner;
+    function(uint256) external returns (uint256) callback;
+
+    function double(uint256 value) external pure returns (uint256) {
+
+        return value * 2;
+    }
+
+    function compute() public {
+
+        price = Price.wrap(1000);
+        rawAmount = Price.wrap(5);
+        token = 0x5B38Da6a701c568545dCfcB03FcB875f56beddC4;
+        active = true;
+        owner = Ownable(0xAb8483F64d9C6d1EcF9b849Ae677dD3315835cb2);
+        delta = -3;
+        callback = this.double;
+    }
+}
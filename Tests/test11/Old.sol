@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+interface IERC20 {
+    function totalSupply() external view returns (uint256);
+}
+
+contract MyContract{
+
+    type Price is uint128;
+    type Delta is int64;
+
+    Price price;
+    uint128 rawAmount;
+    IERC20 token;
+    bool active;
+    address owner;
+    Delta delta;
+    function(uint256) external returns (uint256) callback;
+
+    function double(uint256 value) external pure returns (uint256) {
+
+        return value * 2;
+    }
+
+    function compute() public {
+
+        price = Price.wrap(1000);
+        rawAmount = 5;
+        token = IERC20(0x5B38Da6a701c568545dCfcB03FcB875f56beddC4);
+        active = true;
+        owner = 0xAb8483F64d9C6d1EcF9b849Ae677dD3315835cb2;
+        delta = Delta.wrap(-3);
+        callback = this.double;
+    }
+}
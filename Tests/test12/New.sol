@@ -0,0 +1,16 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    struct Person {
+        string name;
+        uint age;
+    }
+
+    uint64[6] grow;
+    uint64[4] shrinkZero;
+    uint64[4] shrinkExport;
+    Person[3] people;
+    uint24[][3] nested;
+}
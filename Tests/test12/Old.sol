@@ -0,0 +1,28 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    struct Person {
+        string name;
+        uint age;
+    }
+
+    uint64[4] grow;
+    uint64[6] shrinkZero;
+    uint64[6] shrinkExport;
+    Person[2] people;
+    uint24[][2] nested;
+
+    function compute() public {
+
+        grow = [1, 2, 3, 4];
+        shrinkZero = [5, 6, 7, 8, 0, 0];
+        shrinkExport = [9, 10, 11, 12, 13, 14];
+        people[0] = Person("Alice", 30);
+        people[1] = Person("Bob", 40);
+        nested[0].push(1);
+        nested[0].push(2);
+        nested[1].push(7);
+    }
+}
@@ -0,0 +1,16 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    struct Person {
+        string name;
+        uint age;
+    }
+
+    address[] admins;
+    uint64[6] packed;
+    Person[3] people;
+    Person[] team;
+    uint16[2] overflow;
+}
@@ -0,0 +1,27 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    struct Person {
+        string name;
+        uint age;
+    }
+
+    address[3] admins;
+    uint64[] packed;
+    Person[] people;
+    Person[2] team;
+    uint16[] overflow;
+
+    function compute() public {
+
+        admins = [0x5B38Da6a701c568545dCfcB03FcB875f56beddC4, 0xAb8483F64d9C6d1EcF9b849Ae677dD3315835cb2, 0x4B20993Bc481177ec7E8f571ceCaE8A9e22C02db];
+        packed = [1, 2, 3, 4, 5];
+        people.push(Person("Alice", 30));
+        people.push(Person("Bob", 40));
+        team[0] = Person("Carol", 50);
+        team[1] = Person("Dave", 60);
+        overflow = [1, 2, 3];
+    }
+}
@@ -0,0 +1,17 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    struct Person {
+        uint64 age;
+        string name;
+        uint32 level;
+        uint64 ageInMonths;
+        string nickname;
+    }
+
+    Person owner;
+    Person[2] team;
+    Person[] members;
+}
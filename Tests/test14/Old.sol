@@ -0,0 +1,24 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    struct Person {
+        string name;
+        uint64 age;
+        uint64 score;
+        address wallet;
+    }
+
+    Person owner;
+    Person[2] team;
+    Person[] members;
+
+    function compute() public {
+
+        owner = Person("Alice", 30, 7, 0x5B38Da6a701c568545dCfcB03FcB875f56beddC4);
+        team[0] = Person("Bob", 40, 8, 0xAb8483F64d9C6d1EcF9b849Ae677dD3315835cb2);
+        team[1] = Person("Carol", 50, 9, 0x4B20993Bc481177ec7E8f571ceCaE8A9e22C02db);
+        members.push(Person("Dave", 60, 10, 0x78731D3Ca6b7E34aC0F824c42a7cC18A495cabaB));
+    }
+}
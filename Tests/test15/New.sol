@@ -0,0 +1,23 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    struct Inner {
+        string note;
+        uint16[3] small;
+        uint8 a;
+    }
+
+    struct Outer {
+        uint8[3] flags;
+        Inner[] list;
+        Inner inner;
+        Inner[2] pair;
+    }
+
+    uint256 counter;
+    Outer data;
+    string[2] names;
+    Outer[] history;
+}
@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    struct Inner {
+        uint8 a;
+        uint16[3] small;
+        string note;
+    }
+
+    struct Outer {
+        Inner inner;
+        Inner[2] pair;
+        Inner[] list;
+        uint8[3] flags;
+    }
+
+    Outer data;
+    string[2] names;
+    uint256 counter;
+    Outer[] history;
+
+    function compute() public {
+
+        data.inner = Inner(5, [uint16(1), 2, 3], "hi");
+        data.pair[0] = Inner(6, [uint16(4), 5, 6], "a note that is longer than thirty one bytes");
+        data.pair[1] = Inner(7, [uint16(7), 8, 9], "p1");
+        data.list.push(Inner(8, [uint16(10), 11, 12], "l0"));
+        data.flags = [1, 2, 3];
+        names = ["short", "a name that is definitely longer than thirty one bytes"];
+        counter = 99;
+        history.push();
+        history[0].inner = Inner(9, [uint16(13), 14, 15], "h0");
+        history[0].list.push(Inner(10, [uint16(16), 17, 18], "h0l0"));
+        history[0].flags = [4, 5, 6];
+    }
+}
@@ -0,0 +1,17 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    struct TokenInfo {
+        string name;
+        uint8 decimals;
+        uint256 totalSupply;
+    }
+
+    TokenInfo info;
+    address owner;
+    uint256 counter;
+    uint64 createdAt;
+    string description;
+}
@@ -0,0 +1,26 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    struct Meta {
+        address owner;
+        uint64 createdAt;
+        string description;
+    }
+
+    uint256 totalSupply;
+    uint8 decimals;
+    string name;
+    Meta meta;
+    uint256 counter;
+
+    function compute() public {
+
+        totalSupply = 1000000;
+        decimals = 18;
+        name = "A token name that is longer than thirty one bytes";
+        meta = Meta(0x5B38Da6a701c568545dCfcB03FcB875f56beddC4, 1700000000, "A description that does not fit into a single slot");
+        counter = 7;
+    }
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    enum Status { Pending, Active, Closed }
+
+    struct Position {
+        uint64 amount;
+        address holder;
+        uint32 since;
+    }
+
+    address owner;
+    Status status;
+    uint64[3] checkpoints;
+    Position position;
+    mapping(address => uint256) balances;
+    uint256 legacy;
+    uint128 total;
+    string name;
+
+    function compute() public {
+
+        owner = 0xAb8483F64d9C6d1EcF9b849Ae677dD3315835cb2;
+        status = Status.Active;
+        checkpoints = [10, 20, 30];
+        position = Position(500, 0x4B20993Bc481177ec7E8f571ceCaE8A9e22C02db, 1600000000);
+        balances[0x5B38Da6a701c568545dCfcB03FcB875f56beddC4] = 100;
+        balances[0x78731D3Ca6b7E34aC0F824c42a7cC18A495cabaB] = 200;
+        balances[0x617F2E2fD72FD9D5503197092aC168c91465E7f2] = 300;
+        legacy = 42;
+        total = 12345;
+        name = "token";
+    }
+}
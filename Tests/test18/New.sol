@@ -0,0 +1,23 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    enum Status { Active, Closed, Pending, Frozen }
+
+    struct Position {
+        uint16 tier;
+        uint64 amount;
+        address holder;
+    }
+
+    Status status;
+    address owner;
+    uint64[4] checkpoints;
+    Position position;
+    uint256 version;
+    uint256 legacy;
+    mapping(address => uint256) balances;
+    uint256 doubled;
+    string name;
+}
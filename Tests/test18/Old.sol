@@ -0,0 +1,25 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+interface IOwner {}
+
+contract MyContract{
+
+    enum Status { Closed, Pending, Active }
+
+    struct Position {
+        address holder;
+        uint32 since;
+        uint64 amount;
+        uint16 tier;
+    }
+
+    string name;
+    IOwner owner;
+    uint64[5] checkpoints;
+    uint128 total;
+    Position position;
+    Status status;
+    mapping(address => uint256) balances;
+    uint256 version;
+}
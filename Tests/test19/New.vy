@@ -0,0 +1,25 @@
+# @version ^0.3.10
+
+interface ERC20:
+    def transfer(to: address, amount: uint256) -> bool: nonpayable
+
+struct Position:
+    amount: uint256
+    tags: DynArray[uint8, 3]
+    owner: address
+
+flag Roles:
+    ADMIN
+    MINTER
+
+paused: public(bool)
+owner: public(address)
+history: DynArray[uint256, 4]
+symbol: public(String[8])
+balances: public(HashMap[address, uint256])
+token: public(ERC20)
+name: public(String[40])
+positions: public(HashMap[uint256, Position])
+aliases: public(HashMap[String[16], address])
+roles: public(HashMap[address, Roles])
+fee: public(uint256)
@@ -0,0 +1,24 @@
+# @version ^0.3.10
+
+interface ERC20:
+    def transfer(to: address, amount: uint256) -> bool: nonpayable
+
+struct Position:
+    owner: address
+    amount: uint256
+    tags: DynArray[uint8, 3]
+
+flag Roles:
+    ADMIN
+    MINTER
+
+owner: public(address)
+name: public(String[40])
+balances: public(HashMap[address, uint256])
+positions: public(HashMap[uint256, Position])
+history: DynArray[uint256, 4]
+roles: public(HashMap[address, Roles])
+symbol: public(String[8])
+aliases: public(HashMap[String[16], address])
+token: public(ERC20)
+paused: public(bool)
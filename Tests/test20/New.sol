@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+library LibDiamond {
+    /// @custom:storage-location diamond:diamond.standard.diamond.storage
+    struct DiamondStorage {
+        address contractOwner;
+        uint96 version;
+        bytes4[] selectors;
+    }
+
+    function diamondStorage() internal pure returns (DiamondStorage storage ds) {
+        bytes32 position = keccak256("diamond.standard.diamond.storage");
+        assembly {
+            ds.slot := position
+        }
+    }
+}
+
+contract Vault {
+    /// @custom:storage-location erc7201:example.vault.main.v2
+    struct MainStorage {
+        address asset;
+        bool paused;
+        uint256 totalAssets;
+        uint64[] checkpoints;
+    }
+
+    /// @custom:storage-location erc7201:example.vault.fees
+    struct FeeStorage {
+        uint16 feeBps;
+        address recipient;
+    }
+
+    uint256 public counter;
+    address public owner;
+
+    // keccak256(abi.encode(uint256(keccak256("example.vault.main.v2")) - 1)) & ~bytes32(uint256(0xff))
+    function _getMainStorage() private pure returns (MainStorage storage $) {
+        assembly {
+            $.slot := 0x8965243858909cd150a4579caf77358c3bf8c5fec9d9436431b7b4e92824fa00
+        }
+    }
+}
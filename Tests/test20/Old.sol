@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+library LibDiamond {
+    /// @custom:storage-location diamond:diamond.standard.diamond.storage
+    struct DiamondStorage {
+        address contractOwner;
+        uint96 version;
+        bytes4[] selectors;
+    }
+
+    function diamondStorage() internal pure returns (DiamondStorage storage ds) {
+        bytes32 position = keccak256("diamond.standard.diamond.storage");
+        assembly {
+            ds.slot := position
+        }
+    }
+}
+
+contract Vault {
+    /// @custom:storage-location erc7201:example.vault.main
+    struct MainStorage {
+        uint256 totalAssets;
+        address asset;
+        bool paused;
+        uint64[] checkpoints;
+    }
+
+    /// @custom:storage-location erc7201:example.vault.fees
+    struct FeeStorage {
+        uint16 feeBps;
+        address recipient;
+    }
+
+    address public owner;
+    uint256 public counter;
+
+    // keccak256(abi.encode(uint256(keccak256("example.vault.main")) - 1)) & ~bytes32(uint256(0xff))
+    function _getMainStorage() private pure returns (MainStorage storage $) {
+        assembly {
+            $.slot := 0x759bc706db29959a8b5020bef2e82530d74b2d1169e95ce6eb268dd3abdd0b00
+        }
+    }
+}
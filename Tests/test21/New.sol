@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+// implementation behind an ERC1967 proxy, the proxy keeps its implementation and admin in the slots of EIP-1967 and
+// the Initializable of OpenZeppelin 5 keeps its flags at erc7201:openzeppelin.storage.Initializable
+contract TokenV2 {
+    uint256 public totalSupply;
+    string public name;
+    address public owner;
+    uint96 public fee;
+    mapping(address => uint256) public balances;
+}
@@ -0,0 +1,18 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+// paused is packed into the slot of owner, pendingOwner takes the first slot of the gap of OwnableV2. VaultV2 swaps
+// totalAssets and shares and adds fee, its gap shrinks by the slot of fee
+contract OwnableV2 {
+    address public owner;
+    bool public paused;
+    address public pendingOwner;
+    uint256[48] private __gap;
+}
+
+contract VaultV2 is OwnableV2 {
+    mapping(address => uint256) public shares;
+    uint256 public totalAssets;
+    uint256 public fee;
+    uint256[47] private __gap;
+}
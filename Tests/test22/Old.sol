@@ -0,0 +1,15 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+// upgradeable contracts in the style of OpenZeppelin, every contract reserves a __gap for the variables of its next
+// versions so the variables of the contracts that inherit from it keep their slots
+contract OwnableV1 {
+    address public owner;
+    uint256[49] private __gap;
+}
+
+contract VaultV1 is OwnableV1 {
+    uint256 public totalAssets;
+    mapping(address => uint256) public shares;
+    uint256[48] private __gap;
+}
@@ -0,0 +1,24 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+// the inheritance order of Ownable and Pausable is swapped and Fees is added between them, so the variables of
+// Pausable move to the front and the variables of Ownable and Token move behind the variables of Fees
+contract Ownable {
+    address private owner;
+    uint64 private nonce;
+}
+
+contract Pausable {
+    bool private paused;
+    uint256 private nonce;
+}
+
+contract Fees {
+    uint256 private nonce;
+    uint16 private feeRate;
+}
+
+contract Token is Pausable, Fees, Ownable {
+    uint256 public totalSupply;
+    mapping(address => uint256) public balances;
+}
@@ -0,0 +1,11 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+// the core of the exchange stays at the address of the exchange, the rewards move to the RewardsVault of Satellite.sol
+// at rewardsVault
+contract ExchangeCore {
+    address public owner;
+    address public rewardsVault;
+    mapping(address => uint256) public balances;
+    uint256 public totalVolume;
+}
@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+// monolithic exchange that keeps the balances of the traders and their rewards
+contract Exchange {
+    address public owner;
+    uint256 public totalVolume;
+    mapping(address => uint256) public balances;
+    mapping(address => uint256) public rewards;
+    uint64 public rewardRate;
+    uint64 public lastRewardTime;
+}
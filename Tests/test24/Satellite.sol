@@ -0,0 +1,10 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+// satellite of the exchange that keeps the rewards of the traders, its owner is copied from the exchange
+contract RewardsVault {
+    address public owner;
+    uint64 public rewardRate;
+    uint64 public lastRewardTime;
+    mapping(address => uint256) public rewards;
+}
@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+// the token and its registry in one contract, the owner of the token is kept and listedCount is packed next to it
+contract TokenWithRegistry {
+    address public owner;
+    uint64 public listedCount;
+    uint256 public totalSupply;
+    mapping(address => uint256) public balances;
+    address public registrar;
+    mapping(address => bool) public listed;
+}
@@ -0,0 +1,9 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+// token whose holders are listed by the Registry of Registry.sol at a separate address
+contract Token {
+    address public owner;
+    uint256 public totalSupply;
+    mapping(address => uint256) public balances;
+}
@@ -0,0 +1,10 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+// registry of the listed holders of the token, it is merged into the token
+contract Registry {
+    address public owner;
+    address public registrar;
+    mapping(address => bool) public listed;
+    uint64 public listedCount;
+}
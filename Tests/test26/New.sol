@@ -0,0 +1,17 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    uint256 price;
+    uint256 cap;
+    uint64 counter;
+
+    function compute() public {
+
+        // the price is computed from the old price, the cap has the same type and an initial value
+        price = 42;
+        cap = 1000;
+        counter = 7;
+    }
+}
@@ -0,0 +1,14 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    uint256 oldPrice;
+    uint64 counter;
+
+    function compute() public {
+
+        oldPrice = 21;
+        counter = 7;
+    }
+}
@@ -0,0 +1,19 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+// Pausable is removed from the bases and Fees is added, so the private nonce of Fees is a new variable and the nonce
+// of Pausable is dropped, although both have the same name
+contract Ownable {
+    address private owner;
+    uint64 private nonce;
+}
+
+contract Fees {
+    uint256 private nonce;
+    uint16 private feeRate;
+}
+
+contract Token is Fees, Ownable {
+    uint256 public totalSupply;
+    mapping(address => uint256) public balances;
+}
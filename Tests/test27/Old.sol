@@ -0,0 +1,18 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.20;
+
+// every base contract counts its own private nonce, the nonces have the same name but are different variables
+contract Ownable {
+    address private owner;
+    uint64 private nonce;
+}
+
+contract Pausable {
+    bool private paused;
+    uint256 private nonce;
+}
+
+contract Token is Ownable, Pausable {
+    uint256 public totalSupply;
+    mapping(address => uint256) public balances;
+}
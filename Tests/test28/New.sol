@@ -0,0 +1,13 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract Ledger{
+
+    // the balances stay in place, the description and the history are dropped with their data
+    mapping(address => uint256) balances;
+
+    function store() public {
+
+        balances[0x5B38Da6a701c568545dCfcB03FcB875f56beddC4] = 600;
+    }
+}
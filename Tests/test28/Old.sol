@@ -0,0 +1,17 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract Ledger{
+
+    mapping(address => uint256) balances;
+    string description;
+    uint256[] history;
+
+    function store() public {
+
+        balances[0x5B38Da6a701c568545dCfcB03FcB875f56beddC4] = 600;
+        description = "a description that is longer than thirty one bytes";
+        history.push(10);
+        history.push(20);
+    }
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    struct Config {
+        uint16 fee;
+        bool paused;
+        string note;
+    }
+
+    uint16 feeBps;
+    uint64 a;
+    address treasury;
+    uint256 b;
+    string name;
+    string description;
+    uint8[3] weights;
+    Config config;
+    int32 delta;
+
+    function compute() public {
+
+        a = 5;
+        b = 7;
+
+        // the new variables are initialized by the reorganization
+        feeBps = 30;
+        treasury = 0x5B38Da6a701c568545dCfcB03FcB875f56beddC4;
+        name = "Token";
+        description = "A token whose storage was reorganized with initial values for the new variables.";
+        weights = [1, 2, 3];
+        config = Config(25, true, "ok");
+        delta = -2;
+    }
+}
@@ -0,0 +1,14 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    uint64 a;
+    uint256 b;
+
+    function compute() public {
+
+        a = 5;
+        b = 7;
+    }
+}
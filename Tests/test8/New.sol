@@ -0,0 +1,25 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    enum Status { None, Inactive, Active }
+
+    uint256 price;
+    uint128 low;
+    uint128 high;
+    Status status;
+    uint32 counter;
+    string symbol;
+
+    function compute() public {
+
+        // the new values are computed by the transforms of the reorganization
+        price = 1500000000000000000; // 1.5 with 18 decimals
+        low = 9;
+        high = 3;
+        status = Status.Active;
+        counter = 42;
+        symbol = "TKN";
+    }
+}
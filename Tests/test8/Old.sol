@@ -0,0 +1,20 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    uint64 price;
+    uint256 packed;
+    bool active;
+    uint32 counter;
+    string symbol;
+
+    function compute() public {
+
+        price = 1500000; // 1.5 with 6 decimals
+        packed = (3 << 128) | 9;
+        active = true;
+        counter = 42;
+        symbol = "tkn";
+    }
+}
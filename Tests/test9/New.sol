@@ -0,0 +1,29 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    uint256 price;
+    uint128 low;
+    uint64 high;
+    bytes20 ownerBytes;
+    bytes24 tagged;
+    address admin;
+    string greeting;
+    int64 delta;
+    uint8 flags;
+
+    function compute() public {
+
+        // the new values are computed by the expressions of the reorganization
+        price = 1500000000000000000; // 1.5 with 18 decimals
+        low = 9;
+        high = 3;
+        ownerBytes = bytes20(0x5B38Da6a701c568545dCfcB03FcB875f56beddC4);
+        tagged = bytes24(abi.encodePacked(bytes4(0x12345678), ownerBytes));
+        admin = 0xAb8483F64d9C6d1EcF9b849Ae677dD3315835cb2;
+        greeting = "Hello World";
+        delta = -16;
+        flags = 0x89;
+    }
+}
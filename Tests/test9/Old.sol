@@ -0,0 +1,26 @@
+// SPDX-License-Identifier: GPL-3.0
+pragma solidity >=0.8.2 <0.9.0;
+
+contract MyContract{
+
+    uint64 price;
+    uint256 packed;
+    address owner;
+    bytes4 prefix;
+    uint160 ownerId;
+    string first;
+    string second;
+    int32 delta;
+
+    function compute() public {
+
+        price = 1500000; // 1.5 with 6 decimals
+        packed = (3 << 128) | 9;
+        owner = 0x5B38Da6a701c568545dCfcB03FcB875f56beddC4;
+        prefix = 0x12345678;
+        ownerId = uint160(0xAb8483F64d9C6d1EcF9b849Ae677dD3315835cb2);
+        first = "Hello";
+        second = " World";
+        delta = -5;
+    }
+}
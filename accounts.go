@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// struct that describes an account that receives a part of the storage of a contract that is split
+type SplitTarget struct {
+	Account common.Address `json:"account"`
+	Layout  string         `json:"layout"`  // file of the layout of the contract at the account
+	Storage string         `json:"storage"` // file of the expected storage of the account, used by the tests
+}
+
+// struct that holds the accounts of a split, the reorganized account keeps the variables of the new layout
+type SplitOptions struct {
+	Targets []SplitTarget `json:"targets"`
+}
+
+// struct that holds the layout of the contract at an account that receives a part of the storage of a split contract
+type AccountLayout struct {
+	Account common.Address
+	Layout  *StorageLayout
+}
+
+// struct that holds the gas estimate of the writes of a reorganization to one account
+type AccountGasEstimate struct {
+	Account      common.Address `json:"account"`
+	WrittenSlots uint64         `json:"writtenSlots"` // slots whose value is changed by the reorganization
+	ClearedSlots uint64         `json:"clearedSlots"` // old slots that are deleted by the commit
+	Gas          uint64         `json:"gas"`
+}
+
+// struct that holds the combined gas estimate of a reorganization that writes several accounts
+type ReorgGasEstimate struct {
+	ReadSlots uint64               `json:"readSlots"`
+	Accounts  []AccountGasEstimate `json:"accounts"`
+	Gas       uint64               `json:"gas"` // reading the old slots and writing all the accounts
+}
+
+// function to keep the options of a plan that refer to the variables of a layout. The initial values, transforms,
+// mapping keys and truncation policies are given by label for all the accounts of a split, the struct changes and the
+// field mappings only apply to the reorganized account
+func filterPlanOptions(options PlanOptions, layout *StorageLayout) PlanOptions {
+
+	filteredOptions := PlanOptions{
+		InitialValues:      make(map[string]json.RawMessage),
+		Transforms:         make(map[string]TransformSpec),
+		MappingKeys:        make(map[string]MappingKeys),
+		TruncationPolicies: make(map[string]string),
+	}
+
+	for label, initialValue := range options.InitialValues {
+
+		if _, found := layout.FindItem(label); found {
+
+			filteredOptions.InitialValues[label] = initialValue
+		}
+	}
+
+	for label, transform := range options.Transforms {
+
+		if _, found := layout.FindItem(label); found {
+
+			filteredOptions.Transforms[label] = transform
+		}
+	}
+
+	for label, keys := range options.MappingKeys {
+
+		if _, found := layout.FindItem(label); found {
+
+			filteredOptions.MappingKeys[label] = keys
+		}
+	}
+
+	for label, policy := range options.TruncationPolicies {
+
+		if _, found := layout.FindItem(label); found {
+
+			filteredOptions.TruncationPolicies[label] = policy
+		}
+	}
+
+	return filteredOptions
+}
+
+// function to add the data types of the plan of another account to the data types of a plan. A type that is used by
+// both plans must be reorganized the same way
+func mergeDataTypes(dataTypes, otherDataTypes []DataType, account common.Address) ([]DataType, error) {
+
+	indices := make(map[string]int)
+
+	for i, dataType := range dataTypes {
+
+		indices[dataType.Type] = i
+	}
+
+	for _, dataType := range otherDataTypes {
+
+		if i, found := indices[dataType.Type]; !found {
+
+			dataTypes = append(dataTypes, dataType)
+
+		} else if !isJSONEqual(dataTypes[i], dataType) {
+
+			return nil, errors.New("Type " + dataType.Type + " Is Reorganized Differently For Account " + account.Hex())
+		}
+	}
+
+	return dataTypes, nil
+}
+
+// generates the plan that splits the storage of a contract across several accounts. The variables of the new layout
+// stay in the reorganized account, the variables of the layouts of the targets are moved to their accounts, so the
+// reorganization messages of the targets name their account. A variable may be copied into several accounts, the old
+// variables that are not present in any of the layouts are dropped
+func GenerateSplitPlan(oldLayout, newLayout *StorageLayout, targets []AccountLayout, options PlanOptions) ([]ReorgInfo, []DataType, error) {
+
+	accountOptions := options
+
+	// the options of all the accounts are given together
+	if len(targets) != 0 {
+
+		accountOptions = filterPlanOptions(options, newLayout)
+		accountOptions.Structs = options.Structs
+		accountOptions.FieldMappings = options.FieldMappings
+	}
+
+	reorgInfos, dataTypes, err := GenerateReorgPlan(oldLayout, newLayout, accountOptions)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	for _, target := range targets {
+
+		targetReorgInfos, targetDataTypes, err := GenerateReorgPlan(oldLayout, target.Layout, filterPlanOptions(options, target.Layout))
+
+		if err != nil {
+
+			return nil, nil, errors.New("Account " + target.Account.Hex() + ": " + err.Error())
+		}
+
+		for i := range targetReorgInfos {
+
+			account := target.Account
+			targetReorgInfos[i].Account = &account
+		}
+
+		reorgInfos = append(reorgInfos, targetReorgInfos...)
+
+		if dataTypes, err = mergeDataTypes(dataTypes, targetDataTypes, target.Account); err != nil {
+
+			return nil, nil, err
+		}
+	}
+
+	return reorgInfos, dataTypes, nil
+}
+
+// function to get the account that a reorganization message writes, the reorganized account if it names no account
+func (s *StorageReorganizer) GetAccount(reorgMessage ReorgInfo) common.Address {
+
+	if reorgMessage.Account != nil {
+
+		return *reorgMessage.Account
+	}
+
+	return s.addr
+}
+
+// returns the accounts written by the reorganization, sorted by their addresses
+func (s *StorageReorganizer) GetWrittenAccounts() []common.Address {
+
+	accounts := make([]common.Address, 0, len(s.modifiedStorage))
+
+	for account := range s.modifiedStorage {
+
+		accounts = append(accounts, account)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return bytes.Compare(accounts[i][:], accounts[j][:]) < 0 })
+
+	return accounts
+}
+
+// function to check that the other accounts written by the reorganization are empty. The commit only writes the
+// reorganized slots into them, so existing data would be mixed with the reorganized data. Since the accounts are
+// checked before the commit, the commit writes either all the accounts or none of them
+func (s *StorageReorganizer) checkTargetAccounts() error {
+
+	for _, account := range s.GetWrittenAccounts() {
+
+		if account == s.addr {
+
+			continue
+		}
+
+		for key, value := range s.state.GetStorageAsMap(account) {
+
+			if value != (common.Hash{}) {
+
+				return errors.New("Target Account " + account.Hex() + " Already Holds Storage At Slot " + key.Hex())
+			}
+		}
+	}
+
+	return nil
+}
+
+// returns the combined gas estimate of the commit of a reorganization, it must be called before the commit. The read
+// slots are loaded once, every changed slot is written and the old slots that are not reused are cleared, as well as
+// the slots of the sources of a merge if they are cleared. Refunds for cleared slots and the costs of the transaction
+// are not included
+func (s *StorageReorganizer) EstimateGas() ReorgGasEstimate {
+
+	estimate := ReorgGasEstimate{ReadSlots: uint64(len(s.readKeys))}
+
+	for _, keys := range s.sourceReadKeys {
+
+		estimate.ReadSlots += uint64(len(keys))
+	}
+
+	estimate.Gas = estimate.ReadSlots * GasColdSload
+
+	accounts := s.GetWrittenAccounts()
+
+	if _, found := s.modifiedStorage[s.addr]; !found && len(s.commitedStorage) != 0 {
+
+		accounts = append([]common.Address{s.addr}, accounts...)
+	}
+
+	for _, account := range accounts {
+
+		accountEstimate := AccountGasEstimate{Account: account}
+
+		for key, value := range s.modifiedStorage[account] {
+
+			oldValue := s.state.GetState(account, key)
+
+			if account == s.addr {
+
+				oldValue = s.commitedStorage[key]
+			}
+
+			if value == oldValue {
+
+				continue
+			}
+
+			if account != s.addr || !s.readKeys[key] {
+
+				accountEstimate.Gas += GasColdSload
+			}
+
+			if oldValue != (common.Hash{}) {
+
+				accountEstimate.Gas += GasSstoreReset
+
+			} else if value != (common.Hash{}) {
+
+				accountEstimate.Gas += GasSstoreSet
+			}
+
+			accountEstimate.WrittenSlots++
+		}
+
+		if account == s.addr {
+
+			for key, value := range s.commitedStorage {
+
+				// slots of the modified storage are charged as written, also if they are set to zero
+				if _, written := s.modifiedStorage[account][key]; written || value == (common.Hash{}) || s.IsProtected(key) || s.isKeptSlot(key) {
+
+					continue
+				}
+
+				if !s.readKeys[key] {
+
+					accountEstimate.Gas += GasColdSload
+				}
+
+				accountEstimate.Gas += GasSstoreReset
+				accountEstimate.ClearedSlots++
+			}
+		}
+
+		estimate.Accounts = append(estimate.Accounts, accountEstimate)
+		estimate.Gas += accountEstimate.Gas
+	}
+
+	if !s.clearSources {
+
+		return estimate
+	}
+
+	for _, account := range s.GetSourceAccounts() {
+
+		accountEstimate := AccountGasEstimate{Account: account}
+
+		for key, value := range s.state.GetStorageAsMap(account) {
+
+			if value == (common.Hash{}) {
+
+				continue
+			}
+
+			if !s.sourceReadKeys[account][key] {
+
+				accountEstimate.Gas += GasColdSload
+			}
+
+			accountEstimate.Gas += GasSstoreReset
+			accountEstimate.ClearedSlots++
+		}
+
+		estimate.Accounts = append(estimate.Accounts, accountEstimate)
+		estimate.Gas += accountEstimate.Gas
+	}
+
+	return estimate
+}
+
+// function to read the split of a test, nil if the test does not split the storage. It returns the layouts and the
+// expected storage of the targets
+func readSplitTargets(directoryPath string) ([]AccountLayout, map[common.Address]*map[common.Hash]StorageSlot, error) {
+
+	if _, err := os.Stat(directoryPath + "/" + "split.json"); err != nil {
+
+		return nil, nil, nil
+	}
+
+	var options SplitOptions
+
+	if err := readJSONFile(directoryPath+"/"+"split.json", &options); err != nil {
+
+		return nil, nil, err
+	}
+
+	targets := make([]AccountLayout, 0, len(options.Targets))
+	storages := make(map[common.Address]*map[common.Hash]StorageSlot)
+
+	for _, target := range options.Targets {
+
+		if target.Account == (common.Address{}) {
+
+			return nil, nil, errors.New("The Reorganized Account Can Not Be A Target Of A Split")
+		}
+
+		layout, err := ReadStorageLayoutFromFile(directoryPath + "/" + target.Layout)
+
+		if err != nil {
+
+			return nil, nil, err
+		}
+
+		targets = append(targets, AccountLayout{Account: target.Account, Layout: layout})
+
+		if target.Storage != "" {
+
+			if storages[target.Account], err = ReadStorageFromFile(directoryPath + "/" + target.Storage); err != nil {
+
+				return nil, nil, err
+			}
+		}
+	}
+
+	return targets, storages, nil
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// policies for the elements that are dropped when an array shrinks
+	TruncateFail   = "fail"   // the reorganization fails if a dropped element is not zero
+	TruncateExport = "export" // the dropped elements are decoded and exported before they are deleted
+)
+
+// function to check if the length of a fixed size array changed while its base type stayed the same, e.g. uint64[4] to uint64[6]
+func IsFixedArrayResize(oldTypeName, newTypeName string, oldTypes, newTypes map[string]TypeDescription) bool {
+
+	oldType, found := oldTypes[oldTypeName]
+
+	if !found {
+
+		return false
+	}
+
+	newType, found := newTypes[newTypeName]
+
+	if !found || oldType.Encoding != "inplace" || newType.Encoding != "inplace" || oldType.Base == "" || newType.Base == "" {
+
+		return false
+	}
+
+	oldLength, err := GetArrayLength(oldType.Label)
+
+	if err != nil {
+
+		return false
+	}
+
+	newLength, err := GetArrayLength(newType.Label)
+
+	if err != nil {
+
+		return false
+	}
+
+	return oldLength != newLength && IsTypeEqual(oldType.Base, newType.Base, oldTypes, newTypes)
+}
+
+// function to check if a fixed size array was converted into a dynamic array or back while its base type stayed the same,
+// e.g. address[10] to address[]
+func IsArrayKindConversion(oldTypeName, newTypeName string, oldTypes, newTypes map[string]TypeDescription) bool {
+
+	oldType, found := oldTypes[oldTypeName]
+
+	if !found {
+
+		return false
+	}
+
+	newType, found := newTypes[newTypeName]
+
+	if !found || oldType.Base == "" || newType.Base == "" {
+
+		return false
+	}
+
+	isFixedToDynamic := oldType.Encoding == "inplace" && newType.Encoding == "dynamic_array"
+	isDynamicToFixed := oldType.Encoding == "dynamic_array" && newType.Encoding == "inplace"
+
+	return (isFixedToDynamic || isDynamicToFixed) && IsTypeEqual(oldType.Base, newType.Base, oldTypes, newTypes)
+}
+
+// function to add the truncation policies of the arrays that shrink or are converted into fixed size arrays to the reorganization messages
+func AddTruncationPolicies(reorgInfos []ReorgInfo, oldLayout, newLayout *StorageLayout, policies map[string]string) error {
+
+	for label, policy := range policies {
+
+		if policy != TruncateFail && policy != TruncateExport {
+
+			return errors.New("Invalid Truncation Policy " + policy + " Of " + label)
+		}
+
+		found := false
+
+		for i := range reorgInfos {
+
+			if reorgInfos[i].Label != label || reorgInfos[i].IsComputed() || reorgInfos[i].NewType == "" {
+
+				continue
+			}
+
+			if !IsFixedArrayResize(reorgInfos[i].Type, reorgInfos[i].NewType, oldLayout.Types, newLayout.Types) && !IsArrayKindConversion(reorgInfos[i].Type, reorgInfos[i].NewType, oldLayout.Types, newLayout.Types) {
+
+				continue
+			}
+
+			reorgInfos[i].Truncate = policy
+			found = true
+		}
+
+		if !found {
+
+			return errors.New("Truncation Policy Given For Variable That Is Not A Resized Array " + label)
+		}
+	}
+
+	return nil
+}
+
+// function to check if a reorganization message changes the length of an array or converts a fixed size array into
+// a dynamic array or back
+func (s *StorageReorganizer) IsArrayResize(reorgMessage ReorgInfo) (bool, error) {
+
+	if reorgMessage.NewType == "" {
+
+		return false, nil
+	}
+
+	dataType, found := s.dataTypes[reorgMessage.Type]
+
+	if !found {
+
+		return false, errors.New("Type not found " + reorgMessage.Type)
+	}
+
+	newDataType, found := s.dataTypes[reorgMessage.NewType]
+
+	if !found {
+
+		return false, errors.New("Type not found " + reorgMessage.NewType)
+	}
+
+	isArray := func(dataType DataType) bool {
+
+		return dataType.Base != "" && (dataType.Encoding == "inplace" || dataType.Encoding == "dynamic_array")
+	}
+
+	return isArray(dataType) && isArray(newDataType) && newDataType.Base == dataType.Base, nil
+}
+
+// Reorganizes a single element of an array according to the encoding of its type
+func (s *StorageReorganizer) ReorganizeElement(elementMessage ReorgInfo) error {
+
+	if isInplace, err := s.IsEncodingInplace(elementMessage.Type); err != nil {
+
+		return err
+
+	} else if isInplace {
+
+		return s.ReorganizeInplace(elementMessage)
+
+	} else if isDynamicArray, err := s.IsEncodingDynamicArray(elementMessage.Type); err != nil {
+
+		return err
+
+	} else if isDynamicArray {
+
+		return s.ReorganizeDynamicArray(elementMessage)
+
+	} else if isBytes, err := s.IsEncodingBytes(elementMessage.Type); err != nil {
+
+		return err
+
+	} else if isBytes {
+
+		return s.ReorganizeBytes(elementMessage)
+
+	} else if dataType := s.dataTypes[elementMessage.Type]; dataType.Encoding == EncodingVyperDynArray || dataType.Encoding == EncodingVyperBytes {
+
+		return s.ReorganizeVyper(elementMessage)
+	}
+
+	return errors.New("Arrays Of Mappings Can Not Be Reorganized")
+}
+
+// function to get the length of an array and the slot where its elements start. Fixed size arrays store their
+// elements at the slot of the array, dynamic arrays store their length there and the elements at keccak256(slot)
+func (s *StorageReorganizer) getArrayLayout(dataType DataType, slot common.Hash, isNew bool) (uint64, *big.Int, error) {
+
+	if dataType.Encoding == "inplace" {
+
+		length, err := GetArrayLength(dataType.Label)
+
+		return length, slot.Big(), err
+	}
+
+	dataSlot := new(big.Int).SetBytes(crypto.Keccak256(slot[:]))
+
+	// the length of the new dynamic array is written by the reorganization
+	if isNew {
+
+		return 0, dataSlot, nil
+	}
+
+	length := s.GetCommitedState(slot).Big()
+
+	if !length.IsUint64() || length.Uint64() > 1<<24 {
+
+		return 0, nil, errors.New("Invalid Dynamic Array Length At Slot " + slot.Hex())
+	}
+
+	return length.Uint64(), dataSlot, nil
+}
+
+// Reorganizes an array whose length changed or which was converted from a fixed size array into a dynamic array or back.
+// The elements that are present in both arrays are moved one by one, the new elements of a fixed size array stay zero.
+// The elements that do not fit into the new array must be zero, unless the truncation policy exports them
+func (s *StorageReorganizer) ReorganizeArrayResize(reorgMessage ReorgInfo) error {
+
+	dataType := s.dataTypes[reorgMessage.Type]
+	newDataType := s.dataTypes[reorgMessage.NewType]
+
+	prevLength, prevDataSlot, err := s.getArrayLayout(dataType, reorgMessage.PrevSlot, false)
+
+	if err != nil {
+
+		return err
+	}
+
+	newLength, newDataSlot, err := s.getArrayLayout(newDataType, reorgMessage.NewSlot, true)
+
+	if err != nil {
+
+		return err
+	}
+
+	// a dynamic array keeps all the elements of the old array
+	if newDataType.Encoding == "dynamic_array" {
+
+		newLength = prevLength
+
+		if err := s.writeModifiedWord(reorgMessage.NewSlot, common.BigToHash(new(big.Int).SetUint64(newLength))); err != nil {
+
+			return err
+		}
+	}
+
+	prevElementSize, newElementSize, err := s.GetNumberOfBytes(dataType.Base)
+
+	if err != nil {
+
+		return err
+	}
+
+	for i := uint64(0); i < prevLength; i++ {
+
+		prevSlotIndex, prevOffset := GetElementPosition(prevElementSize, i)
+		prevSlot := new(big.Int).Add(prevDataSlot, new(big.Int).SetUint64(prevSlotIndex))
+
+		if i >= newLength {
+
+			if err := s.truncateElement(reorgMessage, dataType.Base, i, prevSlot, prevOffset); err != nil {
+
+				return err
+			}
+
+			continue
+		}
+
+		newSlotIndex, newOffset := GetElementPosition(newElementSize, i)
+
+		err := s.ReorganizeElement(ReorgInfo{
+			Label:      fmt.Sprintf("%s[%d]", reorgMessage.Label, i),
+			Type:       dataType.Base,
+			PrevSlot:   common.BigToHash(prevSlot),
+			NewSlot:    common.BigToHash(new(big.Int).Add(newDataSlot, new(big.Int).SetUint64(newSlotIndex))),
+			PrevOffset: prevOffset,
+			NewOffset:  newOffset,
+		})
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// function to handle an element that is dropped from a shrinking fixed size array according to the truncation policy
+func (s *StorageReorganizer) truncateElement(reorgMessage ReorgInfo, baseTypeName string, i uint64, slot *big.Int, offset uint64) error {
+
+	value, err := s.DecodeValue(baseTypeName, slot, offset)
+
+	if err != nil {
+
+		return err
+	}
+
+	label := fmt.Sprintf("%s[%d]", reorgMessage.Label, i)
+
+	if reorgMessage.Truncate == TruncateExport {
+
+		s.exportedValues[label] = value
+		return nil
+	}
+
+	if !IsZeroValue(value) {
+
+		return errors.New("Element " + label + " Is Dropped From The New Array But Is Not Zero")
+	}
+
+	return nil
+}
+
+// function to get the values that were exported during the reorganization, keyed by the label of the element
+func (s *StorageReorganizer) GetExportedValues() map[string]interface{} {
+
+	return s.exportedValues
+}
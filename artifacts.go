@@ -0,0 +1,419 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// the ids of structs, enums, contracts and user defined value types contain the ast id of their definition, which
+// changes whenever the source changes
+var structIdPattern = regexp.MustCompile(`t_struct\((.*?)\)[a-zA-Z0-9]+_storage`)
+var definitionIdPattern = regexp.MustCompile(`t_(enum|contract|userDefinedValueType)\((.*?)\)[0-9]+`)
+
+// struct to represent the contracts of the output of solc --standard-json, grouped by source file
+type compilerOutput struct {
+	Contracts map[string]map[string]struct {
+		StorageLayout *StorageLayout `json:"storageLayout"`
+	} `json:"contracts"`
+}
+
+// struct to represent a Hardhat build info file, which holds the input and the output of solc --standard-json
+type buildInfo struct {
+	Input struct {
+		Sources map[string]struct {
+			Content string `json:"content"`
+		} `json:"sources"`
+	} `json:"input"`
+	Output compilerOutput `json:"output"`
+}
+
+// struct that holds the build artifacts of a test and the contracts selected from them, see checkArtifacts
+type ArtifactSpec struct {
+	OldArtifact string `json:"oldArtifact"`
+	OldContract string `json:"oldContract"`
+	OldSource   string `json:"oldSource,omitempty"` // source of the enum members and underlying types if the artifact has no sources
+	NewArtifact string `json:"newArtifact"`
+	NewContract string `json:"newContract"`
+	NewSource   string `json:"newSource,omitempty"`
+}
+
+// function to remove the ast ids from a type id, e.g. t_struct(Position)12_storage becomes t_struct(Position)_storage
+func NormalizeTypeId(typeId string) string {
+
+	typeId = structIdPattern.ReplaceAllString(typeId, "t_struct(${1})_storage")
+	return definitionIdPattern.ReplaceAllString(typeId, "t_${1}(${2})")
+}
+
+// function to remove the ast ids from the type ids of a layout, like clean_types of the off-chain code analyzer
+func NormalizeStorageLayout(layout *StorageLayout) {
+
+	for i := range layout.Storage {
+
+		layout.Storage[i].Type = NormalizeTypeId(layout.Storage[i].Type)
+	}
+
+	types := make(map[string]TypeDescription)
+
+	for typeId, typeDescription := range layout.Types {
+
+		typeDescription.Base = NormalizeTypeId(typeDescription.Base)
+		typeDescription.Key = NormalizeTypeId(typeDescription.Key)
+		typeDescription.Value = NormalizeTypeId(typeDescription.Value)
+
+		for i := range typeDescription.Members {
+
+			typeDescription.Members[i].Type = NormalizeTypeId(typeDescription.Members[i].Type)
+		}
+
+		types[NormalizeTypeId(typeId)] = typeDescription
+	}
+
+	layout.Types = types
+}
+
+// adds the names of the enum members and the underlying types of user defined value types, which solc does not include
+// in the layout, from the declarations of the sources
+func AddSourceDefinitions(layout *StorageLayout, declarations []*SourceDeclarations) {
+
+	enums := make(map[string][]string)
+	valueTypes := make(map[string]string)
+
+	for _, source := range declarations {
+
+		enumDeclarations := append([]EnumDeclaration{}, source.Enums...)
+		valueTypeDeclarations := append([]ValueTypeDeclaration{}, source.ValueTypes...)
+
+		for _, contract := range source.Contracts {
+
+			enumDeclarations = append(enumDeclarations, contract.Enums...)
+			valueTypeDeclarations = append(valueTypeDeclarations, contract.ValueTypes...)
+		}
+
+		for _, enumDeclaration := range enumDeclarations {
+
+			enums[enumDeclaration.Name] = enumDeclaration.Members
+		}
+
+		for _, valueTypeDeclaration := range valueTypeDeclarations {
+
+			valueTypes[valueTypeDeclaration.Name] = valueTypeDeclaration.Type
+		}
+	}
+
+	for typeId, typeDescription := range layout.Types {
+
+		name := typeDescription.Label[strings.LastIndex(typeDescription.Label, ".")+1:]
+
+		if strings.HasPrefix(typeDescription.Label, "enum ") && enums[name] != nil {
+
+			typeDescription.EnumMembers = enums[name]
+
+		} else if strings.HasPrefix(typeId, "t_userDefinedValueType") && valueTypes[name] != "" {
+
+			typeDescription.UnderlyingType = valueTypes[name]
+		}
+
+		layout.Types[typeId] = typeDescription
+	}
+}
+
+// function to select a contract from the output of solc by its fully qualified name, e.g. contracts/Token.sol:Token.
+// A contract name without a source path selects the contract if no other source has a contract with the same name
+func selectContract(output compilerOutput, contractName string) (*StorageLayout, string, error) {
+
+	sourcePath := ""
+
+	if separator := strings.LastIndex(contractName, ":"); separator != -1 {
+
+		sourcePath, contractName = contractName[:separator], contractName[separator+1:]
+	}
+
+	matches := make([]string, 0)
+
+	for path, contracts := range output.Contracts {
+
+		if _, found := contracts[contractName]; found && (sourcePath == "" || path == sourcePath) {
+
+			matches = append(matches, path)
+		}
+	}
+
+	if len(matches) == 0 {
+
+		return nil, "", errors.New("Contract Not Found In Artifact " + contractName)
+	}
+
+	if len(matches) > 1 {
+
+		sort.Strings(matches)
+		return nil, "", errors.New("Ambiguous Contract Name " + contractName + ", Use One Of " + strings.Join(matches, ", ") + " As Source Path")
+	}
+
+	layout := output.Contracts[matches[0]][contractName].StorageLayout
+
+	if layout == nil {
+
+		return nil, "", errors.New("Artifact Has No Storage Layout For " + matches[0] + ":" + contractName + ", Add storageLayout To The Output Selection")
+	}
+
+	return layout, matches[0], nil
+}
+
+// reads the storage layout of a contract from a build artifact and normalizes its type ids. Supported are storage
+// layouts generated by solc --storage-layout or forge inspect <contract> storage-layout --json, Foundry artifacts,
+// Hardhat build info files, the output of solc --standard-json and the output of vyper -f layout. The contract is
+// selected by its fully qualified name in artifacts with several contracts
+func LoadStorageLayout(filePath, contractName string) (*StorageLayout, error) {
+
+	byteVal, err := ioutil.ReadFile(filePath)
+
+	if err != nil {
+		fmt.Println(red + err.Error() + reset)
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(byteVal, &fields); err != nil {
+
+		return nil, err
+	}
+
+	var layout *StorageLayout
+	var namespaceDeclarations *SourceDeclarations
+	declarations := make([]*SourceDeclarations, 0)
+
+	if fields["storage"] != nil {
+
+		// a storage layout generated by solc --storage-layout or forge inspect
+		if err := json.Unmarshal(byteVal, &layout); err != nil {
+
+			return nil, err
+		}
+
+	} else if fields["storageLayout"] != nil {
+
+		// a Foundry artifact compiled with extra_output = ["storageLayout"]
+		if err := json.Unmarshal(fields["storageLayout"], &layout); err != nil {
+
+			return nil, err
+		}
+
+	} else if fields["output"] != nil {
+
+		var info buildInfo
+		var selectedPath string
+
+		if err := json.Unmarshal(byteVal, &info); err != nil {
+
+			return nil, err
+		}
+
+		if layout, selectedPath, err = selectContract(info.Output, contractName); err != nil {
+
+			return nil, err
+		}
+
+		// the build info holds the sources, so the definitions solc does not include can be added. The definitions of
+		// the source of the selected contract are added last, so they replace definitions with the same name
+		paths := make([]string, 0, len(info.Input.Sources))
+
+		for path := range info.Input.Sources {
+
+			if path != selectedPath {
+
+				paths = append(paths, path)
+			}
+		}
+
+		sort.Strings(paths)
+
+		for _, path := range append(paths, selectedPath) {
+
+			sourceDeclarations, err := ParseDeclarations(info.Input.Sources[path].Content, path)
+
+			if err != nil {
+
+				return nil, errors.New("Invalid Source " + path + ": " + err.Error())
+			}
+
+			declarations = append(declarations, sourceDeclarations)
+		}
+
+		namespaceDeclarations = mergeDeclarations(declarations, selectedPath)
+
+	} else if fields["storage_layout"] != nil {
+
+		// the output of vyper -f layout, whose structs, flags and interfaces can only be resolved with the source
+		return ImportVyperLayout(byteVal, nil)
+
+	} else if fields["contracts"] != nil {
+
+		var output compilerOutput
+
+		if err := json.Unmarshal(byteVal, &output); err != nil {
+
+			return nil, err
+		}
+
+		if layout, _, err = selectContract(output, contractName); err != nil {
+
+			return nil, err
+		}
+
+	} else {
+
+		return nil, errors.New("Unknown Artifact Format " + filePath)
+	}
+
+	if layout == nil {
+
+		return nil, errors.New("Artifact Has No Storage Layout " + filePath)
+	}
+
+	if layout.Types == nil {
+
+		layout.Types = make(map[string]TypeDescription)
+	}
+
+	NormalizeStorageLayout(layout)
+	AddSourceDefinitions(layout, declarations)
+
+	if namespaceDeclarations != nil {
+
+		if err := AddNamespacedStorage(layout, namespaceDeclarations, contractName); err != nil {
+
+			return nil, err
+		}
+	}
+
+	return layout, nil
+}
+
+// reads the storage layout of a contract from a build artifact and adds the definitions and the namespaced structs of
+// the given Solidity source.
+// The layout of a Vyper contract is converted with the definitions of its Vyper source
+func loadStorageLayoutWithSource(artifactPath, contractName, sourcePath string) (*StorageLayout, error) {
+
+	if strings.HasSuffix(sourcePath, ".vy") {
+
+		return ReadVyperLayoutFromFile(artifactPath, sourcePath)
+	}
+
+	layout, err := LoadStorageLayout(artifactPath, contractName)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	if sourcePath != "" {
+
+		declarations, err := ReadDeclarationsFromFile(sourcePath)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		AddSourceDefinitions(layout, []*SourceDeclarations{declarations})
+
+		if err := AddNamespacedStorage(layout, declarations, contractName); err != nil {
+
+			return nil, err
+		}
+	}
+
+	return layout, nil
+}
+
+// generates the plan between two contracts read from build artifacts and writes the normalized layouts and the plan to
+// the output directory. The options of the plan are read from the options directory
+func runPlan(oldArtifactPath, newArtifactPath, contractName, outputDirectory, optionsDirectory string) error {
+
+	oldLayout, err := LoadStorageLayout(oldArtifactPath, contractName)
+
+	if err != nil {
+
+		return err
+	}
+
+	newLayout, err := LoadStorageLayout(newArtifactPath, contractName)
+
+	if err != nil {
+
+		return err
+	}
+
+	// without the sources the members of enums are unknown, so their values can not be translated
+	for _, layout := range []*StorageLayout{oldLayout, newLayout} {
+
+		for _, typeDescription := range layout.Types {
+
+			if strings.HasPrefix(typeDescription.Label, "enum ") && len(typeDescription.EnumMembers) == 0 {
+
+				fmt.Println(yellow + "The members of " + typeDescription.Label + " are unknown, the artifact does not include the sources" + reset)
+			}
+		}
+	}
+
+	var reorgInfos []ReorgInfo
+	var dataTypes []DataType
+
+	if optionsDirectory != "" {
+
+		options, err := ReadPlanOptionsFromDirectory(optionsDirectory)
+
+		if err != nil {
+
+			return err
+		}
+
+		// the options directory may split the storage across several accounts or merge several accounts
+		if reorgInfos, dataTypes, err = generateDirectoryPlan(optionsDirectory, oldLayout, newLayout, options); err != nil {
+
+			return err
+		}
+
+	} else if reorgInfos, dataTypes, err = GenerateReorgPlan(oldLayout, newLayout, PlanOptions{}); err != nil {
+
+		return err
+	}
+
+	outputs := map[string]interface{}{
+		"old_layout.json":         oldLayout,
+		"new_layout.json":         newLayout,
+		"storage_reorg_info.json": reorgInfos,
+		"data_types.json":         dataTypes,
+	}
+
+	for name, value := range outputs {
+
+		data, err := json.MarshalIndent(value, "", "  ")
+
+		if err != nil {
+
+			return err
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(outputDirectory, name), data, 0644); err != nil {
+
+			return err
+		}
+	}
+
+	fmt.Println(green + fmt.Sprintf("Plan with %d reorganization messages written to %s", len(reorgInfos), outputDirectory) + reset)
+
+	for _, baseMove := range GetBaseMoves(reorgInfos) {
+
+		fmt.Println(white + "  " + baseMove.String() + reset)
+	}
+
+	return nil
+}
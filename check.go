@@ -0,0 +1,590 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+const (
+	// statuses reported by the upgrade safety checker
+	CheckInplace    = "inplace"
+	CheckMove       = "move"
+	CheckAdded      = "added"
+	CheckDeleted    = "deleted"
+	CheckTypeChange = "type_change"
+	CheckGap        = "gap"
+	CheckResize     = "resize"
+)
+
+// struct that holds the result of checking a single storage object
+type CheckResult struct {
+	Label   string `json:"label"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Unsafe  bool   `json:"unsafe"`
+}
+
+// function to check if a storage object is a storage gap reserved for future variables
+func IsStorageGap(item StorageItem, types map[string]TypeDescription) bool {
+
+	if !strings.HasPrefix(item.Label, "__gap") {
+
+		return false
+	}
+
+	typeDescription, found := types[item.Type]
+
+	return found && typeDescription.Encoding == "inplace" && typeDescription.Base != ""
+}
+
+// function to describe what kind of data type a type is
+func GetTypeKind(typeName string, types map[string]TypeDescription) string {
+
+	typeDescription, found := types[typeName]
+
+	if !found {
+
+		return "unknown"
+	}
+
+	if len(typeDescription.Members) != 0 {
+
+		return "struct"
+	}
+
+	switch typeDescription.Encoding {
+
+	case "mapping", EncodingVyperHashMap:
+		return "mapping"
+	case "dynamic_array", EncodingVyperDynArray:
+		return "dynamic array"
+	case "bytes", EncodingVyperBytes:
+		return "bytes"
+	}
+
+	if typeDescription.Base != "" {
+
+		return "fixed array"
+	}
+
+	return "scalar"
+}
+
+// function to get the first slot after a storage object
+func getEndSlot(item StorageItem, types map[string]TypeDescription) (*big.Int, error) {
+
+	slot, err := SlotToHash(item.Slot)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	typeDescription, found := types[item.Type]
+
+	if !found {
+
+		return nil, errors.New("Type not found " + item.Type)
+	}
+
+	numberOfBytes, ok := new(big.Int).SetString(typeDescription.NumberOfBytes, 10)
+
+	if !ok {
+
+		return nil, errors.New("Invalid Number Of Bytes For Type " + item.Type)
+	}
+
+	numberOfSlots := new(big.Int).Div(new(big.Int).Add(numberOfBytes, big.NewInt(31)), big.NewInt(32))
+
+	return new(big.Int).Add(slot.Big(), numberOfSlots), nil
+}
+
+// function to check a storage gap that is present in both layouts. A gap may only shrink by
+// the number of slots taken by the variables inserted before it, so its end slot must not move
+func checkStorageGap(oldItem, newItem StorageItem, oldLayout, newLayout *StorageLayout) (CheckResult, error) {
+
+	oldEnd, err := getEndSlot(oldItem, oldLayout.Types)
+
+	if err != nil {
+
+		return CheckResult{}, err
+	}
+
+	newEnd, err := getEndSlot(newItem, newLayout.Types)
+
+	if err != nil {
+
+		return CheckResult{}, err
+	}
+
+	oldLabel := oldLayout.Types[oldItem.Type].Label
+	newLabel := newLayout.Types[newItem.Type].Label
+
+	if oldEnd.Cmp(newEnd) != 0 {
+
+		return CheckResult{
+			Label:   oldItem.Label,
+			Status:  CheckGap,
+			Message: fmt.Sprintf("gap changed from %s at slot %s to %s at slot %s and now ends at slot %s instead of %s", oldLabel, oldItem.Slot, newLabel, newItem.Slot, newEnd, oldEnd),
+			Unsafe:  true,
+		}, nil
+	}
+
+	return CheckResult{
+		Label:   oldItem.Label,
+		Status:  CheckGap,
+		Message: fmt.Sprintf("gap changed from %s to %s and still ends at slot %s", oldLabel, newLabel, newEnd),
+	}, nil
+}
+
+// function to find the enums inside a data type whose members were reordered, inserted or removed. It returns the
+// labels of the changed enums and whether members were removed
+func getEnumChanges(typeName string, oldTypes, newTypes map[string]TypeDescription) ([]string, bool) {
+
+	oldType := oldTypes[typeName]
+	newType := newTypes[typeName]
+
+	if mapping := GetEnumMapping(oldType.EnumMembers, newType.EnumMembers); mapping != nil {
+
+		removed := false
+
+		for _, newValue := range mapping {
+
+			removed = removed || newValue < 0
+		}
+
+		return []string{oldType.Label}, removed
+	}
+
+	labels := make([]string, 0)
+	seen := make(map[string]bool)
+	removed := false
+	typeNames := []string{oldType.Base, oldType.Key, oldType.Value}
+
+	for _, member := range oldType.Members {
+
+		typeNames = append(typeNames, member.Type)
+	}
+
+	for _, name := range typeNames {
+
+		if name == "" {
+
+			continue
+		}
+
+		innerLabels, innerRemoved := getEnumChanges(name, oldTypes, newTypes)
+
+		for _, label := range innerLabels {
+
+			if !seen[label] {
+
+				seen[label] = true
+				labels = append(labels, label)
+			}
+		}
+
+		removed = removed || innerRemoved
+	}
+
+	return labels, removed
+}
+
+// function to find the members that were added to or removed from the structs inside a data type. The members are
+// labeled with the name of their struct e.g. MyContract.Person.email
+func getStructChanges(typeName string, oldTypes, newTypes map[string]TypeDescription) ([]string, []string) {
+
+	oldType := oldTypes[typeName]
+	newType := newTypes[typeName]
+
+	added := make([]string, 0)
+	removed := make([]string, 0)
+	typeNames := []string{oldType.Base, oldType.Key, oldType.Value}
+	structName := strings.TrimPrefix(oldType.Label, "struct ")
+
+	for _, member := range oldType.Members {
+
+		if newMember, isCommon := findCommonMember(member, newType.Members, oldTypes, newTypes); isCommon {
+
+			typeNames = append(typeNames, newMember.Type)
+
+		} else {
+
+			removed = append(removed, structName+"."+member.Label)
+		}
+	}
+
+	for _, member := range newType.Members {
+
+		if _, isCommon := findCommonMember(member, oldType.Members, newTypes, oldTypes); !isCommon {
+
+			added = append(added, structName+"."+member.Label)
+		}
+	}
+
+	seen := make(map[string]bool)
+
+	for _, label := range append(append([]string{}, added...), removed...) {
+
+		seen[label] = true
+	}
+
+	for _, name := range typeNames {
+
+		if name == "" {
+
+			continue
+		}
+
+		innerAdded, innerRemoved := getStructChanges(name, oldTypes, newTypes)
+
+		for _, label := range innerAdded {
+
+			if !seen[label] {
+
+				seen[label] = true
+				added = append(added, label)
+			}
+		}
+
+		for _, label := range innerRemoved {
+
+			if !seen[label] {
+
+				seen[label] = true
+				removed = append(removed, label)
+			}
+		}
+	}
+
+	return added, removed
+}
+
+// compares two storage layouts and reports for every storage object if it can stay in place, needs to be moved,
+// has an unsupported type change, was deleted or was added
+func CheckLayouts(oldLayout, newLayout *StorageLayout) ([]CheckResult, error) {
+
+	results := make([]CheckResult, 0)
+	pairs := PairStorageItems(oldLayout, newLayout)
+	pairedNewItems := make(map[int]bool)
+
+	for i, oldItem := range oldLayout.Storage {
+
+		j, found := pairs[i]
+
+		if !found {
+
+			results = append(results, CheckResult{
+				Label:   oldItem.Label,
+				Status:  CheckDeleted,
+				Message: "deleted, the data stored at slot " + oldItem.Slot + " will be lost",
+				Unsafe:  true,
+			})
+
+			continue
+		}
+
+		newItem := newLayout.Storage[j]
+		pairedNewItems[j] = true
+
+		if IsStorageGap(oldItem, oldLayout.Types) && IsStorageGap(newItem, newLayout.Types) {
+
+			result, err := checkStorageGap(oldItem, newItem, oldLayout, newLayout)
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			results = append(results, result)
+
+			continue
+		}
+
+		if ContainsInternalFunction(oldItem.Type, oldLayout.Types) {
+
+			results = append(results, CheckResult{
+				Label:   oldItem.Label,
+				Status:  CheckTypeChange,
+				Message: "contains internal function pointers, which are code positions of the old contract",
+				Unsafe:  true,
+			})
+
+			continue
+		}
+
+		if !IsTypeEqual(oldItem.Type, newItem.Type, oldLayout.Types, newLayout.Types) && IsValueTypeConversion(oldItem.Type, newItem.Type, oldLayout.Types, newLayout.Types) {
+
+			results = append(results, CheckResult{
+				Label:   oldItem.Label,
+				Status:  CheckMove,
+				Message: fmt.Sprintf("converted from %s to %s, moves from slot %s offset %d to slot %s offset %d", oldLayout.Types[oldItem.Type].Label, newLayout.Types[newItem.Type].Label, oldItem.Slot, oldItem.Offset, newItem.Slot, newItem.Offset),
+			})
+
+			continue
+		}
+
+		if IsFixedArrayResize(oldItem.Type, newItem.Type, oldLayout.Types, newLayout.Types) {
+
+			oldLength, _ := GetArrayLength(oldLayout.Types[oldItem.Type].Label)
+			newLength, _ := GetArrayLength(newLayout.Types[newItem.Type].Label)
+			message := fmt.Sprintf("grows from %d to %d elements", oldLength, newLength)
+
+			if newLength < oldLength {
+
+				message = fmt.Sprintf("shrinks from %d to %d elements", oldLength, newLength)
+			}
+
+			// an array that is resized in place is only resized
+			if oldItem.Slot != newItem.Slot || oldItem.Offset != newItem.Offset {
+
+				message += fmt.Sprintf(", moves from slot %s offset %d to slot %s offset %d", oldItem.Slot, oldItem.Offset, newItem.Slot, newItem.Offset)
+			}
+
+			if newLength < oldLength {
+
+				message += ", the dropped elements must be zero or exported"
+			}
+
+			results = append(results, CheckResult{
+				Label:   oldItem.Label,
+				Status:  CheckResize,
+				Message: message,
+				Unsafe:  newLength < oldLength,
+			})
+
+			continue
+		}
+
+		if IsArrayKindConversion(oldItem.Type, newItem.Type, oldLayout.Types, newLayout.Types) {
+
+			isDynamicToFixed := newLayout.Types[newItem.Type].Encoding == "inplace"
+			message := fmt.Sprintf("converted from %s to %s, moves from slot %s to slot %s and the elements to keccak256(slot)", oldLayout.Types[oldItem.Type].Label, newLayout.Types[newItem.Type].Label, oldItem.Slot, newItem.Slot)
+
+			if isDynamicToFixed {
+
+				message = fmt.Sprintf("converted from %s to %s, elements that do not fit must be zero or exported", oldLayout.Types[oldItem.Type].Label, newLayout.Types[newItem.Type].Label)
+			}
+
+			results = append(results, CheckResult{
+				Label:   oldItem.Label,
+				Status:  CheckMove,
+				Message: message,
+				Unsafe:  isDynamicToFixed,
+			})
+
+			continue
+		}
+
+		if !IsTypeEqual(oldItem.Type, newItem.Type, oldLayout.Types, newLayout.Types) {
+
+			oldKind := GetTypeKind(oldItem.Type, oldLayout.Types)
+			newKind := GetTypeKind(newItem.Type, newLayout.Types)
+
+			message := "unsupported type change from " + oldLayout.Types[oldItem.Type].Label + " to " + newLayout.Types[newItem.Type].Label
+
+			if oldKind != newKind {
+
+				message += " (" + oldKind + " to " + newKind + ")"
+			}
+
+			results = append(results, CheckResult{
+				Label:   oldItem.Label,
+				Status:  CheckTypeChange,
+				Message: message,
+				Unsafe:  true,
+			})
+
+			continue
+		}
+
+		enumLabels, removed := getEnumChanges(oldItem.Type, oldLayout.Types, newLayout.Types)
+
+		if removed {
+
+			results = append(results, CheckResult{
+				Label:   oldItem.Label,
+				Status:  CheckTypeChange,
+				Message: "members were removed from " + strings.Join(enumLabels, ", ") + ", stored values of removed members can not be translated",
+				Unsafe:  true,
+			})
+
+			continue
+		}
+
+		if len(enumLabels) != 0 {
+
+			results = append(results, CheckResult{
+				Label:   oldItem.Label,
+				Status:  CheckMove,
+				Message: fmt.Sprintf("the values of %s are translated to the new members, moves from slot %s offset %d to slot %s offset %d", strings.Join(enumLabels, ", "), oldItem.Slot, oldItem.Offset, newItem.Slot, newItem.Offset),
+			})
+
+			continue
+		}
+
+		addedMembers, removedMembers := getStructChanges(oldItem.Type, oldLayout.Types, newLayout.Types)
+
+		if len(addedMembers) != 0 || len(removedMembers) != 0 {
+
+			message := fmt.Sprintf("moves from slot %s offset %d to slot %s offset %d", oldItem.Slot, oldItem.Offset, newItem.Slot, newItem.Offset)
+
+			if len(addedMembers) != 0 {
+
+				message += ", added members " + strings.Join(addedMembers, ", ") + " are zero unless they are computed"
+			}
+
+			if len(removedMembers) != 0 {
+
+				message += ", the data of removed members " + strings.Join(removedMembers, ", ") + " will be lost unless they are archived"
+			}
+
+			results = append(results, CheckResult{
+				Label:   oldItem.Label,
+				Status:  CheckMove,
+				Message: message,
+				Unsafe:  len(removedMembers) != 0,
+			})
+
+			continue
+		}
+
+		if oldItem.Slot == newItem.Slot && oldItem.Offset == newItem.Offset {
+
+			results = append(results, CheckResult{
+				Label:   oldItem.Label,
+				Status:  CheckInplace,
+				Message: fmt.Sprintf("stays at slot %s offset %d", oldItem.Slot, oldItem.Offset),
+			})
+
+		} else {
+
+			results = append(results, CheckResult{
+				Label:   oldItem.Label,
+				Status:  CheckMove,
+				Message: fmt.Sprintf("moves from slot %s offset %d to slot %s offset %d", oldItem.Slot, oldItem.Offset, newItem.Slot, newItem.Offset),
+			})
+		}
+	}
+
+	for j, newItem := range newLayout.Storage {
+
+		if !pairedNewItems[j] {
+
+			results = append(results, CheckResult{
+				Label:   newItem.Label,
+				Status:  CheckAdded,
+				Message: fmt.Sprintf("added at slot %s offset %d", newItem.Slot, newItem.Offset),
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// prints the results of the upgrade safety checker and returns an error if the upgrade is unsafe
+func runCheck(oldLayoutPath, newLayoutPath string) error {
+
+	oldLayout, err := ReadStorageLayoutFromFile(oldLayoutPath)
+
+	if err != nil {
+
+		return err
+	}
+
+	newLayout, err := ReadStorageLayoutFromFile(newLayoutPath)
+
+	if err != nil {
+
+		return err
+	}
+
+	results, err := CheckLayouts(oldLayout, newLayout)
+
+	if err != nil {
+
+		return err
+	}
+
+	numberOfUnsafeChanges := 0
+
+	for _, result := range results {
+
+		color := green
+
+		if result.Unsafe {
+
+			color = red
+			numberOfUnsafeChanges++
+
+		} else if result.Status == CheckMove || result.Status == CheckResize {
+
+			color = yellow
+		}
+
+		fmt.Println(color + fmt.Sprintf("%-12s %s: %s", result.Status, result.Label, result.Message) + reset)
+	}
+
+	if numberOfUnsafeChanges > 0 {
+
+		return fmt.Errorf("%d unsafe storage layout changes found", numberOfUnsafeChanges)
+	}
+
+	fmt.Println(green + "Upgrade is safe 🎉🎉🎉" + reset)
+	return nil
+}
+
+// checks that the upgrade safety checker reports the expected results of a test, given in check.json
+func checkLayoutResults(directoryPath string) error {
+
+	if _, err := os.Stat(directoryPath + "/" + "check.json"); err != nil {
+
+		return nil
+	}
+
+	var expectedResults []CheckResult
+
+	if err := readJSONFile(directoryPath+"/"+"check.json", &expectedResults); err != nil {
+
+		return err
+	}
+
+	oldLayout, err := ReadStorageLayoutFromFile(directoryPath + "/" + "old_layout.json")
+
+	if err != nil {
+
+		return err
+	}
+
+	newLayout, err := ReadStorageLayoutFromFile(directoryPath + "/" + "new_layout.json")
+
+	if err != nil {
+
+		return err
+	}
+
+	results, err := CheckLayouts(oldLayout, newLayout)
+
+	if err != nil {
+
+		return err
+	}
+
+	if len(results) != len(expectedResults) {
+
+		return fmt.Errorf("Checker Reported %d Results Instead Of %d", len(results), len(expectedResults))
+	}
+
+	for i, result := range results {
+
+		if result != expectedResults[i] {
+
+			return errors.New("Check Result Mismatch For " + result.Label + ": " + result.Status + " " + result.Message)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// function to get the type of the value that a reorganization message writes into the new layout
+func getFinalType(reorgInfo ReorgInfo) string {
+
+	if reorgInfo.NewType != "" {
+
+		return reorgInfo.NewType
+	}
+
+	return reorgInfo.Type
+}
+
+// function to get the contract that declares a variable in the new layout of a reorganization message
+func getFinalContract(reorgInfo ReorgInfo) string {
+
+	if reorgInfo.NewContract != "" {
+
+		return reorgInfo.NewContract
+	}
+
+	return reorgInfo.Contract
+}
+
+// function to find the message of the first plan that writes the value read by the second plan at the given position
+func findComposedSource(firstReorgInfos []ReorgInfo, typeName string, slot common.Hash, offset uint64) (ReorgInfo, bool) {
+
+	for _, reorgInfo := range firstReorgInfos {
+
+		if reorgInfo.NewSlot == slot && reorgInfo.NewOffset == offset && getFinalType(reorgInfo) == typeName {
+
+			return reorgInfo, true
+		}
+	}
+
+	return ReorgInfo{}, false
+}
+
+// function to find the old position of an input of a transform or an expression of the second plan in the first plan.
+// The input must be copied by the first plan without changing its type
+func composeInput(firstReorgInfos []ReorgInfo, input TransformInput, label string) (TransformInput, error) {
+
+	source, found := findComposedSource(firstReorgInfos, input.Type, input.PrevSlot, input.PrevOffset)
+
+	if !found || source.IsComputed() || source.NewType != "" {
+
+		return TransformInput{}, errors.New("Can Not Compose Plans, Input " + input.Label + " Of " + label + " Is Not Copied By The First Plan")
+	}
+
+	input.PrevSlot = source.PrevSlot
+	input.PrevOffset = source.PrevOffset
+
+	return input, nil
+}
+
+// function to find the keys of a mapping that are reorganized by both plans. The values of the other keys are dropped
+func composeMappingKeys(firstKeys, secondKeys []json.RawMessage) []json.RawMessage {
+
+	composedKeys := make([]json.RawMessage, 0)
+
+	for _, secondKey := range secondKeys {
+
+		for _, firstKey := range firstKeys {
+
+			var first, second bytes.Buffer
+
+			if json.Compact(&first, firstKey) == nil && json.Compact(&second, secondKey) == nil && bytes.Equal(first.Bytes(), second.Bytes()) {
+
+				composedKeys = append(composedKeys, secondKey)
+				break
+			}
+		}
+	}
+
+	return composedKeys
+}
+
+// function to combine the message of the first plan that writes a value with the message of the second plan that moves it
+func composeReorgInfo(source, reorgInfo ReorgInfo, firstDataTypes, secondDataTypes map[string]DataType) (ReorgInfo, error) {
+
+	// computed values are computed once and written into their final location
+	if source.IsComputed() {
+
+		if reorgInfo.NewType != "" {
+
+			return ReorgInfo{}, errors.New("Can Not Compose Plans, The Computed Value Of " + reorgInfo.Label + " Is Converted By The Second Plan")
+		}
+
+		source.Label = reorgInfo.Label
+		source.NewSlot = reorgInfo.NewSlot
+		source.NewOffset = reorgInfo.NewOffset
+
+		return source, nil
+	}
+
+	// a storage gap keeps its end slot in both plans and its contents are not moved
+	if source.Gap || reorgInfo.Gap {
+
+		if !source.Gap || !reorgInfo.Gap {
+
+			return ReorgInfo{}, errors.New("Can Not Compose Plans, " + reorgInfo.Label + " Is A Storage Gap In Only One Of The Plans")
+		}
+
+		source.Label = reorgInfo.Label
+		source.NewSlot = reorgInfo.NewSlot
+		source.NewType = ""
+		source.NewContract = ""
+
+		if finalType := getFinalType(reorgInfo); finalType != source.Type {
+
+			source.NewType = finalType
+		}
+
+		if finalContract := getFinalContract(reorgInfo); finalContract != source.Contract {
+
+			source.NewContract = finalContract
+		}
+
+		return source, nil
+	}
+
+	// elements that are dropped by the first plan would be restored by a growing array of the second plan
+	if source.NewType != "" && reorgInfo.NewType != "" && isNarrowingResize(source, firstDataTypes) && !isNarrowingResize(reorgInfo, secondDataTypes) {
+
+		return ReorgInfo{}, errors.New("Can Not Compose Plans, The Elements Of " + reorgInfo.Label + " That Are Dropped By The First Plan Fit Into The Array Of The Second Plan")
+	}
+
+	// a new dynamic array takes the length of the fixed size array of the first plan, not the one of the old array
+	if source.NewType != "" && reorgInfo.NewType != "" && secondDataTypes[reorgInfo.Type].Encoding == "inplace" && secondDataTypes[reorgInfo.NewType].Encoding == "dynamic_array" {
+
+		return ReorgInfo{}, errors.New("Can Not Compose Plans, The Length Of " + reorgInfo.Label + " Is Changed Before It Becomes A Dynamic Array")
+	}
+
+	composedReorgInfo := ReorgInfo{
+		Label:      reorgInfo.Label,
+		Type:       source.Type,
+		PrevSlot:   source.PrevSlot,
+		NewSlot:    reorgInfo.NewSlot,
+		PrevOffset: source.PrevOffset,
+		NewOffset:  reorgInfo.NewOffset,
+		Truncate:   reorgInfo.Truncate,
+		Contract:   source.Contract,
+	}
+
+	if finalType := getFinalType(reorgInfo); finalType != source.Type {
+
+		composedReorgInfo.NewType = finalType
+	}
+
+	if finalContract := getFinalContract(reorgInfo); finalContract != source.Contract {
+
+		composedReorgInfo.NewContract = finalContract
+	}
+
+	if composedReorgInfo.Truncate == "" {
+
+		composedReorgInfo.Truncate = source.Truncate
+	}
+
+	if composedReorgInfo.NewType == "" {
+
+		composedReorgInfo.Truncate = ""
+	}
+
+	if IsMappingEncoding(firstDataTypes[source.Type].Encoding) {
+
+		composedReorgInfo.Keys = composeMappingKeys(source.Keys, reorgInfo.Keys)
+		composedReorgInfo.Complete = source.Complete && reorgInfo.Complete
+	}
+
+	return composedReorgInfo, nil
+}
+
+// function to combine the translation tables of an enum that was changed by both plans
+func composeEnumMapping(firstMapping, secondMapping []int64) []int64 {
+
+	if firstMapping == nil {
+
+		return secondMapping
+
+	} else if secondMapping == nil {
+
+		return firstMapping
+	}
+
+	composedMapping := make([]int64, len(firstMapping))
+	isIdentity := true
+
+	for oldValue, value := range firstMapping {
+
+		composedMapping[oldValue] = -1
+
+		if value >= 0 && value < int64(len(secondMapping)) {
+
+			composedMapping[oldValue] = secondMapping[value]
+		}
+
+		isIdentity = isIdentity && composedMapping[oldValue] == int64(oldValue)
+	}
+
+	if isIdentity {
+
+		return nil
+	}
+
+	return composedMapping
+}
+
+// function to find the member of a struct of the first plan whose new position is the old position of a member of the second plan
+func findComposedMember(members []Member, label string, slot common.Hash, offset uint64) (Member, bool) {
+
+	for _, member := range members {
+
+		if member.Label == label && member.NewSlot == slot && member.NewOffset == offset {
+
+			return member, true
+		}
+	}
+
+	return Member{}, false
+}
+
+// function to combine the data types of a type that is used by both plans. The old sizes and positions are taken from the
+// first plan and the new ones from the second plan
+func composeDataType(first, second DataType) (DataType, error) {
+
+	composedDataType := first
+	composedDataType.NewNumberOfBytes = second.NewNumberOfBytes
+	composedDataType.EnumMapping = composeEnumMapping(first.EnumMapping, second.EnumMapping)
+	composedDataType.AddedMembers = nil
+	composedDataType.ArchivedMembers = first.ArchivedMembers
+
+	if first.Members != nil || second.Members != nil {
+
+		composedDataType.Members = make([]Member, 0)
+	}
+
+	for _, member := range second.Members {
+
+		if firstMember, found := findComposedMember(first.Members, member.Label, member.PrevSlot, member.PrevOffset); found {
+
+			firstMember.NewSlot = member.NewSlot
+			firstMember.NewOffset = member.NewOffset
+			composedDataType.Members = append(composedDataType.Members, firstMember)
+
+			continue
+		}
+
+		// members added by the first plan are computed once and written into their final location
+		if addedMember, found := findComposedMember(first.AddedMembers, member.Label, member.PrevSlot, member.PrevOffset); found {
+
+			addedMember.NewSlot = member.NewSlot
+			addedMember.NewOffset = member.NewOffset
+			composedDataType.AddedMembers = append(composedDataType.AddedMembers, addedMember)
+		}
+	}
+
+	for _, addedMember := range second.AddedMembers {
+
+		inputs := make([]TransformInput, 0, len(addedMember.Inputs))
+
+		for _, input := range addedMember.Inputs {
+
+			firstMember, found := findComposedMember(first.Members, input.Label, input.PrevSlot, input.PrevOffset)
+
+			if !found {
+
+				return DataType{}, errors.New("Can Not Compose Plans, Input " + input.Label + " Of Member " + addedMember.Label + " Of " + first.Label + " Is Not Copied By The First Plan")
+			}
+
+			input.PrevSlot = firstMember.PrevSlot
+			input.PrevOffset = firstMember.PrevOffset
+			inputs = append(inputs, input)
+		}
+
+		if len(inputs) != 0 {
+
+			addedMember.Inputs = inputs
+		}
+
+		composedDataType.AddedMembers = append(composedDataType.AddedMembers, addedMember)
+	}
+
+	for _, archivedMember := range second.ArchivedMembers {
+
+		if firstMember, found := findComposedMember(first.Members, archivedMember.Label, archivedMember.PrevSlot, archivedMember.PrevOffset); found {
+
+			archivedMember.PrevSlot = firstMember.PrevSlot
+			archivedMember.PrevOffset = firstMember.PrevOffset
+			composedDataType.ArchivedMembers = append(composedDataType.ArchivedMembers, archivedMember)
+
+		} else if _, found := findComposedMember(first.AddedMembers, archivedMember.Label, archivedMember.PrevSlot, archivedMember.PrevOffset); found {
+
+			return DataType{}, errors.New("Can Not Compose Plans, Member " + archivedMember.Label + " Of " + first.Label + " Is Added By The First Plan And Archived By The Second Plan")
+		}
+	}
+
+	return composedDataType, nil
+}
+
+// combines two plans, e.g. from v1 to v2 and from v2 to v3, into one plan that reorganizes the storage from the old
+// layout of the first plan to the new layout of the second plan. Every variable of the second plan is followed back to
+// its location in the first plan and conversions are chained. Values that are dropped by one of the plans are dropped
+// by the composed plan, see FindDroppedInBetween
+func ComposeReorgPlans(firstReorgInfos []ReorgInfo, firstDataTypes []DataType, secondReorgInfos []ReorgInfo, secondDataTypes []DataType) ([]ReorgInfo, []DataType, error) {
+
+	firstDataTypesMap := make(map[string]DataType)
+
+	for _, dataType := range firstDataTypes {
+
+		firstDataTypesMap[dataType.Type] = dataType
+	}
+
+	secondDataTypesMap := make(map[string]DataType)
+
+	for _, dataType := range secondDataTypes {
+
+		secondDataTypesMap[dataType.Type] = dataType
+	}
+
+	// the plans only read and write the reorganized account, so the data of other accounts can not be moved again
+	for _, reorgInfo := range append(append([]ReorgInfo{}, firstReorgInfos...), secondReorgInfos...) {
+
+		if reorgInfo.Account != nil {
+
+			return nil, nil, errors.New("Can Not Compose Plans, " + reorgInfo.Label + " Is Moved To Account " + reorgInfo.Account.Hex())
+		}
+
+		if reorgInfo.Source != nil {
+
+			return nil, nil, errors.New("Can Not Compose Plans, " + reorgInfo.Label + " Is Read From Account " + reorgInfo.Source.Hex())
+		}
+	}
+
+	composedReorgInfos := make([]ReorgInfo, 0, len(secondReorgInfos))
+
+	for _, reorgInfo := range secondReorgInfos {
+
+		if reorgInfo.InitialValue != nil && !reorgInfo.IsTransformed() {
+
+			composedReorgInfos = append(composedReorgInfos, reorgInfo)
+			continue
+		}
+
+		if reorgInfo.IsTransformed() {
+
+			// a transform without inputs reads the value of the variable itself
+			if len(reorgInfo.Inputs) == 0 {
+
+				input, err := composeInput(firstReorgInfos, TransformInput{Label: reorgInfo.Label, Type: reorgInfo.Type, PrevSlot: reorgInfo.PrevSlot, PrevOffset: reorgInfo.PrevOffset}, reorgInfo.Label)
+
+				if err != nil {
+
+					return nil, nil, err
+				}
+
+				reorgInfo.PrevSlot = input.PrevSlot
+				reorgInfo.PrevOffset = input.PrevOffset
+			}
+
+			inputs := make([]TransformInput, 0, len(reorgInfo.Inputs))
+
+			for _, input := range reorgInfo.Inputs {
+
+				composedInput, err := composeInput(firstReorgInfos, input, reorgInfo.Label)
+
+				if err != nil {
+
+					return nil, nil, err
+				}
+
+				inputs = append(inputs, composedInput)
+			}
+
+			if len(inputs) != 0 {
+
+				reorgInfo.Inputs = inputs
+			}
+
+			composedReorgInfos = append(composedReorgInfos, reorgInfo)
+			continue
+		}
+
+		source, found := findComposedSource(firstReorgInfos, reorgInfo.Type, reorgInfo.PrevSlot, reorgInfo.PrevOffset)
+
+		// a value that is not written by the first plan is zero
+		if !found {
+
+			continue
+		}
+
+		composedReorgInfo, err := composeReorgInfo(source, reorgInfo, firstDataTypesMap, secondDataTypesMap)
+
+		if err != nil {
+
+			return nil, nil, err
+		}
+
+		composedReorgInfos = append(composedReorgInfos, composedReorgInfo)
+	}
+
+	composedDataTypes := make([]DataType, 0, len(firstDataTypes)+len(secondDataTypes))
+
+	for _, dataType := range firstDataTypes {
+
+		secondDataType, found := secondDataTypesMap[dataType.Type]
+
+		if !found {
+
+			composedDataTypes = append(composedDataTypes, dataType)
+			continue
+		}
+
+		composedDataType, err := composeDataType(dataType, secondDataType)
+
+		if err != nil {
+
+			return nil, nil, err
+		}
+
+		composedDataTypes = append(composedDataTypes, composedDataType)
+	}
+
+	for _, dataType := range secondDataTypes {
+
+		if _, found := firstDataTypesMap[dataType.Type]; !found {
+
+			composedDataTypes = append(composedDataTypes, dataType)
+		}
+	}
+
+	return composedReorgInfos, composedDataTypes, nil
+}
+
+// function to find the variables that are present with the same type in the first and the last layout of a chain
+// of plans but whose values are not moved by the composed plan, because a version in between dropped them
+func FindDroppedInBetween(firstLayout, lastLayout *StorageLayout, composedReorgInfos []ReorgInfo) ([]string, error) {
+
+	droppedLabels := make([]string, 0)
+
+	for _, item := range firstLayout.Storage {
+
+		lastItem, found := lastLayout.FindItem(item.Label)
+
+		if !found || !IsTypeEqual(item.Type, lastItem.Type, firstLayout.Types, lastLayout.Types) {
+
+			continue
+		}
+
+		slot, err := SlotToHash(item.Slot)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		if !isMoved(composedReorgInfos, item.Type, slot, item.Offset) {
+
+			droppedLabels = append(droppedLabels, item.Label)
+		}
+	}
+
+	return droppedLabels, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+)
+
+// function to build the translation table of an enum whose members were reordered, inserted or removed. The table
+// holds the new value of every old value, or -1 if the member was removed. It is nil if the values do not change
+func GetEnumMapping(oldMembers, newMembers []string) []int64 {
+
+	if len(oldMembers) == 0 || len(newMembers) == 0 {
+
+		return nil
+	}
+
+	newValues := make(map[string]int64)
+
+	for i, member := range newMembers {
+
+		newValues[member] = int64(i)
+	}
+
+	mapping := make([]int64, len(oldMembers))
+	isIdentity := true
+
+	for i, member := range oldMembers {
+
+		newValue, found := newValues[member]
+
+		if !found {
+
+			newValue = -1
+		}
+
+		mapping[i] = newValue
+		isIdentity = isIdentity && newValue == int64(i)
+	}
+
+	if isIdentity {
+
+		return nil
+	}
+
+	return mapping
+}
+
+// function to translate an old enum value into the value of the same member in the new enum
+func TranslateEnumValue(dataType DataType, value *big.Int) (*big.Int, error) {
+
+	if !value.IsInt64() || value.Int64() >= int64(len(dataType.EnumMapping)) {
+
+		return nil, errors.New("Invalid Value " + value.String() + " Of " + dataType.Label)
+	}
+
+	newValue := dataType.EnumMapping[value.Int64()]
+
+	if newValue < 0 {
+
+		return nil, errors.New("Member " + value.String() + " Of " + dataType.Label + " Was Removed From The New Enum")
+	}
+
+	return big.NewInt(newValue), nil
+}
+
+// Reorganizes an enum by writing the translated value into the new location
+func (s *StorageReorganizer) ReorganizeEnum(reorgMessage ReorgInfo) error {
+
+	dataType, found := s.dataTypes[reorgMessage.Type]
+
+	if !found {
+
+		return errors.New("Type not found " + reorgMessage.Type)
+	}
+
+	oldValue, err := s.DecodeValue(reorgMessage.Type, reorgMessage.PrevSlot.Big(), reorgMessage.PrevOffset)
+
+	if err != nil {
+
+		return err
+	}
+
+	newValue, err := TranslateEnumValue(dataType, oldValue.(*big.Int))
+
+	if err != nil {
+
+		return errors.New("Can Not Reorganize Enum At Slot " + reorgMessage.PrevSlot.Hex() + ": " + err.Error())
+	}
+
+	return s.encodeInteger(dataType, newValue, reorgMessage.NewSlot, reorgMessage.NewOffset)
+}
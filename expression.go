@@ -0,0 +1,1261 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// The expression language computes the new value of a variable from old values without writing Go code. It supports
+//   - integer literals (decimal or hex), true, false and string literals
+//   - references to old variables by their labels
+//   - arithmetic on integers with overflow checks: + - * / % ** and unary -
+//   - bitwise operations: & | ^ ~ << >>
+//   - bit slicing x[from:to] that extracts the bits from up to to (exclusive), counted from the least significant bit
+//   - casts between integers, address, uint160 and bytes20: uint64(x), address(x), bytes20(x), bytes(x), string(x)
+//   - concatenation of fixed size bytes, bytes and strings: concat(a, b, ...)
+// For example "uint256(price) * 10**12" scales a uint64 price with 6 decimals to a uint256 with 18 decimals.
+
+const (
+	// kinds of the types of expressions
+	ExpressionInt        = "int"
+	ExpressionLiteral    = "literal"
+	ExpressionAddress    = "address"
+	ExpressionBool       = "bool"
+	ExpressionFixedBytes = "fixed_bytes"
+	ExpressionBytes      = "bytes"
+	ExpressionString     = "string"
+)
+
+// limit of shifts and exponents of integer literals, which are not bounded by a type
+const maxLiteralBits = 1024
+
+// struct that holds the type of an expression. Bits is the size of integers and fixed size bytes
+type ExpressionType struct {
+	Kind   string
+	Bits   uint
+	Signed bool
+}
+
+// function to get the Solidity name of an expression type
+func (t ExpressionType) String() string {
+
+	switch t.Kind {
+
+	case ExpressionInt:
+
+		if t.Signed {
+
+			return "int" + strconv.Itoa(int(t.Bits))
+		}
+
+		return "uint" + strconv.Itoa(int(t.Bits))
+
+	case ExpressionLiteral:
+		return "integer literal"
+	case ExpressionFixedBytes:
+		return "bytes" + strconv.Itoa(int(t.Bits/8))
+	}
+
+	return t.Kind
+}
+
+// function to check if a value of a type can be used where a value of another type is expected without a cast
+func (t ExpressionType) IsAssignableTo(other ExpressionType) bool {
+
+	if t == other {
+
+		return true
+	}
+
+	if t.Kind == ExpressionLiteral {
+
+		return other.Kind == ExpressionInt
+	}
+
+	// integers may only be widened and keep their signedness
+	return t.Kind == ExpressionInt && other.Kind == ExpressionInt && t.Signed == other.Signed && t.Bits <= other.Bits
+}
+
+// function to parse the type names of value types, bytes and strings, e.g. "uint64", "address" or "bytes20"
+func ParseTypeName(name string) (ExpressionType, bool) {
+
+	if name == "address" || name == "address payable" {
+
+		return ExpressionType{Kind: ExpressionAddress, Bits: 160}, true
+
+	} else if name == "bool" {
+
+		return ExpressionType{Kind: ExpressionBool, Bits: 8}, true
+
+	} else if name == "bytes" {
+
+		return ExpressionType{Kind: ExpressionBytes}, true
+
+	} else if name == "string" {
+
+		return ExpressionType{Kind: ExpressionString}, true
+
+	} else if name == "uint" || name == "int" {
+
+		return ExpressionType{Kind: ExpressionInt, Bits: 256, Signed: name == "int"}, true
+	}
+
+	for _, prefix := range []string{"uint", "int", "bytes"} {
+
+		if !strings.HasPrefix(name, prefix) {
+
+			continue
+		}
+
+		size, err := strconv.Atoi(name[len(prefix):])
+
+		if err != nil {
+
+			return ExpressionType{}, false
+		}
+
+		if prefix == "bytes" {
+
+			return ExpressionType{Kind: ExpressionFixedBytes, Bits: uint(size) * 8}, size >= 1 && size <= 32
+		}
+
+		return ExpressionType{Kind: ExpressionInt, Bits: uint(size), Signed: prefix == "int"}, size >= 8 && size <= 256 && size%8 == 0
+	}
+
+	return ExpressionType{}, false
+}
+
+// function to get the expression type of a data type. Enums are stored as unsigned integers of the given number of bytes
+func GetExpressionType(dataType DataType, numberOfBytes uint64) (ExpressionType, error) {
+
+	if strings.HasPrefix(dataType.Label, "enum ") {
+
+		return ExpressionType{Kind: ExpressionInt, Bits: uint(numberOfBytes) * 8}, nil
+	}
+
+	expressionType, ok := ParseTypeName(GetEncodingLabel(dataType))
+
+	if !ok || len(dataType.Members) != 0 || dataType.Base != "" {
+
+		return ExpressionType{}, errors.New("Type " + dataType.Label + " Is Not Supported In Expressions")
+	}
+
+	return expressionType, nil
+}
+
+// struct that holds a node of a parsed expression. The type is set by the type checker
+type Expression struct {
+	Kind     string // "number", "bool", "string", "variable", "unary", "binary", "slice" or "call"
+	Operator string
+	Name     string
+	Value    *big.Int
+	Text     string
+	Operands []*Expression
+	From     uint
+	To       uint
+	Type     ExpressionType
+}
+
+// struct that holds a token of an expression
+type expressionToken struct {
+	kind     string // "number", "string", "identifier", "operator" or "end"
+	text     string
+	position int
+}
+
+// operators ordered so that the longest match is found first
+var expressionOperators = []string{"**", "<<", ">>", "+", "-", "*", "/", "%", "&", "|", "^", "~", "(", ")", "[", "]", ":", ","}
+
+// function to split an expression into tokens
+func tokenizeExpression(source string) ([]expressionToken, error) {
+
+	tokens := make([]expressionToken, 0)
+	position := 0
+
+	for position < len(source) {
+
+		character := source[position]
+
+		if character == ' ' || character == '\t' || character == '\n' {
+
+			position++
+			continue
+		}
+
+		start := position
+
+		if isDigit(character) {
+
+			for position < len(source) && (isDigit(source[position]) || isLetter(source[position])) {
+
+				position++
+			}
+
+			tokens = append(tokens, expressionToken{kind: "number", text: source[start:position], position: start})
+
+		} else if isLetter(character) {
+
+			for position < len(source) && (isDigit(source[position]) || isLetter(source[position])) {
+
+				position++
+			}
+
+			tokens = append(tokens, expressionToken{kind: "identifier", text: source[start:position], position: start})
+
+		} else if character == '"' {
+
+			position++
+
+			for position < len(source) && source[position] != '"' {
+
+				if source[position] == '\\' {
+
+					position++
+				}
+
+				position++
+			}
+
+			if position >= len(source) {
+
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+
+			position++
+
+			tokens = append(tokens, expressionToken{kind: "string", text: source[start:position], position: start})
+
+		} else {
+
+			operator := ""
+
+			for _, candidate := range expressionOperators {
+
+				if strings.HasPrefix(source[position:], candidate) {
+
+					operator = candidate
+					break
+				}
+			}
+
+			if operator == "" {
+
+				return nil, fmt.Errorf("unexpected character %q at position %d", character, position)
+			}
+
+			position += len(operator)
+
+			tokens = append(tokens, expressionToken{kind: "operator", text: operator, position: start})
+		}
+	}
+
+	return append(tokens, expressionToken{kind: "end", position: len(source)}), nil
+}
+
+func isDigit(character byte) bool {
+
+	return character >= '0' && character <= '9'
+}
+
+func isLetter(character byte) bool {
+
+	return character == '_' || character == '$' || (character >= 'a' && character <= 'z') || (character >= 'A' && character <= 'Z')
+}
+
+// recursive descent parser of expressions. The precedence of the operators follows Solidity
+type expressionParser struct {
+	tokens   []expressionToken
+	position int
+}
+
+// binary operators from the lowest to the highest precedence, ** is handled separately because it is right associative
+var binaryOperatorLevels = [][]string{{"|"}, {"^"}, {"&"}, {"<<", ">>"}, {"+", "-"}, {"*", "/", "%"}}
+
+// function to parse an expression
+func ParseExpression(source string) (*Expression, error) {
+
+	tokens, err := tokenizeExpression(source)
+
+	if err != nil {
+
+		return nil, errors.New("Invalid Expression " + source + ": " + err.Error())
+	}
+
+	parser := &expressionParser{tokens: tokens}
+	expression, err := parser.parseBinary(0)
+
+	if err == nil && parser.peek().kind != "end" {
+
+		err = fmt.Errorf("unexpected %q at position %d", parser.peek().text, parser.peek().position)
+	}
+
+	if err != nil {
+
+		return nil, errors.New("Invalid Expression " + source + ": " + err.Error())
+	}
+
+	return expression, nil
+}
+
+func (p *expressionParser) peek() expressionToken {
+
+	return p.tokens[p.position]
+}
+
+func (p *expressionParser) next() expressionToken {
+
+	token := p.tokens[p.position]
+
+	if token.kind != "end" {
+
+		p.position++
+	}
+
+	return token
+}
+
+// function to consume an operator that must follow
+func (p *expressionParser) expect(operator string) error {
+
+	token := p.next()
+
+	if token.kind != "operator" || token.text != operator {
+
+		return fmt.Errorf("expected %q at position %d", operator, token.position)
+	}
+
+	return nil
+}
+
+// function to check if the next token is one of the given operators
+func (p *expressionParser) isOperator(operators ...string) bool {
+
+	token := p.peek()
+
+	if token.kind != "operator" {
+
+		return false
+	}
+
+	for _, operator := range operators {
+
+		if token.text == operator {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *expressionParser) parseBinary(level int) (*Expression, error) {
+
+	if level == len(binaryOperatorLevels) {
+
+		return p.parsePower()
+	}
+
+	left, err := p.parseBinary(level + 1)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	for p.isOperator(binaryOperatorLevels[level]...) {
+
+		operator := p.next().text
+		right, err := p.parseBinary(level + 1)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		left = &Expression{Kind: "binary", Operator: operator, Operands: []*Expression{left, right}}
+	}
+
+	return left, nil
+}
+
+func (p *expressionParser) parsePower() (*Expression, error) {
+
+	base, err := p.parseUnary()
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	if !p.isOperator("**") {
+
+		return base, nil
+	}
+
+	p.next()
+	exponent, err := p.parsePower()
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return &Expression{Kind: "binary", Operator: "**", Operands: []*Expression{base, exponent}}, nil
+}
+
+func (p *expressionParser) parseUnary() (*Expression, error) {
+
+	if p.isOperator("-", "~") {
+
+		operator := p.next().text
+		operand, err := p.parseUnary()
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		return &Expression{Kind: "unary", Operator: operator, Operands: []*Expression{operand}}, nil
+	}
+
+	return p.parsePostfix()
+}
+
+func (p *expressionParser) parsePostfix() (*Expression, error) {
+
+	expression, err := p.parsePrimary()
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	for p.isOperator("[") {
+
+		p.next()
+		from, err := p.parseBitIndex()
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		if err := p.expect(":"); err != nil {
+
+			return nil, err
+		}
+
+		to, err := p.parseBitIndex()
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		if err := p.expect("]"); err != nil {
+
+			return nil, err
+		}
+
+		expression = &Expression{Kind: "slice", Operands: []*Expression{expression}, From: from, To: to}
+	}
+
+	return expression, nil
+}
+
+// function to parse the decimal bounds of a bit slice
+func (p *expressionParser) parseBitIndex() (uint, error) {
+
+	token := p.next()
+
+	if token.kind != "number" {
+
+		return 0, fmt.Errorf("expected a bit index at position %d", token.position)
+	}
+
+	index, err := strconv.ParseUint(token.text, 10, 16)
+
+	if err != nil {
+
+		return 0, fmt.Errorf("invalid bit index %s at position %d", token.text, token.position)
+	}
+
+	return uint(index), nil
+}
+
+func (p *expressionParser) parsePrimary() (*Expression, error) {
+
+	token := p.next()
+
+	switch token.kind {
+
+	case "number":
+
+		value, ok := new(big.Int).SetString(token.text, 0)
+
+		if !ok || strings.HasPrefix(token.text, "0") && len(token.text) > 1 && !strings.HasPrefix(token.text, "0x") {
+
+			return nil, fmt.Errorf("invalid number %s at position %d", token.text, token.position)
+		}
+
+		return &Expression{Kind: "number", Value: value, Text: token.text}, nil
+
+	case "string":
+
+		text, err := strconv.Unquote(token.text)
+
+		if err != nil {
+
+			return nil, fmt.Errorf("invalid string %s at position %d", token.text, token.position)
+		}
+
+		return &Expression{Kind: "string", Text: text}, nil
+
+	case "identifier":
+
+		if token.text == "true" || token.text == "false" {
+
+			return &Expression{Kind: "bool", Name: token.text}, nil
+		}
+
+		if !p.isOperator("(") {
+
+			return &Expression{Kind: "variable", Name: token.text}, nil
+		}
+
+		p.next()
+		arguments := make([]*Expression, 0)
+
+		for !p.isOperator(")") {
+
+			if len(arguments) != 0 {
+
+				if err := p.expect(","); err != nil {
+
+					return nil, err
+				}
+			}
+
+			argument, err := p.parseBinary(0)
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			arguments = append(arguments, argument)
+		}
+
+		p.next()
+
+		return &Expression{Kind: "call", Name: token.text, Operands: arguments}, nil
+
+	case "operator":
+
+		if token.text == "(" {
+
+			expression, err := p.parseBinary(0)
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			if err := p.expect(")"); err != nil {
+
+				return nil, err
+			}
+
+			return expression, nil
+		}
+	}
+
+	if token.kind == "end" {
+
+		return nil, errors.New("unexpected end of expression")
+	}
+
+	return nil, fmt.Errorf("unexpected %q at position %d", token.text, token.position)
+}
+
+// function to get the labels of the old variables referenced by an expression in the order of their first use
+func (e *Expression) Variables() []string {
+
+	variables := make([]string, 0)
+	seen := make(map[string]bool)
+
+	var visit func(expression *Expression)
+
+	visit = func(expression *Expression) {
+
+		if expression.Kind == "variable" && !seen[expression.Name] {
+
+			seen[expression.Name] = true
+			variables = append(variables, expression.Name)
+		}
+
+		for _, operand := range expression.Operands {
+
+			visit(operand)
+		}
+	}
+
+	visit(e)
+
+	return variables
+}
+
+// function to check the types of an expression and of all its operands. The types of the referenced variables are
+// given by their labels and the result must be assignable to the target type
+func CheckExpression(expression *Expression, variableTypes map[string]ExpressionType, targetType ExpressionType) error {
+
+	if err := expression.check(variableTypes); err != nil {
+
+		return err
+	}
+
+	if !expression.Type.IsAssignableTo(targetType) {
+
+		return errors.New("Can Not Assign " + expression.Type.String() + " To " + targetType.String())
+	}
+
+	return nil
+}
+
+func (e *Expression) check(variableTypes map[string]ExpressionType) error {
+
+	for _, operand := range e.Operands {
+
+		if err := operand.check(variableTypes); err != nil {
+
+			return err
+		}
+	}
+
+	switch e.Kind {
+
+	case "number":
+
+		e.Type = ExpressionType{Kind: ExpressionLiteral}
+
+	case "bool":
+
+		e.Type = ExpressionType{Kind: ExpressionBool, Bits: 8}
+
+	case "string":
+
+		e.Type = ExpressionType{Kind: ExpressionString}
+
+	case "variable":
+
+		variableType, found := variableTypes[e.Name]
+
+		if !found {
+
+			return errors.New("Unknown Variable " + e.Name)
+		}
+
+		e.Type = variableType
+
+	case "unary":
+
+		operandType := e.Operands[0].Type
+
+		if e.Operator == "-" && (operandType.Kind == ExpressionLiteral || operandType.Kind == ExpressionInt && operandType.Signed) {
+
+			e.Type = operandType
+
+		} else if e.Operator == "~" && (operandType.Kind == ExpressionInt || operandType.Kind == ExpressionFixedBytes) {
+
+			e.Type = operandType
+
+		} else {
+
+			return errors.New("Can Not Apply " + e.Operator + " To " + operandType.String())
+		}
+
+	case "binary":
+
+		return e.checkBinary()
+
+	case "slice":
+
+		operandType := e.Operands[0].Type
+
+		if operandType.Kind != ExpressionInt && operandType.Kind != ExpressionFixedBytes && operandType.Kind != ExpressionAddress {
+
+			return errors.New("Can Not Slice " + operandType.String())
+		}
+
+		if e.From >= e.To || e.To > operandType.Bits || (e.To-e.From)%8 != 0 {
+
+			return fmt.Errorf("Invalid Bit Slice [%d:%d] Of %s", e.From, e.To, operandType.String())
+		}
+
+		e.Type = ExpressionType{Kind: ExpressionInt, Bits: e.To - e.From}
+
+	case "call":
+
+		return e.checkCall()
+	}
+
+	return nil
+}
+
+// function to find the common type of the operands of an arithmetic or bitwise operation
+func commonOperandType(left, right ExpressionType) (ExpressionType, bool) {
+
+	if left.IsAssignableTo(right) {
+
+		return right, true
+	}
+
+	if right.IsAssignableTo(left) {
+
+		return left, true
+	}
+
+	return ExpressionType{}, false
+}
+
+func (e *Expression) checkBinary() error {
+
+	left := e.Operands[0].Type
+	right := e.Operands[1].Type
+	mismatch := errors.New("Can Not Apply " + e.Operator + " To " + left.String() + " And " + right.String())
+
+	switch e.Operator {
+
+	case "<<", ">>", "**":
+
+		// the result has the type of the left operand and the right operand must be unsigned
+		if left.Kind != ExpressionInt && left.Kind != ExpressionLiteral && (e.Operator == "**" || left.Kind != ExpressionFixedBytes) {
+
+			return mismatch
+		}
+
+		if right.Kind != ExpressionLiteral && (right.Kind != ExpressionInt || right.Signed) {
+
+			return mismatch
+		}
+
+		e.Type = left
+
+	case "&", "|", "^":
+
+		commonType, ok := commonOperandType(left, right)
+
+		if !ok || commonType.Kind != ExpressionInt && commonType.Kind != ExpressionLiteral && commonType.Kind != ExpressionFixedBytes {
+
+			return mismatch
+		}
+
+		e.Type = commonType
+
+	default:
+
+		commonType, ok := commonOperandType(left, right)
+
+		if !ok || commonType.Kind != ExpressionInt && commonType.Kind != ExpressionLiteral {
+
+			return mismatch
+		}
+
+		e.Type = commonType
+	}
+
+	return nil
+}
+
+func (e *Expression) checkCall() error {
+
+	if e.Name == "concat" {
+
+		if len(e.Operands) == 0 {
+
+			return errors.New("concat Needs At Least One Argument")
+		}
+
+		allFixed, allStrings := true, true
+		bits := uint(0)
+
+		for _, operand := range e.Operands {
+
+			kind := operand.Type.Kind
+
+			if kind != ExpressionFixedBytes && kind != ExpressionBytes && kind != ExpressionString {
+
+				return errors.New("Can Not Concatenate " + operand.Type.String())
+			}
+
+			allFixed = allFixed && kind == ExpressionFixedBytes
+			allStrings = allStrings && kind == ExpressionString
+			bits += operand.Type.Bits
+		}
+
+		if allFixed && bits <= 256 {
+
+			e.Type = ExpressionType{Kind: ExpressionFixedBytes, Bits: bits}
+
+		} else if allStrings {
+
+			e.Type = ExpressionType{Kind: ExpressionString}
+
+		} else {
+
+			e.Type = ExpressionType{Kind: ExpressionBytes}
+		}
+
+		return nil
+	}
+
+	castType, ok := ParseTypeName(e.Name)
+
+	if !ok {
+
+		return errors.New("Unknown Function " + e.Name)
+	}
+
+	if len(e.Operands) != 1 {
+
+		return errors.New(e.Name + " Expects A Single Argument")
+	}
+
+	from := e.Operands[0].Type
+	invalid := errors.New("Can Not Convert " + from.String() + " To " + castType.String())
+	e.Type = castType
+
+	switch castType.Kind {
+
+	case ExpressionInt:
+
+		// integers can be converted to other integers if the value fits, addresses and fixed size bytes only to integers of the same size
+		if from.Kind == ExpressionInt || from.Kind == ExpressionLiteral {
+
+			return nil
+		}
+
+		if !castType.Signed && (from.Kind == ExpressionAddress || from.Kind == ExpressionFixedBytes) && from.Bits == castType.Bits {
+
+			return nil
+		}
+
+	case ExpressionAddress:
+
+		if from.Kind == ExpressionAddress || from.Kind == ExpressionLiteral || (from.Kind == ExpressionInt || from.Kind == ExpressionFixedBytes) && !from.Signed && from.Bits == 160 {
+
+			return nil
+		}
+
+	case ExpressionFixedBytes:
+
+		// fixed size bytes can only be widened, addresses and unsigned integers must have the same size
+		if from.Kind == ExpressionFixedBytes && from.Bits <= castType.Bits {
+
+			return nil
+		}
+
+		if (from.Kind == ExpressionAddress || from.Kind == ExpressionInt && !from.Signed) && from.Bits == castType.Bits {
+
+			return nil
+		}
+
+	case ExpressionBytes, ExpressionString:
+
+		if from.Kind == ExpressionBytes || from.Kind == ExpressionString {
+
+			return nil
+		}
+
+	case ExpressionBool:
+
+		if from.Kind == ExpressionBool {
+
+			return nil
+		}
+	}
+
+	return invalid
+}
+
+// function to check if an integer fits in an integer type. Literals are not bounded
+func fitsExpressionType(value *big.Int, expressionType ExpressionType) bool {
+
+	if expressionType.Kind == ExpressionLiteral {
+
+		return true
+	}
+
+	if expressionType.Signed {
+
+		limit := new(big.Int).Lsh(big.NewInt(1), expressionType.Bits-1)
+
+		return value.Cmp(limit) < 0 && value.Cmp(new(big.Int).Neg(limit)) >= 0
+	}
+
+	return value.Sign() >= 0 && value.BitLen() <= int(expressionType.Bits)
+}
+
+// function to wrap an integer into the range of a type, used by the bitwise operations that discard bits like in Solidity
+func wrapInteger(value *big.Int, expressionType ExpressionType) *big.Int {
+
+	if expressionType.Kind == ExpressionLiteral {
+
+		return value
+	}
+
+	limit := new(big.Int).Lsh(big.NewInt(1), expressionType.Bits)
+	wrapped := new(big.Int).Mod(value, limit)
+
+	if expressionType.Signed && wrapped.Cmp(new(big.Int).Rsh(limit, 1)) >= 0 {
+
+		wrapped.Sub(wrapped, limit)
+	}
+
+	return wrapped
+}
+
+// function to evaluate a type checked expression with the values of the old variables. Integers, addresses, bools and
+// fixed size bytes evaluate to *big.Int, bytes and strings evaluate to []byte
+func (e *Expression) Evaluate(values map[string]interface{}) (interface{}, error) {
+
+	operands := make([]interface{}, len(e.Operands))
+
+	for i, operand := range e.Operands {
+
+		value, err := operand.Evaluate(values)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		operands[i] = value
+	}
+
+	switch e.Kind {
+
+	case "number":
+
+		return e.Value, nil
+
+	case "bool":
+
+		if e.Name == "true" {
+
+			return big.NewInt(1), nil
+		}
+
+		return big.NewInt(0), nil
+
+	case "string":
+
+		return []byte(e.Text), nil
+
+	case "variable":
+
+		value, found := values[e.Name]
+
+		if !found {
+
+			return nil, errors.New("Unknown Variable " + e.Name)
+		}
+
+		if e.Type.Kind == ExpressionBytes || e.Type.Kind == ExpressionString {
+
+			if data, ok := value.([]byte); ok {
+
+				return data, nil
+			}
+
+			return nil, errors.New("Expected Bytes For " + e.Name)
+		}
+
+		return ParseInteger(value)
+
+	case "unary":
+
+		operand := operands[0].(*big.Int)
+
+		if e.Operator == "~" {
+
+			return wrapInteger(new(big.Int).Not(operand), e.Type), nil
+		}
+
+		return e.checkOverflow(new(big.Int).Neg(operand))
+
+	case "binary":
+
+		return e.evaluateBinary(operands[0].(*big.Int), operands[1].(*big.Int))
+
+	case "slice":
+
+		operand := wrapInteger(operands[0].(*big.Int), ExpressionType{Kind: ExpressionInt, Bits: e.Operands[0].Type.Bits})
+		mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), e.To-e.From), big.NewInt(1))
+
+		return new(big.Int).And(new(big.Int).Rsh(operand, e.From), mask), nil
+
+	case "call":
+
+		return e.evaluateCall(operands)
+	}
+
+	return nil, errors.New("Unknown Expression " + e.Kind)
+}
+
+// function to return the result of an arithmetic operation if it fits in the type of the expression
+func (e *Expression) checkOverflow(result *big.Int) (*big.Int, error) {
+
+	if !fitsExpressionType(result, e.Type) {
+
+		return nil, errors.New("Arithmetic Overflow: " + result.String() + " Does Not Fit In " + e.Type.String())
+	}
+
+	return result, nil
+}
+
+func (e *Expression) evaluateBinary(left, right *big.Int) (interface{}, error) {
+
+	// literal operands take the type of the other operand and must fit in it
+	for i, operand := range []*big.Int{left, right} {
+
+		if e.Operator != "<<" && e.Operator != ">>" && e.Operator != "**" && !fitsExpressionType(operand, e.Type) {
+
+			return nil, errors.New("Value " + operand.String() + " Does Not Fit In " + e.Type.String())
+		}
+
+		if i == 1 && (e.Operator == "<<" || e.Operator == ">>" || e.Operator == "**") && operand.Sign() < 0 {
+
+			return nil, errors.New("Negative Right Operand Of " + e.Operator)
+		}
+	}
+
+	if (e.Operator == "<<" || e.Operator == "**") && e.Type.Kind == ExpressionLiteral && right.Cmp(big.NewInt(maxLiteralBits)) > 0 {
+
+		return nil, errors.New("Right Operand Of " + e.Operator + " Is Too Large: " + right.String())
+	}
+
+	switch e.Operator {
+
+	case "+":
+		return e.checkOverflow(new(big.Int).Add(left, right))
+	case "-":
+		return e.checkOverflow(new(big.Int).Sub(left, right))
+	case "*":
+		return e.checkOverflow(new(big.Int).Mul(left, right))
+
+	case "/", "%":
+
+		if right.Sign() == 0 {
+
+			return nil, errors.New("Division By Zero")
+		}
+
+		// signed division truncates towards zero like in Solidity
+		if e.Operator == "/" {
+
+			return e.checkOverflow(new(big.Int).Quo(left, right))
+		}
+
+		return e.checkOverflow(new(big.Int).Rem(left, right))
+
+	case "**":
+
+		// powers of bases other than 0, 1 and -1 overflow every type long before the exponent reaches the limit
+		if left.CmpAbs(big.NewInt(1)) > 0 && right.Cmp(big.NewInt(maxLiteralBits)) > 0 {
+
+			return nil, errors.New("Arithmetic Overflow: " + left.String() + "**" + right.String() + " Does Not Fit In " + e.Type.String())
+		}
+
+		exponent := right
+
+		// the powers of 0, 1 and -1 only depend on the exponent being zero, odd or even
+		if exponent.Cmp(big.NewInt(maxLiteralBits)) > 0 {
+
+			exponent = big.NewInt(int64(2 + right.Bit(0)))
+		}
+
+		return e.checkOverflow(new(big.Int).Exp(left, exponent, nil))
+
+	case "<<":
+
+		if right.Cmp(big.NewInt(maxLiteralBits)) > 0 {
+
+			return big.NewInt(0), nil
+		}
+
+		return wrapInteger(new(big.Int).Lsh(left, uint(right.Uint64())), e.Type), nil
+
+	case ">>":
+
+		if right.Cmp(big.NewInt(maxLiteralBits)) > 0 {
+
+			return new(big.Int).Rsh(left, maxLiteralBits), nil
+		}
+
+		return new(big.Int).Rsh(left, uint(right.Uint64())), nil
+
+	case "&":
+		return new(big.Int).And(left, right), nil
+	case "|":
+		return new(big.Int).Or(left, right), nil
+	case "^":
+		return new(big.Int).Xor(left, right), nil
+	}
+
+	return nil, errors.New("Unknown Operator " + e.Operator)
+}
+
+// function to get the bytes of a fixed size bytes value or of bytes and strings
+func toByteSlice(value interface{}, expressionType ExpressionType) []byte {
+
+	if integer, ok := value.(*big.Int); ok {
+
+		data := make([]byte, expressionType.Bits/8)
+
+		return integer.FillBytes(data)
+	}
+
+	return value.([]byte)
+}
+
+func (e *Expression) evaluateCall(operands []interface{}) (interface{}, error) {
+
+	if e.Name == "concat" {
+
+		if e.Type.Kind == ExpressionFixedBytes {
+
+			result := new(big.Int)
+
+			for i, operand := range operands {
+
+				result.Lsh(result, e.Operands[i].Type.Bits)
+				result.Or(result, operand.(*big.Int))
+			}
+
+			return result, nil
+		}
+
+		result := make([]byte, 0)
+
+		for i, operand := range operands {
+
+			result = append(result, toByteSlice(operand, e.Operands[i].Type)...)
+		}
+
+		return result, nil
+	}
+
+	from := e.Operands[0].Type
+
+	if e.Type.Kind == ExpressionBytes || e.Type.Kind == ExpressionString {
+
+		return operands[0], nil
+	}
+
+	value := operands[0].(*big.Int)
+
+	// fixed size bytes are aligned to the left, so widening them appends zero bytes
+	if e.Type.Kind == ExpressionFixedBytes && from.Kind == ExpressionFixedBytes {
+
+		return new(big.Int).Lsh(value, e.Type.Bits-from.Bits), nil
+	}
+
+	if !fitsExpressionType(value, ExpressionType{Kind: ExpressionInt, Bits: e.Type.Bits, Signed: e.Type.Signed}) {
+
+		return nil, errors.New("Value " + value.String() + " Does Not Fit In " + e.Type.String())
+	}
+
+	return value, nil
+}
+
+// function to parse the expression of a reorganization message and check it against the data types of its inputs and of the new variable
+func CheckReorgExpression(reorgInfo ReorgInfo, dataTypes map[string]DataType) (*Expression, error) {
+
+	expression, err := ParseExpression(reorgInfo.Expression)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	variableTypes := make(map[string]ExpressionType)
+
+	for _, input := range reorgInfo.Inputs {
+
+		dataType, found := dataTypes[input.Type]
+
+		if !found {
+
+			return nil, errors.New("Type not found " + input.Type)
+		}
+
+		if variableTypes[input.Label], err = GetExpressionType(dataType, dataType.PrevNumberOfBytes); err != nil {
+
+			return nil, err
+		}
+	}
+
+	dataType, found := dataTypes[reorgInfo.Type]
+
+	if !found {
+
+		return nil, errors.New("Type not found " + reorgInfo.Type)
+	}
+
+	targetType, err := GetExpressionType(dataType, dataType.NewNumberOfBytes)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	if err := CheckExpression(expression, variableTypes, targetType); err != nil {
+
+		return nil, errors.New("Invalid Expression For " + reorgInfo.Label + ": " + err.Error())
+	}
+
+	return expression, nil
+}
+
+// computes the new value of a variable with its expression and writes it into the new location
+func (s *StorageReorganizer) ReorganizeExpression(reorgMessage ReorgInfo) error {
+
+	expression, err := CheckReorgExpression(reorgMessage, s.dataTypes)
+
+	if err != nil {
+
+		return err
+	}
+
+	oldValues := make(map[string]interface{})
+
+	for _, input := range reorgMessage.Inputs {
+
+		oldValue, err := s.DecodeValue(input.Type, input.PrevSlot.Big(), input.PrevOffset)
+
+		if err != nil {
+
+			return errors.New("Can Not Decode " + input.Label + ": " + err.Error())
+		}
+
+		oldValues[input.Label] = oldValue
+	}
+
+	newValue, err := expression.Evaluate(oldValues)
+
+	if err != nil {
+
+		return errors.New("Can Not Evaluate Expression For " + reorgMessage.Label + ": " + err.Error())
+	}
+
+	if err := s.EncodeValue(reorgMessage.Type, newValue, reorgMessage.NewSlot.Big(), reorgMessage.NewOffset); err != nil {
+
+		return errors.New("Can Not Store " + reorgMessage.Label + ": " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// function to create reorganization messages that move single fields between variables and struct members, e.g. the
+// variable totalSupply into the member info.totalSupply or back. The mappings are keyed by the paths of the fields
+// in the new layout and hold the paths of the fields in the old layout
+func GetFieldMappings(oldLayout, newLayout *StorageLayout, fieldMappings map[string]string, commonObjects []ReorgInfo) ([]ReorgInfo, error) {
+
+	reorgInfos := make([]ReorgInfo, 0, len(fieldMappings))
+	newPaths := make([]string, 0, len(fieldMappings))
+
+	for newPath := range fieldMappings {
+
+		newPaths = append(newPaths, newPath)
+	}
+
+	// the fields are moved in a fixed order so that the plan is always the same
+	sort.Strings(newPaths)
+
+	for _, newPath := range newPaths {
+
+		oldPath := fieldMappings[newPath]
+
+		newItem, found := newLayout.FindField(newPath)
+
+		if !found {
+
+			return nil, errors.New("Mapped Field Not Found In New Layout " + newPath)
+		}
+
+		oldItem, found := oldLayout.FindField(oldPath)
+
+		if !found {
+
+			return nil, errors.New("Mapped Field Not Found In Old Layout " + oldPath)
+		}
+
+		if !IsTypeEqual(oldItem.Type, newItem.Type, oldLayout.Types, newLayout.Types) {
+
+			return nil, errors.New("Mapped Fields " + oldPath + " And " + newPath + " Have Different Types")
+		}
+
+		// the variables that are present in both layouts are already moved as a whole
+		variableLabel := strings.Split(newPath, ".")[0]
+
+		for _, commonObject := range commonObjects {
+
+			if commonObject.Label == variableLabel {
+
+				return nil, errors.New("Mapped Field " + newPath + " Belongs To A Variable That Is Present In Both Layouts")
+			}
+		}
+
+		prevSlot, err := SlotToHash(oldItem.Slot)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		newSlot, err := SlotToHash(newItem.Slot)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		reorgInfos = append(reorgInfos, ReorgInfo{
+			Label:      newPath,
+			Type:       oldItem.Type,
+			PrevSlot:   prevSlot,
+			NewSlot:    newSlot,
+			PrevOffset: oldItem.Offset,
+			NewOffset:  newItem.Offset,
+		})
+	}
+
+	return reorgInfos, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// function to create the reorganization message of a storage gap that is present in both layouts. A gap that shrinks
+// by the slots of the variables inserted before it does not change the layout, so its contents are not moved. A gap
+// that ends after its old end overflows, the variables of the contracts that inherit from it would move. The slots of a
+// removed gap are reported as orphaned if they hold data
+func GetStorageGap(oldItem, newItem StorageItem, oldLayout, newLayout *StorageLayout) (ReorgInfo, error) {
+
+	oldEnd, err := getEndSlot(oldItem, oldLayout.Types)
+
+	if err != nil {
+
+		return ReorgInfo{}, err
+	}
+
+	newEnd, err := getEndSlot(newItem, newLayout.Types)
+
+	if err != nil {
+
+		return ReorgInfo{}, err
+	}
+
+	if newEnd.Cmp(oldEnd) > 0 {
+
+		overflow := new(big.Int).Sub(newEnd, oldEnd)
+
+		return ReorgInfo{}, errors.New("Storage Gap " + oldItem.Label + " At Slot " + oldItem.Slot + " Overflows By " + overflow.String() + " Slots, It Ends At Slot " + newEnd.String() + " Instead Of " + oldEnd.String())
+	}
+
+	prevSlot, err := SlotToHash(oldItem.Slot)
+
+	if err != nil {
+
+		return ReorgInfo{}, err
+	}
+
+	newSlot, err := SlotToHash(newItem.Slot)
+
+	if err != nil {
+
+		return ReorgInfo{}, err
+	}
+
+	reorgInfo := ReorgInfo{
+		Label:    oldItem.Label,
+		Type:     oldItem.Type,
+		PrevSlot: prevSlot,
+		NewSlot:  newSlot,
+		Gap:      true,
+	}
+
+	if !IsTypeEqual(oldItem.Type, newItem.Type, oldLayout.Types, newLayout.Types) {
+
+		reorgInfo.NewType = newItem.Type
+	}
+
+	setDeclaringContracts(&reorgInfo, oldItem, newItem, oldLayout, newLayout)
+
+	return reorgInfo, nil
+}
+
+// function to check that the old slots of a storage gap are zero. A gap only reserves slots for variables that are
+// added later, so its contents are not moved and nonzero data inside it would be lost
+func (s *StorageReorganizer) ReorganizeStorageGap(reorgMessage ReorgInfo) error {
+
+	dataType, found := s.dataTypes[reorgMessage.Type]
+
+	if !found {
+
+		return errors.New("Type not found " + reorgMessage.Type)
+	}
+
+	numberOfSlots := (dataType.PrevNumberOfBytes + 31) / 32
+
+	for i := uint64(0); i < numberOfSlots; i++ {
+
+		key := common.BigToHash(new(big.Int).Add(reorgMessage.PrevSlot.Big(), new(big.Int).SetUint64(i)))
+
+		if s.GetCommitedState(key) != (common.Hash{}) {
+
+			return errors.New("Nonzero Data Inside Storage Gap " + reorgMessage.Label + " At Slot " + key.Big().String())
+		}
+	}
+
+	return nil
+}
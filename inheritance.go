@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// struct that describes how the variables declared by a contract of an inheritance chain move
+type BaseMove struct {
+	Contract    string
+	NewContract string   // name of the contract in the new layout if it was renamed
+	PrevSlot    *big.Int // first slot of the moved variables of the contract in the old layout
+	NewSlot     *big.Int // first slot of the moved variables of the contract in the new layout
+	Variables   int
+	Reordered   bool // set if the variables of the contract do not move by the same number of slots
+}
+
+// function to get the name of the contract that declares a storage object without the path of its source, which
+// differs between the old and the new source
+func getContractName(item StorageItem) string {
+
+	return item.Contract[strings.LastIndex(item.Contract, ":")+1:]
+}
+
+// function to get the names of the contracts that declare the storage objects of a layout in the order of the layout,
+// together with the labels of the objects that every contract declares
+func getContractLabels(layout *StorageLayout) ([]string, map[string]map[string]bool) {
+
+	contractNames := make([]string, 0)
+	labels := make(map[string]map[string]bool)
+
+	for _, item := range layout.Storage {
+
+		contractName := getContractName(item)
+
+		if _, found := labels[contractName]; !found {
+
+			contractNames = append(contractNames, contractName)
+			labels[contractName] = make(map[string]bool)
+		}
+
+		labels[contractName][item.Label] = true
+	}
+
+	return contractNames, labels
+}
+
+// function to find the contracts of the old layout that are renamed in the new layout, it returns the new name of
+// every renamed contract. A contract that is missing from the new layout is renamed to the first contract that is
+// missing from the old layout and declares all its variables, so the renamed contract may add variables. A removed
+// base is not renamed to an added base that only shares some of its variable names
+func getRenamedContracts(oldLayout, newLayout *StorageLayout) map[string]string {
+
+	oldContractNames, oldLabels := getContractLabels(oldLayout)
+	newContractNames, newLabels := getContractLabels(newLayout)
+	renamedContracts := make(map[string]string)
+	renamed := make(map[string]bool)
+
+	for _, oldContractName := range oldContractNames {
+
+		if _, found := newLabels[oldContractName]; found {
+
+			continue
+		}
+
+		for _, newContractName := range newContractNames {
+
+			if _, found := oldLabels[newContractName]; found || renamed[newContractName] {
+
+				continue
+			}
+
+			declaresAll := true
+
+			for label := range oldLabels[oldContractName] {
+
+				declaresAll = declaresAll && newLabels[newContractName][label]
+			}
+
+			if declaresAll {
+
+				renamedContracts[oldContractName] = newContractName
+				renamed[newContractName] = true
+				break
+			}
+		}
+	}
+
+	return renamedContracts
+}
+
+// function to check if the variables of a layout are declared by several contracts of an inheritance chain.
+// Namespaced structs are not part of the chain, they are stored at their own roots
+func isInheritanceChain(layout *StorageLayout) bool {
+
+	contractName := ""
+
+	for _, item := range layout.Storage {
+
+		if item.Namespace != "" {
+
+			continue
+		}
+
+		if contractName != "" && getContractName(item) != contractName {
+
+			return true
+		}
+
+		contractName = getContractName(item)
+	}
+
+	return false
+}
+
+// function to pair the storage objects of the old layout with the storage objects of the new layout, it returns the
+// index of the paired new object for the index of every paired old object. Objects are paired by the contract that
+// declares them and their label first, so the variables of the base contracts are found when the inheritance order
+// changes or a base contract is added and private variables with the same name in different bases, like the __gap of
+// every base, are not mixed up. The remaining objects are paired by their label in the order of the layouts, in
+// inheritance chains only if they belong to a renamed contract, see getRenamedContracts. Other objects are not paired,
+// e.g. the variables of a removed base are dropped even if an added base declares variables with the same names
+func PairStorageItems(oldLayout, newLayout *StorageLayout) map[int]int {
+
+	pairs := make(map[int]int)
+	pairedNewItems := make(map[int]bool)
+	renamedContracts := getRenamedContracts(oldLayout, newLayout)
+
+	// the variables of a single contract may be paired with the variables of any contract, e.g. of another account
+	isChain := isInheritanceChain(oldLayout) && isInheritanceChain(newLayout)
+
+	for i, oldItem := range oldLayout.Storage {
+
+		for j, newItem := range newLayout.Storage {
+
+			if !pairedNewItems[j] && oldItem.Label == newItem.Label && getContractName(oldItem) == getContractName(newItem) {
+
+				pairs[i] = j
+				pairedNewItems[j] = true
+				break
+			}
+		}
+	}
+
+	for i, oldItem := range oldLayout.Storage {
+
+		if _, found := pairs[i]; found {
+
+			continue
+		}
+
+		for j, newItem := range newLayout.Storage {
+
+			if !pairedNewItems[j] && oldItem.Label == newItem.Label && (!isChain || renamedContracts[getContractName(oldItem)] == getContractName(newItem)) {
+
+				pairs[i] = j
+				pairedNewItems[j] = true
+				break
+			}
+		}
+	}
+
+	return pairs
+}
+
+// function to record the contracts that declare a pair of storage objects in its reorganization message. The contracts
+// are only recorded for inheritance chains, the variables of a single contract are all declared by the same contract
+func setDeclaringContracts(reorgInfo *ReorgInfo, oldItem, newItem StorageItem, oldLayout, newLayout *StorageLayout) {
+
+	if !isInheritanceChain(oldLayout) && !isInheritanceChain(newLayout) {
+
+		return
+	}
+
+	reorgInfo.Contract = getContractName(oldItem)
+
+	if getContractName(newItem) != reorgInfo.Contract {
+
+		reorgInfo.NewContract = getContractName(newItem)
+	}
+}
+
+// function to group the moves of a plan by the contracts that declare the variables, in the order of the plan. The
+// first slots of the variables of a contract show where the contract moves in the inheritance chain. Storage gaps
+// shrink when variables are added before them, so they are not counted
+func GetBaseMoves(reorgInfos []ReorgInfo) []BaseMove {
+
+	baseMoves := make([]BaseMove, 0)
+	indices := make(map[string]int)
+	shifts := make(map[string]*big.Int)
+
+	for _, reorgInfo := range reorgInfos {
+
+		if reorgInfo.Contract == "" || reorgInfo.IsComputed() || reorgInfo.Gap {
+
+			continue
+		}
+
+		shift := new(big.Int).Sub(reorgInfo.NewSlot.Big(), reorgInfo.PrevSlot.Big())
+		index, found := indices[reorgInfo.Contract]
+
+		if !found {
+
+			indices[reorgInfo.Contract] = len(baseMoves)
+			shifts[reorgInfo.Contract] = shift
+
+			baseMoves = append(baseMoves, BaseMove{
+				Contract:    reorgInfo.Contract,
+				NewContract: reorgInfo.NewContract,
+				PrevSlot:    reorgInfo.PrevSlot.Big(),
+				NewSlot:     reorgInfo.NewSlot.Big(),
+				Variables:   1,
+			})
+
+			continue
+		}
+
+		baseMove := &baseMoves[index]
+		baseMove.Variables++
+		baseMove.Reordered = baseMove.Reordered || shift.Cmp(shifts[reorgInfo.Contract]) != 0
+
+		if reorgInfo.PrevSlot.Big().Cmp(baseMove.PrevSlot) < 0 {
+
+			baseMove.PrevSlot = reorgInfo.PrevSlot.Big()
+		}
+
+		if reorgInfo.NewSlot.Big().Cmp(baseMove.NewSlot) < 0 {
+
+			baseMove.NewSlot = reorgInfo.NewSlot.Big()
+		}
+	}
+
+	return baseMoves
+}
+
+// function to describe the move of a contract of an inheritance chain
+func (m BaseMove) String() string {
+
+	contractName := m.Contract
+
+	if m.NewContract != "" {
+
+		contractName += " -> " + m.NewContract
+	}
+
+	variables := "variables"
+
+	if m.Variables == 1 {
+
+		variables = "variable"
+	}
+
+	description := fmt.Sprintf("%s: %d %s from slot %s --> slot %s", contractName, m.Variables, variables, m.PrevSlot, m.NewSlot)
+
+	if m.Reordered {
+
+		description += ", reordered"
+	}
+
+	return description
+}
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// function to check if a reorganization message moves the data of an array into a shorter array, which drops the
+// elements that do not fit
+func isNarrowingResize(reorgInfo ReorgInfo, dataTypes map[string]DataType) bool {
+
+	dataType := dataTypes[reorgInfo.Type]
+	newDataType := dataTypes[reorgInfo.NewType]
+
+	if dataType.Base == "" || newDataType.Base == "" || newDataType.Encoding != "inplace" {
+
+		return false
+	}
+
+	// the length of a dynamic array is only known at runtime, so it may not fit into a fixed size array
+	if dataType.Encoding != "inplace" {
+
+		return true
+	}
+
+	prevLength, err := GetArrayLength(dataType.Label)
+
+	if err != nil {
+
+		return true
+	}
+
+	newLength, err := GetArrayLength(newDataType.Label)
+
+	return err != nil || newLength < prevLength
+}
+
+// function to check if the old value at the given position is moved by a reorganization message that copies data
+func isMoved(reorgInfos []ReorgInfo, typeName string, slot common.Hash, offset uint64) bool {
+
+	for _, reorgInfo := range reorgInfos {
+
+		if !reorgInfo.IsComputed() && reorgInfo.Type == typeName && reorgInfo.PrevSlot == slot && reorgInfo.PrevOffset == offset {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// function to invert the translation table of an enum. Members that were added to the new enum are translated to -1
+// since their values can not be present in the storage after the reorganization
+func invertEnumMapping(enumMapping []int64) []int64 {
+
+	if enumMapping == nil {
+
+		return nil
+	}
+
+	length := int64(0)
+
+	for _, newValue := range enumMapping {
+
+		if newValue+1 > length {
+
+			length = newValue + 1
+		}
+	}
+
+	inverse := make([]int64, length)
+
+	for i := range inverse {
+
+		inverse[i] = -1
+	}
+
+	for oldValue, newValue := range enumMapping {
+
+		if newValue >= 0 {
+
+			inverse[newValue] = int64(oldValue)
+		}
+	}
+
+	return inverse
+}
+
+// function to find an input of an added struct member that is not moved, so the value it was computed from is lost
+func findDroppedMemberInput(dataType DataType) (Member, TransformInput, bool) {
+
+	for _, addedMember := range dataType.AddedMembers {
+
+		for _, input := range addedMember.Inputs {
+
+			found := false
+
+			for _, member := range dataType.Members {
+
+				found = found || (member.Type == input.Type && member.PrevSlot == input.PrevSlot && member.PrevOffset == input.PrevOffset)
+			}
+
+			if !found {
+
+				return addedMember, input, true
+			}
+		}
+	}
+
+	return Member{}, TransformInput{}, false
+}
+
+// function to add a data type and the types of its elements, values and members to the selected types. It returns
+// false if one of them computes an added struct member from a member that is not moved, so values of the type can not
+// be restored
+func selectDataTypes(typeName string, dataTypes map[string]DataType, selected map[string]bool) bool {
+
+	dataType, found := dataTypes[typeName]
+
+	if !found || selected[typeName] {
+
+		return true
+	}
+
+	selected[typeName] = true
+
+	if _, _, dropped := findDroppedMemberInput(dataType); dropped {
+
+		return false
+	}
+
+	lossless := selectDataTypes(dataType.Base, dataTypes, selected) && selectDataTypes(dataType.Key, dataTypes, selected) && selectDataTypes(dataType.Value, dataTypes, selected)
+
+	for _, member := range dataType.Members {
+
+		lossless = selectDataTypes(member.Type, dataTypes, selected) && lossless
+	}
+
+	return lossless
+}
+
+// function to check if a reorganization message moves a mapping without keys, so the values of the mapping are
+// dropped. A mapping without keys that keeps its slot and its type keeps its values in place
+func dropsMappingValues(reorgInfo ReorgInfo, dataTypes map[string]DataType) bool {
+
+	return IsMappingEncoding(dataTypes[reorgInfo.Type].Encoding) && len(reorgInfo.Keys) == 0 && (reorgInfo.PrevSlot != reorgInfo.NewSlot || reorgInfo.NewType != "")
+}
+
+// function to split a plan into the part whose old values can be restored by the inverse plan and the labels of the
+// variables whose old values can not be restored. Transformed variables and the inputs of transforms are not
+// invertible unless they are copied as well, as are variables that are moved to or read from other accounts, narrowed
+// arrays, moved mappings without keys and structs whose added members are computed from removed members. Archived members
+// are not moved back, like removed members, and initial values do not hold old values, so both are left out
+func SplitInvertibleReorgInfos(reorgInfos []ReorgInfo, dataTypes []DataType) ([]ReorgInfo, []DataType, []string) {
+
+	dataTypesMap := make(map[string]DataType)
+
+	for _, dataType := range dataTypes {
+
+		dataTypesMap[dataType.Type] = dataType
+	}
+
+	invertibleReorgInfos := make([]ReorgInfo, 0, len(reorgInfos))
+	nonInvertible := make([]string, 0)
+	selected := make(map[string]bool)
+
+	for _, reorgInfo := range reorgInfos {
+
+		if reorgInfo.IsTransformed() {
+
+			nonInvertible = appendLabel(nonInvertible, reorgInfo.Label)
+
+			// inputs that are also copied are restored by their own reorganization messages
+			for _, input := range reorgInfo.Inputs {
+
+				if !isMoved(reorgInfos, input.Type, input.PrevSlot, input.PrevOffset) {
+
+					nonInvertible = appendLabel(nonInvertible, input.Label)
+				}
+			}
+
+			continue
+
+		} else if reorgInfo.IsComputed() {
+
+			continue
+		}
+
+		typeSelected := make(map[string]bool)
+		lossless := selectDataTypes(reorgInfo.Type, dataTypesMap, typeSelected)
+
+		if reorgInfo.NewType != "" {
+
+			lossless = selectDataTypes(reorgInfo.NewType, dataTypesMap, typeSelected) && lossless
+		}
+
+		if !lossless || reorgInfo.Account != nil || reorgInfo.Source != nil || (reorgInfo.NewType != "" && !reorgInfo.Gap && isNarrowingResize(reorgInfo, dataTypesMap)) || dropsMappingValues(reorgInfo, dataTypesMap) {
+
+			nonInvertible = appendLabel(nonInvertible, reorgInfo.Label)
+			continue
+		}
+
+		for typeName := range typeSelected {
+
+			selected[typeName] = true
+		}
+
+		invertibleReorgInfos = append(invertibleReorgInfos, reorgInfo)
+	}
+
+	invertibleDataTypes := make([]DataType, 0, len(selected))
+
+	for _, dataType := range dataTypes {
+
+		if selected[dataType.Type] {
+
+			dataType.ArchivedMembers = nil
+			invertibleDataTypes = append(invertibleDataTypes, dataType)
+		}
+	}
+
+	return invertibleReorgInfos, invertibleDataTypes, nonInvertible
+}
+
+// function to add a label to a list of labels unless it is already listed
+func appendLabel(labels []string, label string) []string {
+
+	for _, listed := range labels {
+
+		if listed == label {
+
+			return labels
+		}
+	}
+
+	return append(labels, label)
+}
+
+// function to check if a field of a layout belongs to one of the given variables, e.g. owner.score to owner
+func isFieldOf(field string, labels []string) bool {
+
+	for _, label := range labels {
+
+		if field == label || strings.HasPrefix(field, label+".") || strings.HasPrefix(field, label+"[") {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+var arrayIndexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// function to compare the storage restored by the inverse of a plan with the old storage. The bytes of the excluded
+// fields, e.g. the variables that can not be inverted, and the data of their dynamic arrays and bytes are not compared.
+// The slots of the values of mappings can not be told apart, so they are only compared if no excluded field of the old
+// or the new layout is a mapping
+func CompareRestoredStorage(oldLayout, newLayout *StorageLayout, oldStorage, restoredStorage map[common.Hash]common.Hash, excluded []string) error {
+
+	slotMap, err := NewSlotMap(oldLayout)
+
+	if err != nil {
+
+		return err
+	}
+
+	segments, err := getDataSegments(oldLayout.Types, slotMap, oldStorage)
+
+	if err != nil {
+
+		return err
+	}
+
+	layoutSlots, err := GetLayoutSlots(oldLayout, oldStorage)
+
+	if err != nil {
+
+		return err
+	}
+
+	excludedBytes := make(map[common.Hash]uint32)
+	excludesMapping := false
+
+	// the values of an excluded mapping of the new layout are kept by the inverse if another mapping stays in place
+	for _, item := range newLayout.Storage {
+
+		excludesMapping = excludesMapping || (isFieldOf(item.Label, excluded) && IsMappingEncoding(newLayout.Types[item.Type].Encoding))
+	}
+
+	for _, segment := range segments {
+
+		// the fields of array elements are given for all elements, e.g. team[].score
+		if !isFieldOf(arrayIndexPattern.ReplaceAllString(segment.Label, "[]"), excluded) {
+
+			continue
+		}
+
+		excludesMapping = excludesMapping || IsMappingEncoding(oldLayout.Types[segment.Type].Encoding)
+
+		// a segment larger than a slot, e.g. of the data of bytes, continues in the following slots
+		for i := segment.Offset; i < segment.Offset+segment.Size; i++ {
+
+			key := common.BigToHash(new(big.Int).Add(segment.Slot, new(big.Int).SetUint64(i/32)))
+			excludedBytes[key] |= 1 << (i % 32)
+		}
+	}
+
+	keys := make(map[common.Hash]bool)
+
+	for key := range oldStorage {
+
+		keys[key] = true
+	}
+
+	for key := range restoredStorage {
+
+		keys[key] = true
+	}
+
+	for key := range keys {
+
+		if excludesMapping && !layoutSlots[key] {
+
+			continue
+		}
+
+		value, expected := restoredStorage[key], oldStorage[key]
+
+		for offset := uint64(0); offset < 32; offset++ {
+
+			if excludedBytes[key]&(1<<offset) == 0 && value[31-offset] != expected[31-offset] {
+
+				return errors.New("Slot " + key.Hex() + " Is " + value.Hex() + " Instead Of " + expected.Hex())
+			}
+		}
+	}
+
+	return nil
+}
+
+// generates the plan that moves the storage from the new layout back to the old layout, e.g. to roll back an upgrade.
+// The slots, offsets and sizes of the plan are swapped. Values that are computed by the plan are not moved back, so
+// the plan is refused if the values they were computed from are lost, and it is also refused if the plan drops data
+// by narrowing arrays, archiving struct members or dropping the values of mappings. Variables and struct members that
+// are not part of the plan are found with FindDroppedFields, see InvertLosslessReorgPlan
+func InvertReorgPlan(reorgInfos []ReorgInfo, dataTypes []DataType) ([]ReorgInfo, []DataType, error) {
+
+	dataTypesMap := make(map[string]DataType)
+
+	for _, dataType := range dataTypes {
+
+		dataTypesMap[dataType.Type] = dataType
+	}
+
+	inverseReorgInfos := make([]ReorgInfo, 0, len(reorgInfos))
+
+	for _, reorgInfo := range reorgInfos {
+
+		if reorgInfo.Account != nil {
+
+			return nil, nil, errors.New("Can Not Invert Plan, " + reorgInfo.Label + " Is Moved To Account " + reorgInfo.Account.Hex())
+		}
+
+		if reorgInfo.Source != nil {
+
+			return nil, nil, errors.New("Can Not Invert Plan, " + reorgInfo.Label + " Is Read From Account " + reorgInfo.Source.Hex())
+		}
+
+		if reorgInfo.IsComputed() {
+
+			// a transform without inputs replaces the old value of the variable
+			if reorgInfo.IsTransformed() && len(reorgInfo.Inputs) == 0 {
+
+				return nil, nil, errors.New("Can Not Invert Plan, The Old Value Of " + reorgInfo.Label + " Is Transformed")
+			}
+
+			for _, input := range reorgInfo.Inputs {
+
+				if !isMoved(reorgInfos, input.Type, input.PrevSlot, input.PrevOffset) {
+
+					return nil, nil, errors.New("Can Not Invert Plan, Input " + input.Label + " Of " + reorgInfo.Label + " Is Dropped")
+				}
+			}
+
+			continue
+		}
+
+		// the contents of a gap are not moved, so a shrinking gap drops nothing
+		if reorgInfo.NewType != "" && !reorgInfo.Gap && isNarrowingResize(reorgInfo, dataTypesMap) {
+
+			return nil, nil, errors.New("Can Not Invert Plan, The Elements Of " + reorgInfo.Label + " That Do Not Fit Are Dropped")
+		}
+
+		if dropsMappingValues(reorgInfo, dataTypesMap) {
+
+			return nil, nil, errors.New("Can Not Invert Plan, The Values Of Mapping " + reorgInfo.Label + " Are Dropped")
+		}
+
+		inverseReorgInfo := ReorgInfo{
+			Label:      reorgInfo.Label,
+			Type:       reorgInfo.Type,
+			PrevSlot:   reorgInfo.NewSlot,
+			NewSlot:    reorgInfo.PrevSlot,
+			PrevOffset: reorgInfo.NewOffset,
+			NewOffset:  reorgInfo.PrevOffset,
+			Keys:       reorgInfo.Keys,
+			Complete:   reorgInfo.Complete,
+			Gap:        reorgInfo.Gap,
+			Contract:   reorgInfo.Contract,
+		}
+
+		if reorgInfo.NewType != "" {
+
+			inverseReorgInfo.Type = reorgInfo.NewType
+			inverseReorgInfo.NewType = reorgInfo.Type
+		}
+
+		if reorgInfo.NewContract != "" {
+
+			inverseReorgInfo.Contract = reorgInfo.NewContract
+			inverseReorgInfo.NewContract = reorgInfo.Contract
+		}
+
+		inverseReorgInfos = append(inverseReorgInfos, inverseReorgInfo)
+	}
+
+	inverseDataTypes := make([]DataType, 0, len(dataTypes))
+
+	for _, dataType := range dataTypes {
+
+		if len(dataType.ArchivedMembers) != 0 {
+
+			return nil, nil, errors.New("Can Not Invert Plan, Members Of " + dataType.Label + " Are Archived")
+		}
+
+		if addedMember, input, found := findDroppedMemberInput(dataType); found {
+
+			return nil, nil, errors.New("Can Not Invert Plan, Input " + input.Label + " Of Member " + addedMember.Label + " Of " + dataType.Label + " Is Dropped")
+		}
+
+		inverseMembers := make([]Member, 0, len(dataType.Members))
+
+		for _, member := range dataType.Members {
+
+			inverseMembers = append(inverseMembers, Member{
+				Label:      member.Label,
+				PrevOffset: member.NewOffset,
+				NewOffset:  member.PrevOffset,
+				PrevSlot:   member.NewSlot,
+				NewSlot:    member.PrevSlot,
+				Type:       member.Type,
+			})
+		}
+
+		if dataType.Members == nil {
+
+			inverseMembers = nil
+		}
+
+		inverseDataTypes = append(inverseDataTypes, DataType{
+			Type:              dataType.Type,
+			Label:             dataType.Label,
+			Base:              dataType.Base,
+			Encoding:          dataType.Encoding,
+			PrevNumberOfBytes: dataType.NewNumberOfBytes,
+			NewNumberOfBytes:  dataType.PrevNumberOfBytes,
+			Members:           inverseMembers,
+			Key:               dataType.Key,
+			Value:             dataType.Value,
+			EnumMapping:       invertEnumMapping(dataType.EnumMapping),
+			UnderlyingType:    dataType.UnderlyingType,
+		})
+	}
+
+	return inverseReorgInfos, inverseDataTypes, nil
+}
+
+// generates the inverse of a plan like InvertReorgPlan and refuses plans that drop fields of the old layout, since
+// their data can not be restored by the inverse plan
+func InvertLosslessReorgPlan(oldLayout *StorageLayout, reorgInfos []ReorgInfo, dataTypes []DataType) ([]ReorgInfo, []DataType, error) {
+
+	droppedFields, err := FindDroppedFields(oldLayout, reorgInfos, dataTypes)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	if len(droppedFields) != 0 {
+
+		sort.Strings(droppedFields)
+		return nil, nil, fmt.Errorf("Can Not Invert Plan, The Plan Drops %v", droppedFields)
+	}
+
+	return InvertReorgPlan(reorgInfos, dataTypes)
+}
+
+// function to find the fields of the old layout whose data is not moved by a plan, e.g. removed variables and
+// removed struct members. A field is moved if a reorganization message copies its data, or if it is a struct whose
+// members are all moved
+func FindDroppedFields(oldLayout *StorageLayout, reorgInfos []ReorgInfo, dataTypes []DataType) ([]string, error) {
+
+	dataTypesMap := make(map[string]DataType)
+
+	for _, dataType := range dataTypes {
+
+		dataTypesMap[dataType.Type] = dataType
+	}
+
+	droppedFields := make([]string, 0)
+
+	for _, item := range oldLayout.Storage {
+
+		slot, ok := new(big.Int).SetString(item.Slot, 10)
+
+		if !ok {
+
+			return nil, errors.New("Invalid Slot " + item.Slot)
+		}
+
+		droppedFields = appendDroppedFields(droppedFields, oldLayout, reorgInfos, dataTypesMap, item.Label, item.Type, slot, item.Offset)
+	}
+
+	return droppedFields, nil
+}
+
+// function to add the paths of the parts of a field that are not moved by a plan to the dropped fields
+func appendDroppedFields(droppedFields []string, oldLayout *StorageLayout, reorgInfos []ReorgInfo, dataTypes map[string]DataType, path, typeName string, slot *big.Int, offset uint64) []string {
+
+	typeDescription := oldLayout.Types[typeName]
+
+	if isMoved(reorgInfos, typeName, common.BigToHash(slot), offset) {
+
+		return appendDroppedMembers(droppedFields, oldLayout, dataTypes, path, typeName)
+	}
+
+	// the members of a struct can be moved one by one, e.g. when a struct is flattened into variables
+	if len(typeDescription.Members) == 0 {
+
+		return append(droppedFields, path)
+	}
+
+	for _, member := range typeDescription.Members {
+
+		memberSlot, ok := new(big.Int).SetString(member.Slot, 10)
+
+		if !ok {
+
+			return append(droppedFields, path+"."+member.Label)
+		}
+
+		droppedFields = appendDroppedFields(droppedFields, oldLayout, reorgInfos, dataTypes, path+"."+member.Label, member.Type, new(big.Int).Add(slot, memberSlot), member.Offset)
+	}
+
+	return droppedFields
+}
+
+// function to add the paths of the struct members that are removed from a type that is moved as a whole to the dropped fields
+func appendDroppedMembers(droppedFields []string, oldLayout *StorageLayout, dataTypes map[string]DataType, path, typeName string) []string {
+
+	typeDescription := oldLayout.Types[typeName]
+
+	if typeDescription.Base != "" {
+
+		return appendDroppedMembers(droppedFields, oldLayout, dataTypes, path+"[]", typeDescription.Base)
+
+	} else if typeDescription.Value != "" {
+
+		return appendDroppedMembers(droppedFields, oldLayout, dataTypes, path+"[]", typeDescription.Value)
+	}
+
+	for _, member := range typeDescription.Members {
+
+		found := false
+
+		for _, movedMember := range dataTypes[typeName].Members {
+
+			found = found || movedMember.Label == member.Label
+		}
+
+		if !found {
+
+			droppedFields = append(droppedFields, path+"."+member.Label)
+			continue
+		}
+
+		droppedFields = appendDroppedMembers(droppedFields, oldLayout, dataTypes, path+"."+member.Label, member.Type)
+	}
+
+	return droppedFields
+}
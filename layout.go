@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// struct to represent a storage object or a struct member in the storage layout generated by solc --storage-layout
+type StorageItem struct {
+	AstId     int64  `json:"astId"`
+	Contract  string `json:"contract"`
+	Label     string `json:"label"`
+	Offset    uint64 `json:"offset"`
+	Slot      string `json:"slot"`
+	Type      string `json:"type"`
+	Namespace string `json:"namespace,omitempty"` // location of the namespace whose root is the slot, see namespaces.go
+}
+
+// struct to represent a data type in the storage layout generated by solc --storage-layout
+type TypeDescription struct {
+	Encoding       string        `json:"encoding"`
+	Label          string        `json:"label"`
+	NumberOfBytes  string        `json:"numberOfBytes"`
+	Base           string        `json:"base,omitempty"`
+	Key            string        `json:"key,omitempty"`
+	Value          string        `json:"value,omitempty"`
+	Members        []StorageItem `json:"members,omitempty"`
+	EnumMembers    []string      `json:"enumMembers,omitempty"`    // names of the members of an enum, solc does not include them in the layout
+	UnderlyingType string        `json:"underlyingType,omitempty"` // label of the underlying type of a user defined value type
+}
+
+// struct to represent the storage layout of a contract
+type StorageLayout struct {
+	Storage []StorageItem              `json:"storage"`
+	Types   map[string]TypeDescription `json:"types"`
+}
+
+func ReadStorageLayoutFromFile(filePath string) (*StorageLayout, error) {
+
+	var layout StorageLayout
+
+	if err := readJSONFile(filePath, &layout); err != nil {
+
+		return nil, err
+	}
+
+	if layout.Types == nil {
+
+		layout.Types = make(map[string]TypeDescription)
+	}
+
+	return &layout, nil
+}
+
+// converts the decimal slot number used by solc into a storage key
+func SlotToHash(slot string) (common.Hash, error) {
+
+	slotNumber, ok := new(big.Int).SetString(slot, 10)
+
+	if !ok {
+
+		return common.Hash{}, errors.New("Invalid Slot " + slot)
+	}
+
+	return common.BigToHash(slotNumber), nil
+}
+
+// function to get the size of a data type in the layout
+func (l *StorageLayout) GetNumberOfBytes(typeName string) (uint64, error) {
+
+	typeDescription, found := l.Types[typeName]
+
+	if !found {
+
+		return 0, errors.New("Type not found " + typeName)
+	}
+
+	numberOfBytes, ok := new(big.Int).SetString(typeDescription.NumberOfBytes, 10)
+
+	if !ok || !numberOfBytes.IsUint64() {
+
+		return 0, errors.New("Invalid Number Of Bytes For Type " + typeName)
+	}
+
+	return numberOfBytes.Uint64(), nil
+}
+
+// function to find a storage object by its label
+func (l *StorageLayout) FindItem(label string) (StorageItem, bool) {
+
+	for _, item := range l.Storage {
+
+		if item.Label == label {
+
+			return item, true
+		}
+	}
+
+	return StorageItem{}, false
+}
+
+// function to find a storage object or a member of a struct by its path, e.g. info.name. The slot of the returned
+// item is the absolute slot of the member and its label is the path
+func (l *StorageLayout) FindField(path string) (StorageItem, bool) {
+
+	labels := strings.Split(path, ".")
+	item, found := l.FindItem(labels[0])
+
+	if !found {
+
+		return StorageItem{}, false
+	}
+
+	slot, ok := new(big.Int).SetString(item.Slot, 10)
+
+	if !ok {
+
+		return StorageItem{}, false
+	}
+
+	for _, label := range labels[1:] {
+
+		found = false
+
+		for _, member := range l.Types[item.Type].Members {
+
+			if member.Label != label {
+
+				continue
+			}
+
+			memberSlot, ok := new(big.Int).SetString(member.Slot, 10)
+
+			if !ok {
+
+				return StorageItem{}, false
+			}
+
+			slot.Add(slot, memberSlot)
+			item = member
+			found = true
+
+			break
+		}
+
+		if !found {
+
+			return StorageItem{}, false
+		}
+	}
+
+	item.Label = path
+	item.Slot = slot.String()
+
+	return item, true
+}
+
+// check if struct is present inside type
+func IsStructPresent(typeName string, types map[string]TypeDescription) bool {
+
+	typeDescription, found := types[typeName]
+
+	if !found {
+
+		return false
+	}
+
+	if len(typeDescription.Members) != 0 {
+
+		return true
+	}
+
+	if typeDescription.Base != "" {
+
+		return IsStructPresent(typeDescription.Base, types)
+	}
+
+	return false
+}
+
+// check if two types are equal. The rules are the same as the ones used by the off-chain code analyzer
+func IsTypeEqual(oldTypeName, newTypeName string, oldTypes, newTypes map[string]TypeDescription) bool {
+
+	//check if type names are equal
+	if oldTypeName != newTypeName {
+
+		return false
+	}
+
+	oldType, found := oldTypes[oldTypeName]
+
+	if !found {
+
+		return false
+	}
+
+	newType, found := newTypes[newTypeName]
+
+	if !found {
+
+		return false
+	}
+
+	//if there is no struct inside either of them then check if they contain equal number of bytes
+	if !IsStructPresent(oldTypeName, oldTypes) && !IsStructPresent(newTypeName, newTypes) {
+
+		if oldType.NumberOfBytes != newType.NumberOfBytes {
+
+			return false
+		}
+	}
+
+	//check if both data types have same label and encoding
+	if oldType.Label != newType.Label || oldType.Encoding != newType.Encoding {
+
+		return false
+	}
+
+	//if one of the data types has a base and the other one does not they are not same
+	if (oldType.Base == "") != (newType.Base == "") {
+
+		return false
+	}
+
+	if oldType.Base != "" && !IsTypeEqual(oldType.Base, newType.Base, oldTypes, newTypes) {
+
+		return false
+	}
+
+	//mappings are equal only if their keys and values are equal
+	if oldType.Key != newType.Key {
+
+		return false
+	}
+
+	if oldType.Value != "" && !IsTypeEqual(oldType.Value, newType.Value, oldTypes, newTypes) {
+
+		return false
+	}
+
+	//if one of the data types has members and the other one does not they are not same
+	if (len(oldType.Members) == 0) != (len(newType.Members) == 0) {
+
+		return false
+	}
+
+	//if both have members check if there is at least one matching member
+	if len(oldType.Members) != 0 {
+
+		newMembers := make(map[string]StorageItem)
+
+		for _, member := range newType.Members {
+
+			newMembers[member.Label] = member
+		}
+
+		foundMatchingMembers := false
+
+		for _, member := range oldType.Members {
+
+			if newMember, found := newMembers[member.Label]; found && IsTypeEqual(member.Type, newMember.Type, oldTypes, newTypes) {
+
+				foundMatchingMembers = true
+			}
+		}
+
+		if !foundMatchingMembers {
+
+			return false
+		}
+	}
+
+	return true
+}
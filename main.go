@@ -9,6 +9,8 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -28,17 +30,41 @@ const (
 	reset   = "\033[0m"
 )
 
-// DummyStateDB to simulate ethereum storage
+// DummyStateDB to simulate ethereum storage. The tests reorganize the account at the zero address, the other accounts
+// receive or provide parts of its storage, see accounts.go
 type DummyStateDB struct {
-	Storage map[common.Hash]common.Hash
+	Storage map[common.Address]map[common.Hash]common.Hash
+}
+
+// function to get the accounts of the state, sorted by their addresses
+func (s *DummyStateDB) GetAccounts() []common.Address {
+
+	accounts := make([]common.Address, 0, len(s.Storage))
+
+	for addr := range s.Storage {
+
+		accounts = append(accounts, addr)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return bytes.Compare(accounts[i][:], accounts[j][:]) < 0 })
+
+	return accounts
 }
 
 // Helper function to print storage for debugging purpose
 func (s *DummyStateDB) PrintStorage(color string) {
 
-	for key, val := range s.Storage {
+	for _, addr := range s.GetAccounts() {
 
-		fmt.Println(color + fmt.Sprintf("%s : %s", key.Hex(), val.Hex()) + reset)
+		if addr != (common.Address{}) && len(s.Storage[addr]) != 0 {
+
+			fmt.Println(color + "Account " + addr.Hex() + ":" + reset)
+		}
+
+		for key, val := range s.Storage[addr] {
+
+			fmt.Println(color + fmt.Sprintf("%s : %s", key.Hex(), val.Hex()) + reset)
+		}
 	}
 
 }
@@ -46,32 +72,43 @@ func (s *DummyStateDB) PrintStorage(color string) {
 // Helper function to check if storage of two DummyStateDBs are equal. Used for debugging purposes
 func (s *DummyStateDB) IsStorageEqual(other *DummyStateDB) error {
 
-	for otherKey, otherVal := range other.Storage {
+	for _, addr := range append(s.GetAccounts(), other.GetAccounts()...) {
 
-		if val, found := s.Storage[otherKey]; !found {
+		// the slots of the other accounts are reported with their account
+		account := ""
 
-			return errors.New("Key Not Found In This State " + otherKey.Hex())
+		if addr != (common.Address{}) {
 
-		} else {
+			account = " Of Account " + addr.Hex()
+		}
+
+		for otherKey, otherVal := range other.Storage[addr] {
 
-			if !bytes.Equal(otherVal[:], val[:]) {
+			if val, found := s.Storage[addr][otherKey]; !found {
 
-				return errors.New("Mismatch For Key " + otherKey.Hex())
+				return errors.New("Key Not Found In This State " + otherKey.Hex() + account)
+
+			} else {
+
+				if !bytes.Equal(otherVal[:], val[:]) {
+
+					return errors.New("Mismatch For Key " + otherKey.Hex() + account)
+				}
 			}
 		}
-	}
 
-	for key, val := range s.Storage {
+		for key, val := range s.Storage[addr] {
 
-		if otherVal, found := other.Storage[key]; !found {
+			if otherVal, found := other.Storage[addr][key]; !found {
 
-			return errors.New("Key Not Found In Other State " + key.Hex())
+				return errors.New("Key Not Found In Other State " + key.Hex() + account)
 
-		} else {
+			} else {
 
-			if !bytes.Equal(otherVal[:], val[:]) {
+				if !bytes.Equal(otherVal[:], val[:]) {
 
-				return errors.New("Mismatch For Key " + key.Hex())
+					return errors.New("Mismatch For Key " + key.Hex() + account)
+				}
 			}
 		}
 	}
@@ -82,7 +119,7 @@ func (s *DummyStateDB) IsStorageEqual(other *DummyStateDB) error {
 // Gets a storage slot given it's key
 func (s *DummyStateDB) GetState(addr common.Address, key common.Hash) common.Hash {
 
-	return s.Storage[key]
+	return s.Storage[addr][key]
 }
 
 // Sets a storage slot given the key of the slot and the value to be set
@@ -90,10 +127,15 @@ func (s *DummyStateDB) SetState(addr common.Address, key, val common.Hash) {
 
 	if val == (common.Hash{}) {
 
-		delete(s.Storage, key)
+		delete(s.Storage[addr], key)
 	} else {
 
-		s.Storage[key] = val
+		if _, found := s.Storage[addr]; !found {
+
+			s.Storage[addr] = make(map[common.Hash]common.Hash)
+		}
+
+		s.Storage[addr][key] = val
 	}
 
 }
@@ -103,7 +145,25 @@ func (s *DummyStateDB) SetState(addr common.Address, key, val common.Hash) {
 // as a map
 func (s *DummyStateDB) GetStorageAsMap(addr common.Address) map[common.Hash]common.Hash {
 
-	return s.Storage
+	if _, found := s.Storage[addr]; !found {
+
+		s.Storage[addr] = make(map[common.Hash]common.Hash)
+	}
+
+	return s.Storage[addr]
+}
+
+// sets the storage of an account of the state
+func (s *DummyStateDB) SetAccountStorage(addr common.Address, storageSlots *map[common.Hash]StorageSlot) {
+
+	storage := make(map[common.Hash]common.Hash)
+
+	for _, slot := range *storageSlots {
+
+		storage[slot.Key] = slot.Value
+	}
+
+	s.Storage[addr] = storage
 }
 
 // This is the dummy implementation of a method that we implemented in the go-etehreum source code
@@ -124,40 +184,89 @@ type StorageSlot struct {
 
 // struct that holds all the info required to reorganize storage slots
 type ReorgInfo struct {
-	Type       string      `json:"type"`
-	PrevSlot   common.Hash `json:"oldSlot"`
-	NewSlot    common.Hash `json:"newSlot"`
-	PrevOffset uint64      `json:"oldOffset"`
-	NewOffset  uint64      `json:"newOffset"`
+	Label        string            `json:"label"`
+	Type         string            `json:"type"`
+	PrevSlot     common.Hash       `json:"oldSlot"`
+	NewSlot      common.Hash       `json:"newSlot"`
+	PrevOffset   uint64            `json:"oldOffset"`
+	NewOffset    uint64            `json:"newOffset"`
+	InitialValue json.RawMessage   `json:"initialValue,omitempty"` // set for variables that are only present in the new layout
+	NewType      string            `json:"newType,omitempty"`      // type in the new layout if it differs from the old type
+	Transform    string            `json:"transform,omitempty"`    // name of the transform that computes the new value
+	Inputs       []TransformInput  `json:"inputs,omitempty"`       // old variables passed to the transform or referenced by the expression
+	Expression   string            `json:"expression,omitempty"`   // expression that computes the new value, see expression.go
+	Keys         []json.RawMessage `json:"keys,omitempty"`         // keys of a mapping whose values are reorganized
+	Complete     bool              `json:"complete,omitempty"`     // set if the keys of a mapping are all the keys that hold values, see mapping.go
+	Truncate     string            `json:"truncate,omitempty"`     // policy for the dropped elements of a shrinking fixed size array
+	Gap          bool              `json:"gap,omitempty"`          // set for storage gaps, whose contents are not moved, see gaps.go
+	Contract     string            `json:"contract,omitempty"`     // contract that declares the variable in an inheritance chain, see inheritance.go
+	NewContract  string            `json:"newContract,omitempty"`  // contract that declares the variable in the new layout if it differs
+	Account      *common.Address   `json:"account,omitempty"`      // account that receives the variable, the reorganized account if nil, see accounts.go
+	Source       *common.Address   `json:"source,omitempty"`       // account that the variable is read from, the reorganized account if nil, see merge.go
+}
+
+// function to check if the new value of a variable is computed from old values by a transform or an expression
+func (r ReorgInfo) IsTransformed() bool {
+
+	return r.Transform != "" || r.Expression != ""
+}
+
+// function to check if the new value of a variable is computed instead of being copied from the old location
+func (r ReorgInfo) IsComputed() bool {
+
+	return r.InitialValue != nil || r.IsTransformed()
 }
 
 // struct that holds info of solidity struct type's members
 type Member struct {
-	PrevOffset uint64      `json:"oldOffset"`
-	NewOffset  uint64      `json:"newOffset"`
-	PrevSlot   common.Hash `json:"oldSlot"`
-	NewSlot    common.Hash `json:"newSlot"`
-	Type       string      `json:"type"`
+	Label        string           `json:"label"`
+	PrevOffset   uint64           `json:"oldOffset"`
+	NewOffset    uint64           `json:"newOffset"`
+	PrevSlot     common.Hash      `json:"oldSlot"`
+	NewSlot      common.Hash      `json:"newSlot"`
+	Type         string           `json:"type"`
+	InitialValue json.RawMessage  `json:"initialValue,omitempty"` // set for added members, see structs.go
+	Transform    string           `json:"transform,omitempty"`
+	Expression   string           `json:"expression,omitempty"`
+	Inputs       []TransformInput `json:"inputs,omitempty"` // old members of the same struct, relative to the struct
 }
 
 // struct to represent data types
 type DataType struct {
 	Type              string   `json:"type"`
+	Label             string   `json:"label"`
 	Base              string   `json:"base"`
 	Encoding          string   `json:"encoding"`
 	PrevNumberOfBytes uint64   `json:"oldNumberOfBytes"`
 	NewNumberOfBytes  uint64   `json:"newNumberOfBytes"`
 	Members           []Member `json:"members"`
+	Key               string   `json:"key,omitempty"`             // key type of a mapping
+	Value             string   `json:"value,omitempty"`           // value type of a mapping
+	EnumMapping       []int64  `json:"enumMapping,omitempty"`     // new value of every old enum value, -1 if the member was removed
+	UnderlyingType    string   `json:"underlyingType,omitempty"`  // label of the underlying type of a user defined value type
+	AddedMembers      []Member `json:"addedMembers,omitempty"`    // members added to a struct whose values are computed
+	ArchivedMembers   []Member `json:"archivedMembers,omitempty"` // members removed from a struct whose values are exported
 }
 
 // struct to reorganize storage trie of an ethereum smart contract address
 type StorageReorganizer struct {
 	state           *DummyStateDB
-	commitedStorage map[common.Hash]common.Hash // holds the storage of an account before reorganization
-	modifiedStorage map[common.Hash]common.Hash // holds the storage of an account before reorganization
+	commitedStorage map[common.Hash]common.Hash                    // holds the storage of an account before reorganization
+	modifiedStorage map[common.Address]map[common.Hash]common.Hash // holds the reorganized storage of every account written by the reorganization
 	reorgMessges    []ReorgInfo
 	dataTypes       map[string]DataType
 	addr            common.Address
+	account         common.Address                            // account written by the current reorganization message, see accounts.go
+	writtenBytes    map[common.Address]map[common.Hash]uint32 // bitmask of the bytes of each modified slot that were written by the reorganization
+	transforms      map[string]Transform
+	exportedValues  map[string]interface{} // values dropped by the reorganization that were exported instead of being lost
+	readKeys        map[common.Hash]bool   // slots of the old storage read by the reorganization, see GetOrphanedSlots
+	protectedSlots  map[common.Hash]bool   // slots kept as they are in proxy mode, see proxy.go
+	source          common.Address         // account read by the current reorganization message, see merge.go
+	sourceReadKeys  map[common.Address]map[common.Hash]bool
+	clearSources    bool                 // set if the storage of the sources is deleted by the commit
+	keepsMappings   bool                 // set if a mapping keeps its values in place, so Commit keeps the slots of its values
+	layoutSlots     map[common.Hash]bool // slots of the variables of the old layout and of their data, see SetOldLayout
 }
 
 // Initialization function for the storage reorganizer
@@ -175,6 +284,21 @@ func (s *StorageReorganizer) Init(currentState map[common.Hash]common.Hash, reor
 // function to get commited slot given key
 func (s *StorageReorganizer) GetCommitedState(key common.Hash) common.Hash {
 
+	// the variables of a merge are read from the storage of their source
+	if s.source != s.addr {
+
+		if _, found := s.sourceReadKeys[s.source]; !found {
+
+			s.sourceReadKeys[s.source] = make(map[common.Hash]bool)
+		}
+
+		s.sourceReadKeys[s.source][key] = true
+
+		return s.state.GetState(s.source, key)
+	}
+
+	s.readKeys[key] = true
+
 	if _, ok := s.commitedStorage[key]; !ok {
 
 		return common.Hash{}
@@ -184,22 +308,47 @@ func (s *StorageReorganizer) GetCommitedState(key common.Hash) common.Hash {
 
 }
 
-// function to get modified slot given key
+// function to get modified slot of the current account given key
 func (s *StorageReorganizer) GetModifiedState(key common.Hash) common.Hash {
 
-	if _, ok := s.modifiedStorage[key]; !ok {
+	if _, ok := s.modifiedStorage[s.account][key]; !ok {
 
 		return common.Hash{}
 	}
 
-	return s.modifiedStorage[key]
+	return s.modifiedStorage[s.account][key]
 
 }
 
-// function to set modified state given key and val
+// function to set modified state of the current account given key and val
 func (s *StorageReorganizer) SetModifiedState(key, val common.Hash) {
 
-	s.modifiedStorage[key] = val
+	if _, found := s.modifiedStorage[s.account]; !found {
+
+		s.modifiedStorage[s.account] = make(map[common.Hash]common.Hash)
+	}
+
+	s.modifiedStorage[s.account][key] = val
+}
+
+// function to mark the bytes of a modified slot from offset "from" up to offset "to" as written
+func (s *StorageReorganizer) MarkWritten(key common.Hash, from, to uint64) {
+
+	if _, found := s.writtenBytes[s.account]; !found {
+
+		s.writtenBytes[s.account] = make(map[common.Hash]uint32)
+	}
+
+	for offset := from; offset < to && offset < 32; offset++ {
+
+		s.writtenBytes[s.account][key] |= 1 << offset
+	}
+}
+
+// function to check if the byte at the given offset of a modified slot was written by the reorganization
+func (s *StorageReorganizer) IsWritten(key common.Hash, offset uint64) bool {
+
+	return s.writtenBytes[s.account][key]&(1<<offset) != 0
 }
 
 // function to check if data type is a struct
@@ -328,6 +477,26 @@ func (s *StorageReorganizer) IsEncodingBytes(dataType string) (bool, error) {
 	}
 }
 
+// function to check if the encoding of a data type is "mapping"
+func (s *StorageReorganizer) IsEncodingMapping(dataType string) (bool, error) {
+
+	if data, found := s.dataTypes[dataType]; found {
+
+		if data.Encoding == "mapping" {
+
+			return true, nil
+
+		} else {
+
+			return false, nil
+		}
+
+	} else {
+
+		return false, errors.New("Type not found")
+	}
+}
+
 // function to get the size of a data type
 func (s *StorageReorganizer) GetNumberOfBytes(typeName string) (uint64, uint64, error) {
 
@@ -347,8 +516,39 @@ func (s *StorageReorganizer) Reorganize() error {
 	// iterate over the reorg messages
 	for _, reorgMessage := range s.reorgMessges {
 
+		// initial values and transformed values are written after all the data has been moved
+		if reorgMessage.IsComputed() {
+
+			continue
+		}
+
+		s.account = s.GetAccount(reorgMessage)
+		s.source = s.GetSource(reorgMessage)
+
 		// check the encoding of a data type and call functions accordingly
-		if isInplace, err := s.IsEncodingInplace(reorgMessage.Type); err != nil {
+		if reorgMessage.Gap {
+
+			err := s.ReorganizeStorageGap(reorgMessage)
+
+			if err != nil {
+
+				return err
+			}
+
+		} else if isResize, err := s.IsArrayResize(reorgMessage); err != nil {
+
+			return err
+
+		} else if isResize {
+
+			err := s.ReorganizeArrayResize(reorgMessage)
+
+			if err != nil {
+
+				return err
+			}
+
+		} else if isInplace, err := s.IsEncodingInplace(reorgMessage.Type); err != nil {
 
 			return err
 
@@ -386,254 +586,262 @@ func (s *StorageReorganizer) Reorganize() error {
 				return err
 			}
 
+		} else if isMapping, err := s.IsEncodingMapping(reorgMessage.Type); err != nil {
+
+			return err
+
+		} else if isMapping {
+
+			err := s.ReorganizeMapping(reorgMessage)
+
+			if err != nil {
+
+				return err
+			}
+
+		} else if isVyper, err := s.IsEncodingVyper(reorgMessage.Type); err != nil {
+
+			return err
+
+		} else if isVyper {
+
+			err := s.ReorganizeVyper(reorgMessage)
+
+			if err != nil {
+
+				return err
+			}
+
 		} else {
 
 			return errors.New("Not implemented yet")
 		}
 	}
 
-	return nil
+	for _, reorgMessage := range s.reorgMessges {
 
-}
+		s.account = s.GetAccount(reorgMessage)
+		s.source = s.GetSource(reorgMessage)
 
-// The function iteratively searches through a type's hierarchy to retrieve its type, encoding, and whether it has a non-"inplace" encoding
-func (s *StorageReorganizer) ExtractUntilInplace(typeName string) (string, string, bool, error) {
+		if err := s.ReorganizeComputedValue(reorgMessage); err != nil {
 
-	curType := typeName
+			return err
+		}
+	}
 
-	for {
+	s.account = s.addr
+	s.source = s.addr
 
-		if dataType, found := s.dataTypes[curType]; found {
+	if err := s.checkTargetAccounts(); err != nil {
 
-			if dataType.Base == "" {
+		return err
+	}
 
-				return dataType.Type, dataType.Encoding, false, nil
+	return s.checkProtectedSlots()
 
-			} else {
+}
 
-				if dataType.Encoding != "inplace" {
+// function to write a value that is computed by a transform, an expression or an initial value
+func (s *StorageReorganizer) ReorganizeComputedValue(reorgMessage ReorgInfo) error {
 
-					return dataType.Type, dataType.Encoding, true, nil
+	if reorgMessage.Transform != "" {
 
-				} else {
+		return s.ReorganizeTransform(reorgMessage)
 
-					curType = dataType.Base
-				}
-			}
+	} else if reorgMessage.Expression != "" {
 
-		} else {
+		return s.ReorganizeExpression(reorgMessage)
 
-			return "", "", false, errors.New("Type not found")
-		}
+	} else if reorgMessage.InitialValue != nil {
+
+		return s.ReorganizeInitialValue(reorgMessage)
 	}
-}
 
-// checks if a data type contains struct inside it
-func (s *StorageReorganizer) ContainsStruct(typeName string) (bool, string, error) {
+	return nil
+}
 
-	curType := typeName
+// function to check if the value of an "inplace" data type can be copied byte by byte. Structs, enums whose values
+// are translated and arrays of types that store data outside of their slots have to be reorganized member by member
+// or element by element
+func (s *StorageReorganizer) IsCopyable(typeName string) (bool, error) {
 
-	for {
-		if dataType, found := s.dataTypes[curType]; found {
+	if dataType, found := s.dataTypes[typeName]; found {
 
-			if len(dataType.Members) != 0 {
+		if dataType.Encoding != "inplace" || len(dataType.Members) != 0 || len(dataType.EnumMapping) != 0 {
 
-				return true, curType, nil
-			} else {
+			return false, nil
 
-				if dataType.Base == "" {
+		} else if dataType.Base != "" {
 
-					return false, "", nil
-				} else {
-					curType = dataType.Base
-				}
-			}
-		} else {
-			return false, "", errors.New("Type not found")
+			return s.IsCopyable(dataType.Base)
 		}
+
+		return true, nil
+
+	} else {
+
+		return false, errors.New("Type not found " + typeName)
 	}
 }
 
-// Reorganizes data type with "inplace" encoding
+// Reorganizes data type with "inplace" encoding. Structs and arrays whose elements can not be copied are processed
+// recursively, so structs can contain other structs and arrays of structs at any depth
 func (s *StorageReorganizer) ReorganizeInplace(reorgMessage ReorgInfo) error {
 
-	prevNumberOfBytes, _, err := s.GetNumberOfBytes(reorgMessage.Type)
+	dataType, found := s.dataTypes[reorgMessage.Type]
 
-	if err != nil {
+	if !found {
 
-		return err
+		return errors.New("Type not found " + reorgMessage.Type)
 	}
 
-	prevSlotNumber := reorgMessage.PrevSlot.Big()
-	newSlotNumber := reorgMessage.NewSlot.Big()
-
-	typeName, encoding, found, err := s.ExtractUntilInplace(reorgMessage.Type)
+	isCopyable, err := s.IsCopyable(reorgMessage.Type)
 
 	if err != nil {
 
 		return err
 	}
 
-	structFound, structTypeName, err := s.ContainsStruct(reorgMessage.Type)
-
-	if err != nil {
+	if isCopyable {
 
-		return err
-	}
+		return s.CopyInplace(reorgMessage)
 
-	// if there is "dynamic_array" or "bytes" inside the data type then further processing is required
-	if found {
+	} else if dataType.Base != "" {
+		// the elements of the fixed size array are processed one by one
+		return s.ReorganizeFixedArray(reorgMessage)
 
-		if encoding == "dynamic_array" {
+	} else if len(dataType.Members) != 0 {
+		// the members of the struct are processed one by one
+		return s.ReorganizeStruct(reorgMessage)
+	}
 
-			for i := 0; i < int(prevNumberOfBytes/32); i++ {
+	// enum values are translated to the values of the reordered members instead of being copied
+	return s.ReorganizeEnum(reorgMessage)
+}
 
-				curOldSlotNumber := new(big.Int).Add(new(big.Int).SetInt64(int64(i)), prevSlotNumber)
+// copies a data type that does not contain struct or any other type that requires further processing from the prev slot to the new slot
+func (s *StorageReorganizer) CopyInplace(reorgMessage ReorgInfo) error {
 
-				curNewSlotNumber := new(big.Int).Add(new(big.Int).SetInt64(int64(i)), newSlotNumber)
+	if err := checkReorganizable(s.dataTypes[reorgMessage.Type]); err != nil {
 
-				err := s.ReorganizeDynamicArray(ReorgInfo{
-					Type:       typeName,
-					PrevSlot:   common.BytesToHash(curOldSlotNumber.Bytes()),
-					NewSlot:    common.BytesToHash(curNewSlotNumber.Bytes()),
-					PrevOffset: 0,
-					NewOffset:  0,
-				})
+		return err
+	}
 
-				if err != nil {
+	prevNumberOfBytes, _, err := s.GetNumberOfBytes(reorgMessage.Type)
 
-					return err
-				}
-			}
+	if err != nil {
 
-		} else if encoding == "bytes" {
+		return err
+	}
 
-			for i := 0; i < int(prevNumberOfBytes/32); i++ {
+	prevSlotNumber := reorgMessage.PrevSlot.Big()
+	newSlotNumber := reorgMessage.NewSlot.Big()
 
-				curOldSlotNumber := new(big.Int).Add(new(big.Int).SetInt64(int64(i)), prevSlotNumber)
+	var prevOffset, newOffset uint64
 
-				curNewSlotNumber := new(big.Int).Add(new(big.Int).SetInt64(int64(i)), newSlotNumber)
+	for prevOffset, newOffset = reorgMessage.PrevOffset, reorgMessage.NewOffset; prevOffset < prevNumberOfBytes+reorgMessage.PrevOffset; prevOffset, newOffset = prevOffset+1, newOffset+1 {
 
-				err := s.ReorganizeBytes(ReorgInfo{
-					Type:       typeName,
-					PrevSlot:   common.BytesToHash(curOldSlotNumber.Bytes()),
-					NewSlot:    common.BytesToHash(curNewSlotNumber.Bytes()),
-					PrevOffset: 0,
-					NewOffset:  0,
-				})
+		curOldSlotNumber := new(big.Int).Add(new(big.Int).SetUint64(prevOffset/32), prevSlotNumber)
 
-				if err != nil {
+		curNewSlotNumber := new(big.Int).Add(new(big.Int).SetUint64(newOffset/32), newSlotNumber)
 
-					return err
-				}
-			}
+		prevSlot := s.GetCommitedState(common.BytesToHash(curOldSlotNumber.Bytes()))
+		newSlot := s.GetModifiedState(common.BytesToHash(curNewSlotNumber.Bytes()))
 
-		} else {
+		newSlot[31-(newOffset%32)] = prevSlot[31-(prevOffset%32)]
 
-			return errors.New("Not implemented yet")
-		}
+		s.SetModifiedState(common.BytesToHash(curNewSlotNumber.Bytes()), newSlot)
+		s.MarkWritten(common.BytesToHash(curNewSlotNumber.Bytes()), newOffset%32, newOffset%32+1)
 
-		return nil
+	}
 
-	} else if structFound {
-		// if there is a struct inside the inplace data type the members of the struct need to be processed
-		prevStructSize, newStructSize, err := s.GetNumberOfBytes(structTypeName)
-		if err != nil {
-			return err
-		}
-		structDataType := s.dataTypes[structTypeName]
+	return nil
+}
 
-		curPrevSlot := reorgMessage.PrevSlot.Big()
-		curNewSlot := reorgMessage.NewSlot.Big()
+// Reorganizes the elements of a fixed size array one by one, according to the encoding of the base type
+func (s *StorageReorganizer) ReorganizeFixedArray(reorgMessage ReorgInfo) error {
 
-		// iterate based on the number of structs
-		for i := 0; i < int(prevNumberOfBytes)/int(prevStructSize); i++ {
+	dataType := s.dataTypes[reorgMessage.Type]
 
-			//iterate over the members of the struct
-			for _, member := range structDataType.Members {
+	length, err := GetArrayLength(dataType.Label)
 
-				memberDataType, exists := s.dataTypes[member.Type]
-				if !exists {
+	if err != nil {
 
-					return errors.New("Struct Member Not Found")
-				}
-				//process member according to data type
-				if memberDataType.Encoding == "inplace" {
-					err := s.ReorganizeInplace(ReorgInfo{
-						PrevSlot:   common.BigToHash(new(big.Int).Add(curPrevSlot, member.PrevSlot.Big())),
-						NewSlot:    common.BigToHash(new(big.Int).Add(curNewSlot, member.NewSlot.Big())),
-						PrevOffset: member.PrevOffset,
-						NewOffset:  member.NewOffset,
-						Type:       memberDataType.Type,
-					})
+		return err
+	}
 
-					if err != nil {
+	prevElementSize, newElementSize, err := s.GetNumberOfBytes(dataType.Base)
 
-						return err
-					}
+	if err != nil {
 
-				} else if memberDataType.Encoding == "dynamic_array" {
+		return err
+	}
 
-					err := s.ReorganizeDynamicArray(ReorgInfo{
-						PrevSlot:   common.BigToHash(new(big.Int).Add(curPrevSlot, member.PrevSlot.Big())),
-						NewSlot:    common.BigToHash(new(big.Int).Add(curNewSlot, member.NewSlot.Big())),
-						PrevOffset: member.PrevOffset,
-						NewOffset:  member.NewOffset,
-						Type:       memberDataType.Type,
-					})
+	for i := uint64(0); i < length; i++ {
 
-					if err != nil {
+		prevSlotIndex, prevOffset := GetElementPosition(prevElementSize, i)
+		newSlotIndex, newOffset := GetElementPosition(newElementSize, i)
 
-						return err
-					}
+		err := s.ReorganizeElement(ReorgInfo{
+			Label:      fmt.Sprintf("%s[%d]", reorgMessage.Label, i),
+			Type:       dataType.Base,
+			PrevSlot:   common.BigToHash(new(big.Int).Add(reorgMessage.PrevSlot.Big(), new(big.Int).SetUint64(prevSlotIndex))),
+			NewSlot:    common.BigToHash(new(big.Int).Add(reorgMessage.NewSlot.Big(), new(big.Int).SetUint64(newSlotIndex))),
+			PrevOffset: prevOffset,
+			NewOffset:  newOffset,
+		})
 
-				} else if memberDataType.Encoding == "bytes" {
+		if err != nil {
 
-					err := s.ReorganizeBytes(ReorgInfo{
-						PrevSlot:   common.BigToHash(new(big.Int).Add(curPrevSlot, member.PrevSlot.Big())),
-						NewSlot:    common.BigToHash(new(big.Int).Add(curNewSlot, member.NewSlot.Big())),
-						PrevOffset: member.PrevOffset,
-						NewOffset:  member.NewOffset,
-						Type:       memberDataType.Type,
-					})
+			return err
+		}
+	}
 
-					if err != nil {
+	return nil
+}
 
-						return err
-					}
-				} else {
+// Reorganizes the members of a struct one by one, according to the encoding of their types. Afterwards the members
+// that were added to the struct are computed and the archived members are exported
+func (s *StorageReorganizer) ReorganizeStruct(reorgMessage ReorgInfo) error {
 
-					return errors.New("Unknown Encoding")
-				}
-			}
+	structDataType := s.dataTypes[reorgMessage.Type]
 
-			curPrevSlot = new(big.Int).Add(curPrevSlot, new(big.Int).SetUint64(prevStructSize/32))
-			curNewSlot = new(big.Int).Add(curNewSlot, new(big.Int).SetUint64(newStructSize/32))
-		}
+	curPrevSlot := reorgMessage.PrevSlot.Big()
+	curNewSlot := reorgMessage.NewSlot.Big()
 
-		return nil
+	//iterate over the members of the struct
+	for _, member := range structDataType.Members {
 
-	} else {
-		//if the data type does not contain struct or any other type that requires further processing then copy it from the prev slot to the new slot
-		var prevOffset, newOffset uint64
+		memberDataType, exists := s.dataTypes[member.Type]
 
-		for prevOffset, newOffset = reorgMessage.PrevOffset, reorgMessage.NewOffset; prevOffset < prevNumberOfBytes+reorgMessage.PrevOffset; prevOffset, newOffset = prevOffset+1, newOffset+1 {
+		if !exists {
 
-			curOldSlotNumber := new(big.Int).Add(new(big.Int).SetUint64(prevOffset/32), prevSlotNumber)
+			return errors.New("Struct Member Not Found")
+		}
 
-			curNewSlotNumber := new(big.Int).Add(new(big.Int).SetUint64(newOffset/32), newSlotNumber)
+		if memberDataType.Encoding == "mapping" {
 
-			prevSlot := s.GetCommitedState(common.BytesToHash(curOldSlotNumber.Bytes()))
-			newSlot := s.GetModifiedState(common.BytesToHash(curNewSlotNumber.Bytes()))
+			return errors.New("Mappings In Structs Are Not Supported")
+		}
 
-			newSlot[31-(newOffset%32)] = prevSlot[31-(prevOffset%32)]
+		//process member according to data type
+		err := s.ReorganizeElement(ReorgInfo{
+			Label:      reorgMessage.Label + "." + member.Label,
+			PrevSlot:   common.BigToHash(new(big.Int).Add(curPrevSlot, member.PrevSlot.Big())),
+			NewSlot:    common.BigToHash(new(big.Int).Add(curNewSlot, member.NewSlot.Big())),
+			PrevOffset: member.PrevOffset,
+			NewOffset:  member.NewOffset,
+			Type:       memberDataType.Type,
+		})
 
-			s.SetModifiedState(common.BytesToHash(curNewSlotNumber.Bytes()), newSlot)
+		if err != nil {
 
+			return err
 		}
-		return nil
 	}
 
+	//write the added members and export the archived members
+	return s.ReorganizeStructChanges(structDataType, curPrevSlot, curNewSlot, reorgMessage.Label)
 }
 
 func (s *StorageReorganizer) ReorganizeDynamicArray(reorgMessage ReorgInfo) error {
@@ -655,6 +863,7 @@ func (s *StorageReorganizer) ReorganizeDynamicArray(reorgMessage ReorgInfo) erro
 	}
 
 	s.SetModifiedState(reorgMessage.NewSlot, newSlot)
+	s.MarkWritten(reorgMessage.NewSlot, 0, 32)
 
 	//calculate the slot where data was stored previously and where data will be stored in the reorganized storage structure
 	prevDataSlot := common.BytesToHash(crypto.Keccak256(reorgMessage.PrevSlot[:]))
@@ -695,6 +904,7 @@ func (s *StorageReorganizer) ReorganizeDynamicArray(reorgMessage ReorgInfo) erro
 			for i := big.NewInt(0); i.Cmp(numberOfElements) < 0; i.Add(i, big.NewInt(1)) {
 
 				err := s.ReorganizeInplace(ReorgInfo{
+					Label:      fmt.Sprintf("%s[%s]", reorgMessage.Label, i),
 					PrevSlot:   common.BigToHash(new(big.Int).Add(prevDataSlot.Big(), new(big.Int).Mul(numberOfSlotsPerPrevElement, i))),
 					NewSlot:    common.BigToHash(new(big.Int).Add(newDataSlot.Big(), new(big.Int).Mul(numberOfSlotsPerNewElement, i))),
 					PrevOffset: 0,
@@ -737,6 +947,14 @@ func (s *StorageReorganizer) ReorganizeDynamicArray(reorgMessage ReorgInfo) erro
 
 				for j := uint64(0); j < 32/sizeOfElement; j++ {
 
+					// the last slot may be partly used, elements after the end of the array are not reorganized
+					elementIndex := new(big.Int).Add(new(big.Int).Mul(i, numberOfElementsPerSlot), new(big.Int).SetUint64(j))
+
+					if elementIndex.Cmp(numberOfElements) >= 0 {
+
+						break
+					}
+
 					err := s.ReorganizeInplace(ReorgInfo{
 						PrevSlot:   common.BigToHash(new(big.Int).Add(prevDataSlot.Big(), i)),
 						NewSlot:    common.BigToHash(new(big.Int).Add(newDataSlot.Big(), i)),
@@ -765,7 +983,8 @@ func (s *StorageReorganizer) ReorganizeDynamicArray(reorgMessage ReorgInfo) erro
 
 		for i := big.NewInt(0); i.Cmp(numberOfElements) < 0; i.Add(i, big.NewInt(1)) {
 
-			err := s.ReorganizeInplace(ReorgInfo{
+			err := s.ReorganizeDynamicArray(ReorgInfo{
+				Label:      fmt.Sprintf("%s[%s]", reorgMessage.Label, i),
 				PrevSlot:   common.BigToHash(new(big.Int).Add(prevDataSlot.Big(), i)),
 				NewSlot:    common.BigToHash(new(big.Int).Add(newDataSlot.Big(), i)),
 				PrevOffset: 0,
@@ -787,7 +1006,8 @@ func (s *StorageReorganizer) ReorganizeDynamicArray(reorgMessage ReorgInfo) erro
 
 		for i := big.NewInt(0); i.Cmp(numberOfElements) < 0; i.Add(i, big.NewInt(1)) {
 
-			err := s.ReorganizeInplace(ReorgInfo{
+			err := s.ReorganizeBytes(ReorgInfo{
+				Label:      fmt.Sprintf("%s[%s]", reorgMessage.Label, i),
 				PrevSlot:   common.BigToHash(new(big.Int).Add(prevDataSlot.Big(), i)),
 				NewSlot:    common.BigToHash(new(big.Int).Add(newDataSlot.Big(), i)),
 				PrevOffset: 0,
@@ -829,6 +1049,7 @@ func (s *StorageReorganizer) ReorganizeBytes(reorgMessage ReorgInfo) error {
 	}
 
 	s.SetModifiedState(reorgMessage.NewSlot, newSlot)
+	s.MarkWritten(reorgMessage.NewSlot, 0, 32)
 
 	//calculate the old data slot and new data slot
 	prevDataSlot := common.BytesToHash(crypto.Keccak256(reorgMessage.PrevSlot[:]))
@@ -861,6 +1082,7 @@ func (s *StorageReorganizer) ReorganizeBytes(reorgMessage ReorgInfo) error {
 			}
 
 			s.SetModifiedState(slotToBeCopiedTo, curNewSlot)
+			s.MarkWritten(slotToBeCopiedTo, 0, 32)
 
 		}
 
@@ -870,36 +1092,43 @@ func (s *StorageReorganizer) ReorganizeBytes(reorgMessage ReorgInfo) error {
 
 }
 
-// after complete reorganization commit the reorganized state
+// after complete reorganization commit the reorganized state of all the written accounts at once
 func (s *StorageReorganizer) Commit() {
 
 	keys := make([]common.Hash, 0)
 
 	for key := range s.commitedStorage {
-		keys = append(keys, key)
+
+		// the protected slots of a proxy and the values of mappings that stay in place are kept as they are
+		if !s.IsProtected(key) && !s.isKeptSlot(key) {
+
+			keys = append(keys, key)
+		}
 	}
 
 	s.state.DeleteKeysFromStorage(s.addr, keys)
+	s.clearSourceAccounts()
+
+	// the other accounts are written together with the reorganized account, Reorganize checked that they are empty
+	for _, account := range s.GetWrittenAccounts() {
 
-	for key, val := range s.modifiedStorage {
+		for key, val := range s.modifiedStorage[account] {
 
-		if val != (common.Hash{}) {
+			if val != (common.Hash{}) {
 
-			s.state.SetState(s.addr, key, val)
+				s.state.SetState(account, key, val)
+			}
 		}
 	}
 }
 
-// returns a new DummyStateDB object initialized with the given state
+// returns a new DummyStateDB object initialized with the given state of the account at the zero address
 func NewDummyStateDB(storageSlots *map[common.Hash]StorageSlot) *DummyStateDB {
 
-	storage := make(map[common.Hash]common.Hash)
-	for _, slot := range *storageSlots {
-
-		storage[slot.Key] = slot.Value
-	}
+	dummy := &DummyStateDB{Storage: make(map[common.Address]map[common.Hash]common.Hash)}
+	dummy.SetAccountStorage(common.Address{}, storageSlots)
 
-	return &DummyStateDB{Storage: storage}
+	return dummy
 }
 
 // returns a new StorageReorganizer object
@@ -907,25 +1136,41 @@ func NewStorageReorganizer(addr common.Address, state *DummyStateDB) *StorageReo
 	return &StorageReorganizer{
 		state:           state,
 		commitedStorage: make(map[common.Hash]common.Hash),
-		modifiedStorage: make(map[common.Hash]common.Hash),
+		modifiedStorage: make(map[common.Address]map[common.Hash]common.Hash),
 		dataTypes:       make(map[string]DataType),
-		addr:            common.Address{},
+		addr:            addr,
+		account:         addr,
+		writtenBytes:    make(map[common.Address]map[common.Hash]uint32),
+		transforms:      make(map[string]Transform),
+		exportedValues:  make(map[string]interface{}),
+		readKeys:        make(map[common.Hash]bool),
+		protectedSlots:  make(map[common.Hash]bool),
+		source:          addr,
+		sourceReadKeys:  make(map[common.Address]map[common.Hash]bool),
 	}
 }
 
-func ReadStorageFromFile(filePath string) (*map[common.Hash]StorageSlot, error) {
-	file, err := os.Open(filePath)
+// function to read a JSON file into the value pointed to by v. Errors of reading the file are printed in red
+func readJSONFile(filePath string, v interface{}) error {
+
+	byteVal, err := ioutil.ReadFile(filePath)
 
 	if err != nil {
 		fmt.Println(red + err.Error() + reset)
-		return nil, err
+		return err
 	}
 
-	defer file.Close()
+	return json.Unmarshal(byteVal, v)
+}
+
+func ReadStorageFromFile(filePath string) (*map[common.Hash]StorageSlot, error) {
+
+	var storageSlots map[common.Hash]StorageSlot
+
+	if err := readJSONFile(filePath, &storageSlots); err != nil {
+		return nil, err
+	}
 
-	byteVal, _ := ioutil.ReadAll(file)
-	var storageSlots map[common.Hash]StorageSlot
-	json.Unmarshal(byteVal, &storageSlots)
 	for key, slot := range storageSlots {
 
 		if slot.Value.Cmp(common.Hash{}) == 0 {
@@ -937,38 +1182,82 @@ func ReadStorageFromFile(filePath string) (*map[common.Hash]StorageSlot, error)
 
 func ReadReorgInfoFromFile(filePath string) ([]ReorgInfo, error) {
 
-	file, err := os.Open(filePath)
+	var reorgInfos []ReorgInfo
 
-	if err != nil {
-		fmt.Println(red + err.Error() + reset)
+	if err := readJSONFile(filePath, &reorgInfos); err != nil {
 		return nil, err
 	}
 
-	defer file.Close()
-
-	byteVal, _ := ioutil.ReadAll(file)
-	var reorgInfos []ReorgInfo
-	json.Unmarshal(byteVal, &reorgInfos)
 	return reorgInfos, nil
 }
 
 func ReadDataTypesFromFile(filePath string) ([]DataType, error) {
 
-	file, err := os.Open(filePath)
+	var dataTypes []DataType
 
-	if err != nil {
-		fmt.Println(red + err.Error() + reset)
+	if err := readJSONFile(filePath, &dataTypes); err != nil {
 		return nil, err
 	}
 
-	defer file.Close()
-
-	byteVal, _ := ioutil.ReadAll(file)
-	var dataTypes []DataType
-	json.Unmarshal(byteVal, &dataTypes)
 	return dataTypes, nil
 }
 
+// reads the optional inputs of the planner that are present in a test directory
+func ReadPlanOptionsFromDirectory(directoryPath string) (PlanOptions, error) {
+
+	var options PlanOptions
+
+	if _, statErr := os.Stat(directoryPath + "/" + "initial_values.json"); statErr == nil {
+
+		if err := readJSONFile(directoryPath+"/"+"initial_values.json", &options.InitialValues); err != nil {
+
+			return options, err
+		}
+	}
+
+	if _, statErr := os.Stat(directoryPath + "/" + "transforms.json"); statErr == nil {
+
+		if err := readJSONFile(directoryPath+"/"+"transforms.json", &options.Transforms); err != nil {
+
+			return options, err
+		}
+	}
+
+	if _, statErr := os.Stat(directoryPath + "/" + "mapping_keys.json"); statErr == nil {
+
+		if err := readJSONFile(directoryPath+"/"+"mapping_keys.json", &options.MappingKeys); err != nil {
+
+			return options, err
+		}
+	}
+
+	if _, statErr := os.Stat(directoryPath + "/" + "truncation_policies.json"); statErr == nil {
+
+		if err := readJSONFile(directoryPath+"/"+"truncation_policies.json", &options.TruncationPolicies); err != nil {
+
+			return options, err
+		}
+	}
+
+	if _, statErr := os.Stat(directoryPath + "/" + "struct_members.json"); statErr == nil {
+
+		if err := readJSONFile(directoryPath+"/"+"struct_members.json", &options.Structs); err != nil {
+
+			return options, err
+		}
+	}
+
+	if _, statErr := os.Stat(directoryPath + "/" + "field_mappings.json"); statErr == nil {
+
+		if err := readJSONFile(directoryPath+"/"+"field_mappings.json", &options.FieldMappings); err != nil {
+
+			return options, err
+		}
+	}
+
+	return options, nil
+}
+
 func getDirectoriesInPath(directoryPath string) ([]string, error) {
 	var directories []string
 
@@ -1014,6 +1303,32 @@ func runAllTests(targetDirectory string) {
 
 	}
 
+	if _, statErr := os.Stat(targetDirectory + "/" + "compositions.json"); statErr == nil {
+
+		var compositions [][]string
+
+		if err := readJSONFile(targetDirectory+"/"+"compositions.json", &compositions); err != nil {
+
+			failedTests = append(failedTests, Result{directory: targetDirectory + "/" + "compositions.json", err: err})
+		}
+
+		for _, chain := range compositions {
+
+			if passed, err := runComposition(targetDirectory, chain); !passed {
+
+				failedTests = append(failedTests, Result{directory: strings.Join(chain, " -> "), err: err})
+			}
+		}
+	}
+
+	if _, statErr := os.Stat(targetDirectory + "/" + "registry.json"); statErr == nil {
+
+		if passed, err := runRegistryTest(targetDirectory + "/" + "registry.json"); !passed {
+
+			failedTests = append(failedTests, Result{directory: targetDirectory + "/" + "registry.json", err: err})
+		}
+	}
+
 	if len(failedTests) > 0 {
 
 		fmt.Println(red + "❌❌❌ Failed Tests ❌❌❌" + reset)
@@ -1030,6 +1345,33 @@ func runAllTests(targetDirectory string) {
 
 }
 
+// returns a transform that converts a string to upper case, used by Tests/test8 and Tests/test14
+func upperCase() Transform {
+
+	return TransformFunc(func(oldValues map[string]interface{}) (interface{}, error) {
+
+		for _, value := range oldValues {
+
+			if data, ok := value.([]byte); ok {
+
+				return []byte(strings.ToUpper(string(data))), nil
+			}
+		}
+
+		return nil, errors.New("Expected A String Input")
+	})
+}
+
+// transforms that are referenced by the transforms.json and struct_members.json of the tests. They are only registered
+// by the test harness, a real plan has to register its own transforms
+var testTransforms = map[string]Transform{
+	"scaleDecimals6To18": ScaleDecimals(6, 18),
+	"lowerHalf":          ExtractBits(0, 128),
+	"upperHalf":          ExtractBits(128, 128),
+	"boolToStatus":       MapValues(map[int64]int64{0: 1, 1: 2}),
+	"upperCase":          upperCase(),
+}
+
 func runTest(directoryPath string) (bool, error) {
 
 	fmt.Println(cyan + "Current Directory: " + directoryPath + reset)
@@ -1042,6 +1384,20 @@ func runTest(directoryPath string) (bool, error) {
 	}
 
 	dummy := NewDummyStateDB(storageSlots)
+
+	// the storage of the sources of a merge is read from their accounts
+	sources, sourceStorages, mergeOptions, err := readMergeSources(directoryPath)
+
+	if err != nil {
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	for account, sourceStorage := range sourceStorages {
+
+		dummy.SetAccountStorage(account, sourceStorage)
+	}
+
 	fmt.Println(white + "Before reorganization:" + reset)
 	dummy.PrintStorage(yellow)
 
@@ -1077,15 +1433,134 @@ func runTest(directoryPath string) (bool, error) {
 		}
 	*/
 
+	if err := checkComputedLayouts(directoryPath, dataTypes); err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	if err := checkLayoutResults(directoryPath); err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	if err := checkArtifacts(directoryPath, reorgInfos, dataTypes); err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	err = checkGeneratedPlan(directoryPath, reorgInfos, dataTypes)
+
+	if err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	protectedSlots, err := readProtectedSlots(directoryPath)
+
+	if err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	if err := checkProxyLayout(directoryPath, protectedSlots); err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
 	currentStateAsMap := dummy.GetStorageAsMap(common.Address{})
 	reorganizer := NewStorageReorganizer(common.Address{}, dummy)
 	reorganizer.Init(currentStateAsMap, reorgInfos, dataTypes)
+	reorganizer.SetProtectedSlots(protectedSlots)
+	reorganizer.SetClearSources(mergeOptions.ClearSources)
+
+	oldLayout, err := readOptionalLayout(directoryPath + "/" + "old_layout.json")
+
+	if err == nil && oldLayout != nil {
+
+		err = reorganizer.SetOldLayout(oldLayout)
+	}
+
+	if err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	for name, transform := range testTransforms {
+
+		reorganizer.RegisterTransform(name, transform)
+	}
 
-	if reorganizer.Reorganize() != nil {
+	err = reorganizer.Reorganize()
 
+	if err != nil {
+
+		fmt.Println(red + err.Error() + reset)
 		return false, err
 	}
+
+	// the gas is estimated before the commit changes the state
+	if len(reorganizer.GetWrittenAccounts()) > 1 || len(sources) != 0 {
+
+		estimate := reorganizer.EstimateGas()
+		fmt.Println(white + fmt.Sprintf("Combined gas estimate for %d accounts: %d, reading %d slots", len(estimate.Accounts), estimate.Gas, estimate.ReadSlots) + reset)
+
+		for _, accountEstimate := range estimate.Accounts {
+
+			fmt.Println(white + fmt.Sprintf("  %s: %d, writing %d and clearing %d slots", accountEstimate.Account.Hex(), accountEstimate.Gas, accountEstimate.WrittenSlots, accountEstimate.ClearedSlots) + reset)
+		}
+	}
+
+	// the orphaned slots are read before the commit deletes them
+	if orphanedSlots := reorganizer.GetOrphanedSlots(); len(orphanedSlots) != 0 {
+
+		fmt.Println(white + fmt.Sprintf("Orphaned slots, their data is dropped by the reorganization: %d", len(orphanedSlots)) + reset)
+
+		for _, slot := range orphanedSlots {
+
+			fmt.Println(yellow + slot.Hex() + reset)
+		}
+	}
+
+	for _, account := range reorganizer.GetSourceAccounts() {
+
+		if orphanedSlots := reorganizer.GetOrphanedSourceSlots(account); len(orphanedSlots) != 0 {
+
+			fmt.Println(white + fmt.Sprintf("Orphaned slots of source %s, their data is dropped by the merge: %d", account.Hex(), len(orphanedSlots)) + reset)
+
+			for _, slot := range orphanedSlots {
+
+				fmt.Println(yellow + slot.Hex() + reset)
+			}
+		}
+	}
+
 	reorganizer.Commit()
+
+	if exportedValues := reorganizer.GetExportedValues(); len(exportedValues) != 0 {
+
+		fmt.Println(white + "Exported values:" + reset)
+		labels := make([]string, 0, len(exportedValues))
+
+		for label := range exportedValues {
+
+			labels = append(labels, label)
+		}
+
+		sort.Strings(labels)
+
+		for _, label := range labels {
+
+			fmt.Println(yellow + label + ": " + fmt.Sprint(exportedValues[label]) + reset)
+		}
+	}
+
 	fmt.Println(white + "After reorganization:" + reset)
 	dummy.PrintStorage(orange)
 
@@ -1097,6 +1572,29 @@ func runTest(directoryPath string) (bool, error) {
 	}
 
 	expectedDummy := NewDummyStateDB(expectedStorageSlots)
+
+	// the accounts that receive a part of the storage of a split are compared as well
+	_, targetStorages, err := readSplitTargets(directoryPath)
+
+	if err != nil {
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	for account, targetStorage := range targetStorages {
+
+		expectedDummy.SetAccountStorage(account, targetStorage)
+	}
+
+	// the sources of a merge keep their storage unless they are cleared
+	if !mergeOptions.ClearSources {
+
+		for account, sourceStorage := range sourceStorages {
+
+			expectedDummy.SetAccountStorage(account, sourceStorage)
+		}
+	}
+
 	err = expectedDummy.IsStorageEqual(dummy)
 
 	if err != nil {
@@ -1104,11 +1602,989 @@ func runTest(directoryPath string) (bool, error) {
 		return false, err
 	}
 
+	if err := checkRoundTrip(directoryPath, dummy, reorgInfos, dataTypes); err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	if err := checkSlotMap(directoryPath); err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	if err := checkOptimizedLayout(directoryPath); err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
 	fmt.Println(green + "Test passed: " + directoryPath + "🎉🎉🎉" + reset)
 	return true, nil
 }
 
-func main() {
+// checks that the new layout of a test in proxy mode does not use a protected slot
+func checkProxyLayout(directoryPath string, protectedSlots []common.Hash) error {
+
+	if protectedSlots == nil {
+
+		return nil
+	}
+
+	if _, err := os.Stat(directoryPath + "/" + "new_layout.json"); err != nil {
+
+		return nil
+	}
+
+	newLayout, err := ReadStorageLayoutFromFile(directoryPath + "/" + "new_layout.json")
+
+	if err != nil {
+
+		return err
+	}
+
+	if err := CheckProtectedSlots(newLayout, protectedSlots); err != nil {
+
+		return err
+	}
+
+	fmt.Println(white + fmt.Sprintf("Proxy mode keeps %d protected slots", len(protectedSlots)) + reset)
+	return nil
+}
+
+// computes the layouts of the old and the new contract without solc and checks them against the layouts generated by
+// solc and against the data types of the plan
+func checkComputedLayouts(directoryPath string, dataTypes []DataType) error {
+
+	computedLayouts := make([]*StorageLayout, 0, 2)
+
+	for _, files := range [][2]string{{"Old.sol", "old_layout.json"}, {"New.sol", "new_layout.json"}} {
+
+		sourcePath := directoryPath + "/" + files[0]
+		layoutPath := directoryPath + "/" + files[1]
+
+		if _, err := os.Stat(sourcePath); err != nil {
+
+			return nil
+		}
+
+		declarations, err := ReadDeclarationsFromFile(sourcePath)
+
+		if err != nil {
+
+			return err
+		}
+
+		computedLayout, err := ComputeStorageLayout(declarations, "")
+
+		if err != nil {
+
+			return errors.New("Layout Computation Failed For " + sourcePath + ": " + err.Error())
+		}
+
+		if _, err := os.Stat(layoutPath); err == nil {
+
+			layout, err := ReadStorageLayoutFromFile(layoutPath)
+
+			if err != nil {
+
+				return err
+			}
+
+			if err := CompareStorageLayouts(layout, computedLayout); err != nil {
+
+				return errors.New("Computed Layout Differs For " + sourcePath + ": " + err.Error())
+			}
+		}
+
+		computedLayouts = append(computedLayouts, computedLayout)
+	}
+
+	if err := CheckDataTypes(dataTypes, computedLayouts[0], computedLayouts[1]); err != nil {
+
+		return errors.New("Computed Layouts Differ From The Data Types: " + err.Error())
+	}
+
+	fmt.Println(white + "Computed layouts match the layouts generated by solc" + reset)
+	return nil
+}
+
+// reads the layouts of the old and the new contract from the build artifacts of a test and checks that they match the
+// layouts generated by solc and that the plan generated from them is the plan of the test
+func checkArtifacts(directoryPath string, reorgInfos []ReorgInfo, dataTypes []DataType) error {
+
+	if _, err := os.Stat(directoryPath + "/" + "artifacts.json"); err != nil {
+
+		return nil
+	}
+
+	var spec ArtifactSpec
+
+	if err := readJSONFile(directoryPath+"/"+"artifacts.json", &spec); err != nil {
+
+		return err
+	}
+
+	layouts := make([]*StorageLayout, 0, 2)
+
+	for _, artifact := range [][4]string{{spec.OldArtifact, spec.OldContract, spec.OldSource, "old_layout.json"}, {spec.NewArtifact, spec.NewContract, spec.NewSource, "new_layout.json"}} {
+
+		sourcePath := ""
+
+		if artifact[2] != "" {
+
+			sourcePath = directoryPath + "/" + artifact[2]
+		}
+
+		layout, err := loadStorageLayoutWithSource(directoryPath+"/"+artifact[0], artifact[1], sourcePath)
+
+		if err != nil {
+
+			return errors.New("Loading Artifact " + artifact[0] + " Failed: " + err.Error())
+		}
+
+		expectedLayout, err := ReadStorageLayoutFromFile(directoryPath + "/" + artifact[3])
+
+		if err != nil {
+
+			return err
+		}
+
+		if err := CompareStorageLayouts(expectedLayout, layout); err != nil {
+
+			return errors.New("Layout Of Artifact " + artifact[0] + " Differs: " + err.Error())
+		}
+
+		layouts = append(layouts, layout)
+	}
+
+	options, err := ReadPlanOptionsFromDirectory(directoryPath)
+
+	if err != nil {
+
+		return err
+	}
+
+	generatedReorgInfos, generatedDataTypes, err := GenerateReorgPlan(layouts[0], layouts[1], options)
+
+	if err != nil {
+
+		return err
+	}
+
+	if !isJSONEqual(generatedReorgInfos, reorgInfos) || !isJSONEqual(generatedDataTypes, dataTypes) {
+
+		return errors.New("Plan Generated From The Artifacts Differs")
+	}
+
+	fmt.Println(white + "Artifacts " + spec.OldArtifact + " and " + spec.NewArtifact + " match the layouts" + reset)
+	return nil
+}
+
+// struct that holds the variables that the round trip of a test can not restore, read from round_trip.json
+type RoundTripInfo struct {
+	NonInvertible []string `json:"nonInvertible"` // variables whose old values are computed away, e.g. transformed variables
+	Dropped       []string `json:"dropped"`       // fields of the old layout that the plan does not move
+}
+
+// function to read the expected results of the round trip of a test. Without round_trip.json the whole old storage
+// must be restored
+func readRoundTripInfo(directoryPath string) (RoundTripInfo, error) {
+
+	var roundTripInfo RoundTripInfo
+
+	if _, err := os.Stat(directoryPath + "/" + "round_trip.json"); err != nil {
+
+		return roundTripInfo, nil
+	}
+
+	err := readJSONFile(directoryPath+"/"+"round_trip.json", &roundTripInfo)
+	return roundTripInfo, err
+}
+
+// moves the reorganized storage back with the inverse of the lossless part of the plan and checks that the restored
+// storage matches the storage of the old contract. The variables whose old values can not be restored, e.g.
+// transformed variables, and the fields that the plan drops are not compared and must match round_trip.json
+func checkRoundTrip(directoryPath string, dummy *DummyStateDB, reorgInfos []ReorgInfo, dataTypes []DataType) error {
+
+	invertibleReorgInfos, invertibleDataTypes, nonInvertible := SplitInvertibleReorgInfos(reorgInfos, dataTypes)
+	droppedFields := make([]string, 0)
+
+	oldLayout, err := ReadStorageLayoutFromFile(directoryPath + "/" + "old_layout.json")
+
+	if err != nil {
+
+		return err
+	}
+
+	fields, err := FindDroppedFields(oldLayout, reorgInfos, dataTypes)
+
+	if err != nil {
+
+		return err
+	}
+
+	for _, field := range fields {
+
+		if !isFieldOf(field, nonInvertible) {
+
+			droppedFields = append(droppedFields, field)
+		}
+	}
+
+	roundTripInfo, err := readRoundTripInfo(directoryPath)
+
+	if err != nil {
+
+		return err
+	}
+
+	if strings.Join(nonInvertible, ", ") != strings.Join(roundTripInfo.NonInvertible, ", ") {
+
+		return errors.New("Round Trip Non-Invertible Variables Are [" + strings.Join(nonInvertible, ", ") + "] Instead Of [" + strings.Join(roundTripInfo.NonInvertible, ", ") + "]")
+	}
+
+	if strings.Join(droppedFields, ", ") != strings.Join(roundTripInfo.Dropped, ", ") {
+
+		return errors.New("Round Trip Dropped Fields Are [" + strings.Join(droppedFields, ", ") + "] Instead Of [" + strings.Join(roundTripInfo.Dropped, ", ") + "]")
+	}
+
+	inverseReorgInfos, inverseDataTypes, err := InvertReorgPlan(invertibleReorgInfos, invertibleDataTypes)
+
+	if err != nil {
+
+		return errors.New("Round Trip Failed: " + err.Error())
+	}
+
+	protectedSlots, err := readProtectedSlots(directoryPath)
+
+	if err != nil {
+
+		return err
+	}
+
+	newLayout, err := ReadStorageLayoutFromFile(directoryPath + "/" + "new_layout.json")
+
+	if err != nil {
+
+		return err
+	}
+
+	if err := applyReorgPlan(dummy, newLayout, inverseReorgInfos, inverseDataTypes, protectedSlots, testTransforms); err != nil {
+
+		return errors.New("Round Trip Failed: " + err.Error())
+	}
+
+	oldStorageSlots, err := ReadStorageFromFile(directoryPath + "/" + "old_storage.json")
+
+	if err != nil {
+
+		return err
+	}
+
+	oldStorage := NewDummyStateDB(oldStorageSlots).GetStorageAsMap(common.Address{})
+
+	if err := CompareRestoredStorage(oldLayout, newLayout, oldStorage, dummy.GetStorageAsMap(common.Address{}), append(nonInvertible, droppedFields...)); err != nil {
+
+		return errors.New("Round Trip Mismatch: " + err.Error())
+	}
+
+	if len(nonInvertible) == 0 && len(droppedFields) == 0 {
+
+		fmt.Println(white + "Round trip restored the old storage" + reset)
+		return nil
+	}
+
+	message := "Round trip restored the lossless variables"
+
+	if len(nonInvertible) != 0 {
+
+		message += ", non-invertible: " + strings.Join(nonInvertible, ", ")
+	}
+
+	if len(droppedFields) != 0 {
+
+		message += ", dropped: " + strings.Join(droppedFields, ", ")
+	}
+
+	fmt.Println(white + message + reset)
+	return nil
+}
+
+// optimizes the old layout of a test and checks that the optimized layout does not use more slots, and that the old
+// storage is restored after moving it into the optimized layout and back
+func checkOptimizedLayout(directoryPath string) error {
+
+	if _, err := os.Stat(directoryPath + "/" + "old_layout.json"); err != nil {
+
+		return nil
+	}
+
+	oldLayout, err := ReadStorageLayoutFromFile(directoryPath + "/" + "old_layout.json")
+
+	if err != nil {
+
+		return err
+	}
+
+	planOptions, err := ReadPlanOptionsFromDirectory(directoryPath)
+
+	if err != nil {
+
+		return err
+	}
+
+	optimizedLayout, reorgInfos, dataTypes, estimate, err := OptimizeLayout(oldLayout, OptimizerOptions{MappingKeys: planOptions.MappingKeys})
+
+	if err != nil {
+
+		return errors.New("Optimization Failed: " + err.Error())
+	}
+
+	if estimate.NewSlots > estimate.OldSlots {
+
+		return errors.New("Optimized Layout Uses More Slots Than The Old Layout")
+	}
+
+	if len(reorgInfos) == 0 {
+
+		fmt.Println(white + "Optimized layout keeps the old order" + reset)
+		return nil
+	}
+
+	// the values of a mapping are only kept for the keys of the test, which need not be all keys in the storage
+	for _, reorgInfo := range reorgInfos {
+
+		if IsMappingEncoding(oldLayout.Types[reorgInfo.Type].Encoding) {
+
+			fmt.Println(white + fmt.Sprintf("Optimized layout uses %d instead of %d slots, round trip skipped since the values of mapping %s are only kept for the keys of the test", estimate.NewSlots, estimate.OldSlots, reorgInfo.Label) + reset)
+			return nil
+		}
+	}
+
+	storageSlots, err := ReadStorageFromFile(directoryPath + "/" + "old_storage.json")
+
+	if err != nil {
+
+		return err
+	}
+
+	protectedSlots, err := readProtectedSlots(directoryPath)
+
+	if err != nil {
+
+		return err
+	}
+
+	dummy := NewDummyStateDB(storageSlots)
+
+	if err := applyReorgPlan(dummy, oldLayout, reorgInfos, dataTypes, protectedSlots, testTransforms); err != nil {
+
+		return errors.New("Optimized Plan Failed: " + err.Error())
+	}
+
+	inverseReorgInfos, inverseDataTypes, err := InvertLosslessReorgPlan(oldLayout, reorgInfos, dataTypes)
+
+	if err != nil {
+
+		return errors.New("Optimized Plan Can Not Be Inverted: " + err.Error())
+	}
+
+	if err := applyReorgPlan(dummy, optimizedLayout, inverseReorgInfos, inverseDataTypes, protectedSlots, testTransforms); err != nil {
+
+		return errors.New("Inverse Of Optimized Plan Failed: " + err.Error())
+	}
+
+	if err := NewDummyStateDB(storageSlots).IsStorageEqual(dummy); err != nil {
+
+		return errors.New("Optimized Round Trip Mismatch: " + err.Error())
+	}
+
+	fmt.Println(white + fmt.Sprintf("Optimized layout uses %d instead of %d slots", estimate.NewSlots, estimate.OldSlots) + reset)
+	return nil
+}
+
+// function to read a storage layout that may be missing, e.g. in tests that only have a plan
+func readOptionalLayout(filePath string) (*StorageLayout, error) {
+
+	if _, err := os.Stat(filePath); err != nil {
+
+		return nil, nil
+	}
+
+	return ReadStorageLayoutFromFile(filePath)
+}
+
+// reorganizes the storage of the dummy state with a plan and the given transforms and commits the reorganized storage
+func applyReorgPlan(dummy *DummyStateDB, oldLayout *StorageLayout, reorgInfos []ReorgInfo, dataTypes []DataType, protectedSlots []common.Hash, transforms map[string]Transform) error {
+
+	reorganizer, err := reorganizePlan(dummy, oldLayout, reorgInfos, dataTypes, protectedSlots, transforms)
+
+	if err != nil {
+
+		return err
+	}
+
+	reorganizer.Commit()
+	return nil
+}
+
+// function to reorganize the storage of the account at the zero address with a plan without commiting it. The old
+// layout may be nil if the plan does not keep the values of a mapping in place
+func reorganizePlan(dummy *DummyStateDB, oldLayout *StorageLayout, reorgInfos []ReorgInfo, dataTypes []DataType, protectedSlots []common.Hash, transforms map[string]Transform) (*StorageReorganizer, error) {
+
+	reorganizer := NewStorageReorganizer(common.Address{}, dummy)
+	reorganizer.Init(dummy.GetStorageAsMap(common.Address{}), reorgInfos, dataTypes)
+	reorganizer.SetProtectedSlots(protectedSlots)
+
+	if oldLayout != nil {
+
+		if err := reorganizer.SetOldLayout(oldLayout); err != nil {
+
+			return nil, err
+		}
+	}
+
+	for name, transform := range transforms {
+
+		reorganizer.RegisterTransform(name, transform)
+	}
+
+	if err := reorganizer.Reorganize(); err != nil {
+
+		return nil, err
+	}
+
+	return reorganizer, nil
+}
+
+// composes the plans of a chain of tests, e.g. from v1 to v2 and from v2 to v3, and checks that the composed plan
+// reorganizes the old storage of the first test into the new storage of the last test, like running the plans in sequence
+func runComposition(targetDirectory string, chain []string) (bool, error) {
+
+	fmt.Println(cyan + "Current Composition: " + strings.Join(chain, " -> ") + reset)
+
+	var composedReorgInfos []ReorgInfo
+	var composedDataTypes []DataType
+	plans := make([][]ReorgInfo, 0, len(chain))
+	planDataTypes := make([][]DataType, 0, len(chain))
+
+	for i, directory := range chain {
+
+		reorgInfos, err := ReadReorgInfoFromFile(targetDirectory + "/" + directory + "/" + "storage_reorg_info.json")
+
+		if err != nil {
+
+			fmt.Println(red + err.Error() + reset)
+			return false, err
+		}
+
+		dataTypes, err := ReadDataTypesFromFile(targetDirectory + "/" + directory + "/" + "data_types.json")
+
+		if err != nil {
+
+			fmt.Println(red + err.Error() + reset)
+			return false, err
+		}
+
+		plans = append(plans, reorgInfos)
+		planDataTypes = append(planDataTypes, dataTypes)
+
+		if i == 0 {
+
+			composedReorgInfos, composedDataTypes = reorgInfos, dataTypes
+			continue
+		}
+
+		composedReorgInfos, composedDataTypes, err = ComposeReorgPlans(composedReorgInfos, composedDataTypes, reorgInfos, dataTypes)
+
+		if err != nil {
+
+			fmt.Println(red + err.Error() + reset)
+			return false, err
+		}
+	}
+
+	firstDirectory := targetDirectory + "/" + chain[0]
+	lastDirectory := targetDirectory + "/" + chain[len(chain)-1]
+
+	if _, err := os.Stat(firstDirectory + "/" + "old_layout.json"); err == nil {
+
+		firstLayout, err := ReadStorageLayoutFromFile(firstDirectory + "/" + "old_layout.json")
+
+		if err != nil {
+
+			return false, err
+		}
+
+		lastLayout, err := ReadStorageLayoutFromFile(lastDirectory + "/" + "new_layout.json")
+
+		if err != nil {
+
+			return false, err
+		}
+
+		droppedLabels, err := FindDroppedInBetween(firstLayout, lastLayout, composedReorgInfos)
+
+		if err != nil {
+
+			fmt.Println(red + err.Error() + reset)
+			return false, err
+		}
+
+		if len(droppedLabels) != 0 {
+
+			fmt.Println(white + "Dropped in between: " + strings.Join(droppedLabels, ", ") + reset)
+		}
+	}
+
+	storageSlots, err := ReadStorageFromFile(firstDirectory + "/" + "old_storage.json")
+
+	if err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	sequentialDummy := NewDummyStateDB(storageSlots)
+	composedDummy := NewDummyStateDB(storageSlots)
+
+	var firstLayout *StorageLayout
+
+	for i := range plans {
+
+		oldLayout, err := readOptionalLayout(targetDirectory + "/" + chain[i] + "/" + "old_layout.json")
+
+		if err != nil {
+
+			return false, err
+		}
+
+		if i == 0 {
+
+			firstLayout = oldLayout
+		}
+
+		if err := applyReorgPlan(sequentialDummy, oldLayout, plans[i], planDataTypes[i], nil, testTransforms); err != nil {
+
+			fmt.Println(red + err.Error() + reset)
+			return false, err
+		}
+	}
+
+	if err := applyReorgPlan(composedDummy, firstLayout, composedReorgInfos, composedDataTypes, nil, testTransforms); err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	if err := sequentialDummy.IsStorageEqual(composedDummy); err != nil {
+
+		err = errors.New("Composed Plan Differs From The Plans In Sequence: " + err.Error())
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	expectedStorageSlots, err := ReadStorageFromFile(lastDirectory + "/" + "new_storage.json")
+
+	if err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	if err := NewDummyStateDB(expectedStorageSlots).IsStorageEqual(composedDummy); err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	fmt.Println(green + "Composition passed: " + strings.Join(chain, " -> ") + "🎉🎉🎉" + reset)
+	return true, nil
+}
+
+// checks that the plans derived by a layout registry whose versions are the layouts of tests match the plans of the
+// tests, that derived plans are cached and that the plan from the first to the last version reorganizes the old storage
+// of the first upgrade into the new storage of the last upgrade
+func runRegistryTest(registryPath string) (bool, error) {
+
+	fmt.Println(cyan + "Current Registry: " + registryPath + reset)
+
+	registry, err := ReadLayoutRegistryFromFile(registryPath)
+
+	if err != nil {
+
+		return false, err
+	}
+
+	if err := registry.Validate(); err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	issues, err := registry.CheckVersions()
+
+	if err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	for _, issue := range issues {
+
+		if issue.Incompatible {
+
+			err := errors.New("Incompatible Version " + issue.Version + ": " + issue.Message)
+			fmt.Println(red + err.Error() + reset)
+			return false, err
+		}
+
+		fmt.Println(white + "Unsafe change in " + issue.Version + ": " + issue.Message + reset)
+	}
+
+	versions := registry.Versions
+
+	for i := 1; i < len(versions); i++ {
+
+		optionsDirectory := registry.getPath(versions[i].Options)
+		reorgInfos, dataTypes, err := registry.DerivePlan(versions[i-1].Version, versions[i].Version, "")
+
+		if err != nil {
+
+			fmt.Println(red + err.Error() + reset)
+			return false, err
+		}
+
+		expectedReorgInfos, err := ReadReorgInfoFromFile(optionsDirectory + "/" + "storage_reorg_info.json")
+
+		if err != nil {
+
+			return false, err
+		}
+
+		expectedDataTypes, err := ReadDataTypesFromFile(optionsDirectory + "/" + "data_types.json")
+
+		if err != nil {
+
+			return false, err
+		}
+
+		if !isJSONEqual(reorgInfos, expectedReorgInfos) || !isJSONEqual(dataTypes, expectedDataTypes) {
+
+			err := errors.New("Derived Plan Mismatch For Version " + versions[i].Version)
+			fmt.Println(red + err.Error() + reset)
+			return false, err
+		}
+	}
+
+	cacheDirectory, err := ioutil.TempDir("", "registry")
+
+	if err != nil {
+
+		return false, err
+	}
+
+	defer os.RemoveAll(cacheDirectory)
+
+	firstVersion, lastVersion := versions[0].Version, versions[len(versions)-1].Version
+	reorgInfos, dataTypes, err := registry.DerivePlan(firstVersion, lastVersion, cacheDirectory)
+
+	if err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	cachedReorgInfos, cachedDataTypes, err := registry.DerivePlan(firstVersion, lastVersion, cacheDirectory)
+
+	if _, statErr := os.Stat(registry.getCachePath(cacheDirectory, firstVersion, lastVersion)); err != nil || statErr != nil || !isJSONEqual(reorgInfos, cachedReorgInfos) || !isJSONEqual(dataTypes, cachedDataTypes) {
+
+		err := errors.New("Cached Plan Mismatch From " + firstVersion + " To " + lastVersion)
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	storageSlots, err := ReadStorageFromFile(registry.getPath(versions[1].Options) + "/" + "old_storage.json")
+
+	if err != nil {
+
+		return false, err
+	}
+
+	firstLayout, err := registry.ReadLayout(0)
+
+	if err != nil {
+
+		return false, err
+	}
+
+	dummy := NewDummyStateDB(storageSlots)
+
+	if err := applyReorgPlan(dummy, firstLayout, reorgInfos, dataTypes, nil, testTransforms); err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	expectedStorageSlots, err := ReadStorageFromFile(registry.getPath(versions[len(versions)-1].Options) + "/" + "new_storage.json")
+
+	if err != nil {
+
+		return false, err
+	}
+
+	if err := NewDummyStateDB(expectedStorageSlots).IsStorageEqual(dummy); err != nil {
+
+		fmt.Println(red + err.Error() + reset)
+		return false, err
+	}
+
+	if _, _, err := registry.DerivePlan(lastVersion, firstVersion, ""); err != nil {
+
+		fmt.Println(white + "Downgrade skipped, " + err.Error() + reset)
+	}
+
+	fmt.Println(green + "Registry passed: " + registry.Contract + " " + firstVersion + " -> " + lastVersion + "🎉🎉🎉" + reset)
+	return true, nil
+}
+
+// if the layouts of the old and the new contract are present, checks that the Go planner generates the same
+// reorganization messages and data types as the off-chain code analyzer
+func checkGeneratedPlan(directoryPath string, reorgInfos []ReorgInfo, dataTypes []DataType) error {
+
+	if _, err := os.Stat(directoryPath + "/" + "old_layout.json"); os.IsNotExist(err) {
+
+		return nil
+	}
+
+	oldLayout, err := ReadStorageLayoutFromFile(directoryPath + "/" + "old_layout.json")
+
+	if err != nil {
+
+		return err
+	}
+
+	newLayout, err := ReadStorageLayoutFromFile(directoryPath + "/" + "new_layout.json")
+
+	if err != nil {
+
+		return err
+	}
+
+	options, err := ReadPlanOptionsFromDirectory(directoryPath)
+
+	if err != nil {
+
+		return err
+	}
+
+	generatedReorgInfos, generatedDataTypes, err := generateDirectoryPlan(directoryPath, oldLayout, newLayout, options)
+
+	if err != nil {
+
+		return err
+	}
+
+	// the plans are compared as JSON since the initial values are kept as raw JSON
+	if !isJSONEqual(generatedReorgInfos, reorgInfos) {
+
+		return errors.New("Generated Reorg Info Mismatch")
+	}
+
+	if !isJSONEqual(generatedDataTypes, dataTypes) {
+
+		return errors.New("Generated Data Types Mismatch")
+	}
+
+	return nil
+}
+
+// checks if two values have the same JSON encoding
+func isJSONEqual(a, b interface{}) bool {
+
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
+
+func main() {
+
+	if len(os.Args) > 1 {
+
+		switch os.Args[1] {
+
+		case "check":
+
+			if len(os.Args) != 4 {
+
+				fmt.Println(red + "Usage: check <old_layout.json> <new_layout.json>" + reset)
+				os.Exit(2)
+			}
+
+			if err := runCheck(os.Args[2], os.Args[3]); err != nil {
+
+				fmt.Println(red + err.Error() + reset)
+				os.Exit(1)
+			}
+
+		case "visualize":
+
+			if len(os.Args) != 3 && len(os.Args) != 4 {
+
+				fmt.Println(red + "Usage: visualize <test directory> [output.html|output.svg]" + reset)
+				os.Exit(2)
+			}
+
+			outputPath := ""
+
+			if len(os.Args) == 4 {
+
+				outputPath = os.Args[3]
+			}
+
+			if err := runVisualize(os.Args[2], outputPath); err != nil {
+
+				fmt.Println(red + err.Error() + reset)
+				os.Exit(1)
+			}
+
+		case "registry":
+
+			if len(os.Args) != 3 && len(os.Args) != 6 {
+
+				fmt.Println(red + "Usage: registry <registry.json> [<from version> <to version> <output directory>]" + reset)
+				os.Exit(2)
+			}
+
+			versions := []string{}
+			outputDirectory := ""
+
+			if len(os.Args) == 6 {
+
+				versions = os.Args[3:5]
+				outputDirectory = os.Args[5]
+			}
+
+			if err := runRegistry(os.Args[2], versions, outputDirectory); err != nil {
+
+				fmt.Println(red + err.Error() + reset)
+				os.Exit(1)
+			}
+
+		case "layout":
+
+			if len(os.Args) != 3 && len(os.Args) != 4 {
+
+				fmt.Println(red + "Usage: layout <source.sol|declarations.json> [contract]" + reset)
+				os.Exit(2)
+			}
+
+			contractName := ""
+
+			if len(os.Args) == 4 {
+
+				contractName = os.Args[3]
+			}
+
+			if err := runLayout(os.Args[2], contractName); err != nil {
+
+				fmt.Println(red + err.Error() + reset)
+				os.Exit(1)
+			}
+
+		case "plan":
+
+			if len(os.Args) != 6 && len(os.Args) != 7 {
+
+				fmt.Println(red + "Usage: plan <old artifact> <new artifact> <contract> <output directory> [options directory]" + reset)
+				os.Exit(2)
+			}
+
+			optionsDirectory := ""
+
+			if len(os.Args) == 7 {
+
+				optionsDirectory = os.Args[6]
+			}
+
+			if err := runPlan(os.Args[2], os.Args[3], os.Args[4], os.Args[5], optionsDirectory); err != nil {
+
+				fmt.Println(red + err.Error() + reset)
+				os.Exit(1)
+			}
+
+		case "vyper":
+
+			if len(os.Args) < 3 || len(os.Args) > 5 {
+
+				fmt.Println(red + "Usage: vyper <layout.json> [source.vy] [output.json]" + reset)
+				os.Exit(2)
+			}
+
+			sourcePath, outputPath := "", ""
+
+			if len(os.Args) > 3 {
+
+				sourcePath = os.Args[3]
+			}
+
+			if len(os.Args) > 4 {
+
+				outputPath = os.Args[4]
+			}
+
+			if err := runVyperLayout(os.Args[2], sourcePath, outputPath); err != nil {
+
+				fmt.Println(red + err.Error() + reset)
+				os.Exit(1)
+			}
+
+		case "namespace":
+
+			if len(os.Args) < 3 {
+
+				fmt.Println(red + "Usage: namespace <erc7201:namespace|diamond:position>..." + reset)
+				os.Exit(2)
+			}
+
+			if err := runNamespace(os.Args[2:]); err != nil {
+
+				fmt.Println(red + err.Error() + reset)
+				os.Exit(1)
+			}
+
+		case "optimize":
+
+			if len(os.Args) != 4 && len(os.Args) != 5 {
+
+				fmt.Println(red + "Usage: optimize <layout.json> <output directory> [options.json]" + reset)
+				os.Exit(2)
+			}
+
+			optionsPath := ""
+
+			if len(os.Args) == 5 {
+
+				optionsPath = os.Args[4]
+			}
+
+			if err := runOptimize(os.Args[2], os.Args[3], optionsPath); err != nil {
+
+				fmt.Println(red + err.Error() + reset)
+				os.Exit(1)
+			}
+
+		default:
+
+			fmt.Println(red + "Unknown command " + os.Args[1] + reset)
+			os.Exit(2)
+		}
+
+		return
+	}
 
 	runAllTests("Tests")
 	//runTest("Tests/test6")
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// struct that holds the keys of a mapping whose values are reorganized. The keys are given as a list, or as an object
+// that also marks them as complete
+type MappingKeys struct {
+	Keys     []json.RawMessage `json:"keys"`
+	Complete bool              `json:"complete"` // set if the keys are all the keys that hold values
+}
+
+// function to read the keys of a mapping from a list of keys or from an object with the keys and the complete flag
+func (m *MappingKeys) UnmarshalJSON(data []byte) error {
+
+	var keys []json.RawMessage
+
+	if err := json.Unmarshal(data, &keys); err == nil {
+
+		*m = MappingKeys{Keys: keys}
+		return nil
+	}
+
+	var object struct {
+		Keys     []json.RawMessage `json:"keys"`
+		Complete bool              `json:"complete"`
+	}
+
+	if err := json.Unmarshal(data, &object); err != nil {
+
+		return err
+	}
+
+	*m = MappingKeys{Keys: object.Keys, Complete: object.Complete}
+
+	return nil
+}
+
+// function to encode a mapping key the way Solidity hashes it. Value types are padded to 32 bytes, fixed size bytes
+// are aligned to the left and strings and bytes are used as they are
+func (s *StorageReorganizer) EncodeMappingKey(keyTypeName string, key interface{}) ([]byte, error) {
+
+	dataType, found := s.dataTypes[keyTypeName]
+
+	if !found {
+
+		return nil, errors.New("Type not found " + keyTypeName)
+	}
+
+	if dataType.Encoding == "bytes" {
+
+		data, ok := key.([]byte)
+
+		if !ok {
+
+			return nil, errors.New("Expected Bytes For Key Of Type " + dataType.Label)
+		}
+
+		return data, nil
+	}
+
+	integer, err := ParseInteger(key)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	size := dataType.PrevNumberOfBytes
+	keyType := ExpressionType{Kind: ExpressionInt, Bits: uint(size * 8), Signed: IsSignedInteger(dataType)}
+
+	if !fitsExpressionType(integer, keyType) {
+
+		return nil, errors.New("Key " + integer.String() + " Does Not Fit In " + dataType.Label)
+	}
+
+	// negative keys of signed integers are sign extended to 32 bytes
+	if integer.Sign() < 0 {
+
+		integer = new(big.Int).Add(integer, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+
+	if strings.HasPrefix(dataType.Label, "bytes") {
+
+		integer = new(big.Int).Lsh(integer, uint(32-size)*8)
+	}
+
+	return common.BigToHash(integer).Bytes(), nil
+}
+
+// function to get the slot of the value of a mapping key, which is keccak256(key . slot)
+func GetMappingValueSlot(encodedKey []byte, slot common.Hash) common.Hash {
+
+	return common.BytesToHash(crypto.Keccak256(encodedKey, slot[:]))
+}
+
+// function to check if the values of a data type keep their layout, so values that keep their slot are still valid
+func (s *StorageReorganizer) IsTypeUnchanged(typeName string) (bool, error) {
+
+	dataType, found := s.dataTypes[typeName]
+
+	if !found {
+
+		return false, errors.New("Type not found " + typeName)
+	}
+
+	if dataType.PrevNumberOfBytes != dataType.NewNumberOfBytes || len(dataType.EnumMapping) != 0 || len(dataType.AddedMembers) != 0 || len(dataType.ArchivedMembers) != 0 {
+
+		return false, nil
+	}
+
+	for _, member := range dataType.Members {
+
+		if member.PrevSlot != member.NewSlot || member.PrevOffset != member.NewOffset || member.InitialValue != nil || member.Transform != "" || member.Expression != "" {
+
+			return false, nil
+		}
+
+		if unchanged, err := s.IsTypeUnchanged(member.Type); err != nil || !unchanged {
+
+			return false, err
+		}
+	}
+
+	if dataType.Base != "" {
+
+		return s.IsTypeUnchanged(dataType.Base)
+
+	} else if dataType.Value != "" {
+
+		return s.IsTypeUnchanged(dataType.Value)
+	}
+
+	return true, nil
+}
+
+// function to check the keys of a mapping before its values are reorganized. A mapping that keeps its slot, its
+// account and the layout of its values keeps all its values where they are, so true is returned and Commit keeps the
+// derived slots that were not read. Otherwise only the values of the listed keys are moved, so the plan must mark the
+// keys as complete, or the values of the other keys would be deleted by Commit
+func (s *StorageReorganizer) IsMappingKept(reorgMessage ReorgInfo) (bool, error) {
+
+	if reorgMessage.PrevSlot == reorgMessage.NewSlot && reorgMessage.NewType == "" && s.account == s.addr && s.source == s.addr {
+
+		unchanged, err := s.IsTypeUnchanged(reorgMessage.Type)
+
+		if err != nil {
+
+			return false, err
+		}
+
+		// the slots of the other variables must be known to tell them apart from the values of the mapping
+		if unchanged && s.layoutSlots == nil {
+
+			return false, errors.New("Mapping " + reorgMessage.Label + " Keeps Its Values In Place, The Old Layout Is Required To Find Them")
+		}
+
+		if unchanged {
+
+			return true, nil
+		}
+	}
+
+	if !reorgMessage.Complete {
+
+		return false, errors.New("Keys Of Mapping " + reorgMessage.Label + " Are Not Complete, The Values Of Other Keys Would Be Deleted")
+	}
+
+	return false, nil
+}
+
+// function to set the layout of the old storage. Its variables and the data of its dynamic arrays and bytes are
+// found in the commited storage, so the slots that were not read and do not belong to them hold the values of mappings
+func (s *StorageReorganizer) SetOldLayout(layout *StorageLayout) error {
+
+	layoutSlots, err := GetLayoutSlots(layout, s.commitedStorage)
+
+	if err != nil {
+
+		return err
+	}
+
+	s.layoutSlots = layoutSlots
+	return nil
+}
+
+// function to check if a slot is kept by Commit although it was not read. Only the values of mappings that keep their
+// values in place are kept, the slots of dropped variables and of their data are deleted
+func (s *StorageReorganizer) isKeptSlot(key common.Hash) bool {
+
+	if _, written := s.modifiedStorage[s.addr][key]; written || !s.keepsMappings || s.readKeys[key] {
+
+		return false
+	}
+
+	return !s.layoutSlots[key]
+}
+
+// returns the slots of the variables of a layout and of the data of its dynamic arrays and bytes in the given storage.
+// The values of mappings are not included, since their keys are not stored
+func GetLayoutSlots(layout *StorageLayout, storage map[common.Hash]common.Hash) (map[common.Hash]bool, error) {
+
+	slotMap, err := NewSlotMap(layout)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	segments, err := getDataSegments(layout.Types, slotMap, storage)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	slots := make(map[common.Hash]bool)
+
+	// a segment larger than a slot, e.g. of a vyper dynamic array or of the data of bytes, continues in the following slots
+	for _, segment := range segments {
+
+		for i := uint64(0); i < (segment.Offset+segment.Size+31)/32; i++ {
+
+			slots[common.BigToHash(new(big.Int).Add(segment.Slot, new(big.Int).SetUint64(i)))] = true
+		}
+	}
+
+	return slots, nil
+}
+
+// returns the segments of a slot map together with the segments of the data of its dynamic arrays and bytes in the
+// given storage, which may contain dynamic arrays and bytes again
+func getDataSegments(types map[string]TypeDescription, slotMap *SlotMap, storage map[common.Hash]common.Hash) ([]SlotSegment, error) {
+
+	segments := append([]SlotSegment{}, slotMap.Segments...)
+
+	for _, region := range slotMap.Regions {
+
+		value := storage[common.BigToHash(region.Slot)].Big()
+		dataMap := &SlotMap{}
+
+		if types[region.Type].Encoding == "bytes" {
+
+			// short bytes are stored in their slot, long bytes store 2 * length + 1 and their data in whole slots at the data slot
+			if value.Bit(0) == 0 {
+
+				continue
+			}
+
+			length := new(big.Int).Rsh(value, 1)
+
+			if !length.IsUint64() {
+
+				return nil, errors.New("Invalid Length Of " + region.Label)
+			}
+
+			dataMap.Segments = append(dataMap.Segments, SlotSegment{Label: region.Label, Root: region.Root, Type: region.Type, Slot: region.DataSlot.Big(), Size: (length.Uint64() + 31) / 32 * 32})
+
+		} else {
+
+			if !value.IsUint64() {
+
+				return nil, errors.New("Invalid Length Of " + region.Label)
+			}
+
+			if err := dataMap.addElements(types, region.Root, region.Label, types[region.Type].Base, region.DataSlot.Big(), value.Uint64()); err != nil {
+
+				return nil, err
+			}
+		}
+
+		dataSegments, err := getDataSegments(types, dataMap, storage)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		segments = append(segments, dataSegments...)
+	}
+
+	return segments, nil
+}
+
+// Reorganizes the values of the keys of a mapping that are listed in the reorganization message. Solidity does not
+// store the keys of a mapping, so the values of keys that are not listed are not moved, see IsMappingKept
+func (s *StorageReorganizer) ReorganizeMapping(reorgMessage ReorgInfo) error {
+
+	dataType, found := s.dataTypes[reorgMessage.Type]
+
+	if !found {
+
+		return errors.New("Type not found " + reorgMessage.Type)
+	}
+
+	if kept, err := s.IsMappingKept(reorgMessage); err != nil {
+
+		return err
+
+	} else if kept {
+
+		s.keepsMappings = true
+		return nil
+	}
+
+	valueDataType, found := s.dataTypes[dataType.Value]
+
+	if !found {
+
+		return errors.New("Type not found " + dataType.Value)
+	}
+
+	for _, rawKey := range reorgMessage.Keys {
+
+		key, err := s.ParseValue(dataType.Key, rawKey)
+
+		if err != nil {
+
+			return errors.New("Invalid Key Of " + reorgMessage.Label + ": " + err.Error())
+		}
+
+		encodedKey, err := s.EncodeMappingKey(dataType.Key, key)
+
+		if err != nil {
+
+			return errors.New("Invalid Key Of " + reorgMessage.Label + ": " + err.Error())
+		}
+
+		valueMessage := ReorgInfo{
+			Label:    reorgMessage.Label + "[" + string(rawKey) + "]",
+			Type:     dataType.Value,
+			PrevSlot: GetMappingValueSlot(encodedKey, reorgMessage.PrevSlot),
+			NewSlot:  GetMappingValueSlot(encodedKey, reorgMessage.NewSlot),
+		}
+
+		//process the value according to its encoding
+		if valueDataType.Encoding == "inplace" {
+
+			err = s.ReorganizeInplace(valueMessage)
+
+		} else if valueDataType.Encoding == "dynamic_array" {
+
+			err = s.ReorganizeDynamicArray(valueMessage)
+
+		} else if valueDataType.Encoding == "bytes" {
+
+			err = s.ReorganizeBytes(valueMessage)
+
+		} else {
+
+			err = errors.New("Nested Mappings Are Not Supported")
+		}
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
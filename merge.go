@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// struct that describes an account whose storage is merged into the reorganized account
+type MergeSource struct {
+	Account common.Address `json:"account"`
+	Layout  string         `json:"layout"`  // file of the layout of the contract at the account
+	Storage string         `json:"storage"` // file of the storage of the account before the merge, used by the tests
+}
+
+// struct that holds the accounts of a merge, the reorganized account receives the variables of all of them
+type MergeOptions struct {
+	Sources      []MergeSource             `json:"sources"`
+	ClearSources bool                      `json:"clearSources"` // deletes the storage of the sources when the merge is commited
+	Owners       map[string]common.Address `json:"owners"`       // account that keeps a variable declared by several accounts, the zero address for the reorganized account
+}
+
+// function to get a layout with the storage objects of a layout that are selected by their index. The types are shared
+// with the layout
+func selectStorageItems(layout *StorageLayout, selected func(int) bool) *StorageLayout {
+
+	selectedLayout := &StorageLayout{Types: layout.Types}
+
+	for i, item := range layout.Storage {
+
+		if selected(i) {
+
+			selectedLayout.Storage = append(selectedLayout.Storage, item)
+		}
+	}
+
+	return selectedLayout
+}
+
+// function to check that the variables of a merged layout do not share the bytes of a slot. The layout of a merge is
+// often written by hand from the layouts of the sources, so two variables may keep the same slot
+func CheckSlotCollisions(layout *StorageLayout) error {
+
+	slotMap, err := NewSlotMap(layout)
+
+	if err != nil {
+
+		return err
+	}
+
+	for i, segment := range slotMap.Segments {
+
+		for _, other := range slotMap.Segments[i+1:] {
+
+			if (segment.Root == other.Root && segment.Contract == other.Contract) || segment.Slot.Cmp(other.Slot) != 0 {
+
+				continue
+			}
+
+			if segment.Offset < other.Offset+other.Size && other.Offset < segment.Offset+segment.Size {
+
+				return errors.New("Slot Collision At Slot " + segment.Slot.String() + " Between " + segment.Label + " And " + other.Label)
+			}
+		}
+	}
+
+	return nil
+}
+
+// generates the plan that merges the storage of several accounts into the reorganized account. The variables of the
+// new layout that are present in the old layout are reorganized from the reorganized account, the remaining variables
+// are read from the source that declares them, so their reorganization messages name it. A variable that is declared by
+// several accounts collides, the plan can not tell which value to keep unless the owners name the account that keeps
+// it, the zero address for the reorganized account
+func GenerateMergePlan(oldLayout, newLayout *StorageLayout, sources []AccountLayout, owners map[string]common.Address, options PlanOptions) ([]ReorgInfo, []DataType, error) {
+
+	if err := CheckSlotCollisions(newLayout); err != nil {
+
+		return nil, nil, err
+	}
+
+	for label := range owners {
+
+		if _, found := newLayout.FindItem(label); !found {
+
+			return nil, nil, errors.New("Owner Given For Variable That Is Not Present In The New Layout " + label)
+		}
+	}
+
+	// index of the source of every variable of the new layout that is read from a source
+	sourceIndices := make(map[int]int)
+
+	for j, newItem := range newLayout.Storage {
+
+		// the accounts that declare the variable, the reorganized account is given by the zero address
+		accounts := make([]common.Address, 0)
+		indices := make(map[common.Address]int)
+
+		if _, found := oldLayout.FindItem(newItem.Label); found {
+
+			accounts = append(accounts, common.Address{})
+		}
+
+		for i, source := range sources {
+
+			if _, found := source.Layout.FindItem(newItem.Label); found {
+
+				accounts = append(accounts, source.Account)
+				indices[source.Account] = i
+			}
+		}
+
+		owner, found := owners[newItem.Label]
+
+		if !found && len(accounts) > 1 {
+
+			if accounts[0] == (common.Address{}) {
+
+				return nil, nil, errors.New("Variable " + newItem.Label + " Collides, It Is Declared By The Reorganized Account And Account " + accounts[1].Hex())
+			}
+
+			return nil, nil, errors.New("Variable " + newItem.Label + " Collides, It Is Declared By Account " + accounts[0].Hex() + " And Account " + accounts[1].Hex())
+
+		} else if !found && len(accounts) == 1 {
+
+			owner = accounts[0]
+
+		} else if !found {
+
+			// variables that are only declared by the new layout are initialized in the reorganized account
+			continue
+		}
+
+		if i, found := indices[owner]; found {
+
+			sourceIndices[j] = i
+
+		} else if _, found := oldLayout.FindItem(newItem.Label); owner != (common.Address{}) || !found {
+
+			return nil, nil, errors.New("Owner " + owner.Hex() + " Of Variable " + newItem.Label + " Does Not Declare It")
+		}
+	}
+
+	accountLayout := selectStorageItems(newLayout, func(j int) bool { _, found := sourceIndices[j]; return !found })
+	accountOptions := filterPlanOptions(options, accountLayout)
+	accountOptions.Structs = options.Structs
+	accountOptions.FieldMappings = options.FieldMappings
+
+	reorgInfos, dataTypes, err := GenerateReorgPlan(oldLayout, accountLayout, accountOptions)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	for i, source := range sources {
+
+		sourceLayout := selectStorageItems(newLayout, func(j int) bool { k, found := sourceIndices[j]; return found && k == i })
+
+		sourceReorgInfos, sourceDataTypes, err := GenerateReorgPlan(source.Layout, sourceLayout, filterPlanOptions(options, sourceLayout))
+
+		if err != nil {
+
+			return nil, nil, errors.New("Account " + source.Account.Hex() + ": " + err.Error())
+		}
+
+		for j := range sourceReorgInfos {
+
+			account := source.Account
+			sourceReorgInfos[j].Source = &account
+		}
+
+		reorgInfos = append(reorgInfos, sourceReorgInfos...)
+
+		if dataTypes, err = mergeDataTypes(dataTypes, sourceDataTypes, source.Account); err != nil {
+
+			return nil, nil, err
+		}
+	}
+
+	return reorgInfos, dataTypes, nil
+}
+
+// function to get the account that a reorganization message reads, the reorganized account if it names no source
+func (s *StorageReorganizer) GetSource(reorgMessage ReorgInfo) common.Address {
+
+	if reorgMessage.Source != nil {
+
+		return *reorgMessage.Source
+	}
+
+	return s.addr
+}
+
+// returns the sources read by the reorganization messages, sorted by their addresses
+func (s *StorageReorganizer) GetSourceAccounts() []common.Address {
+
+	found := make(map[common.Address]bool)
+	accounts := make([]common.Address, 0)
+
+	for _, reorgMessage := range s.reorgMessges {
+
+		if source := s.GetSource(reorgMessage); source != s.addr && !found[source] {
+
+			found[source] = true
+			accounts = append(accounts, source)
+		}
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return bytes.Compare(accounts[i][:], accounts[j][:]) < 0 })
+
+	return accounts
+}
+
+// function to delete the storage of the sources when the merge is commited
+func (s *StorageReorganizer) SetClearSources(clearSources bool) {
+
+	s.clearSources = clearSources
+}
+
+// returns the slots of a source that hold data but were not read by the reorganization, sorted by their keys. They
+// are only lost if the sources are cleared, otherwise nil is returned
+func (s *StorageReorganizer) GetOrphanedSourceSlots(account common.Address) []common.Hash {
+
+	if !s.clearSources {
+
+		return nil
+	}
+
+	orphanedSlots := make([]common.Hash, 0)
+
+	for key, value := range s.state.GetStorageAsMap(account) {
+
+		if value != (common.Hash{}) && !s.sourceReadKeys[account][key] {
+
+			orphanedSlots = append(orphanedSlots, key)
+		}
+	}
+
+	sort.Slice(orphanedSlots, func(i, j int) bool { return orphanedSlots[i].Big().Cmp(orphanedSlots[j].Big()) < 0 })
+
+	return orphanedSlots
+}
+
+// function to delete the storage of the sources, it is called by Commit before the reorganized storage is written
+func (s *StorageReorganizer) clearSourceAccounts() {
+
+	if !s.clearSources {
+
+		return
+	}
+
+	for _, account := range s.GetSourceAccounts() {
+
+		keys := make([]common.Hash, 0)
+
+		for key := range s.state.GetStorageAsMap(account) {
+
+			keys = append(keys, key)
+		}
+
+		s.state.DeleteKeysFromStorage(account, keys)
+	}
+}
+
+// function to read the merge of a test, nil if the test does not merge storage. It returns the layouts and the storage
+// of the sources and the options of the merge
+func readMergeSources(directoryPath string) ([]AccountLayout, map[common.Address]*map[common.Hash]StorageSlot, MergeOptions, error) {
+
+	var options MergeOptions
+
+	if _, err := os.Stat(directoryPath + "/" + "merge.json"); err != nil {
+
+		return nil, nil, options, nil
+	}
+
+	if err := readJSONFile(directoryPath+"/"+"merge.json", &options); err != nil {
+
+		return nil, nil, options, err
+	}
+
+	sources := make([]AccountLayout, 0, len(options.Sources))
+	storages := make(map[common.Address]*map[common.Hash]StorageSlot)
+
+	for _, source := range options.Sources {
+
+		if source.Account == (common.Address{}) {
+
+			return nil, nil, options, errors.New("The Reorganized Account Can Not Be A Source Of A Merge")
+		}
+
+		layout, err := ReadStorageLayoutFromFile(directoryPath + "/" + source.Layout)
+
+		if err != nil {
+
+			return nil, nil, options, err
+		}
+
+		sources = append(sources, AccountLayout{Account: source.Account, Layout: layout})
+
+		if source.Storage != "" {
+
+			if storages[source.Account], err = ReadStorageFromFile(directoryPath + "/" + source.Storage); err != nil {
+
+				return nil, nil, options, err
+			}
+		}
+	}
+
+	return sources, storages, options, nil
+}
+
+// function to generate the plan of a test or of the options directory of the plan command, which may split the
+// storage of the reorganized account across several accounts or merge the storage of several accounts into it
+func generateDirectoryPlan(directoryPath string, oldLayout, newLayout *StorageLayout, options PlanOptions) ([]ReorgInfo, []DataType, error) {
+
+	targets, _, err := readSplitTargets(directoryPath)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	sources, _, mergeOptions, err := readMergeSources(directoryPath)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	if len(targets) != 0 && len(sources) != 0 {
+
+		return nil, nil, errors.New("A Plan Can Not Both Split And Merge Storage")
+
+	} else if len(sources) != 0 {
+
+		return GenerateMergePlan(oldLayout, newLayout, sources, mergeOptions.Owners, options)
+	}
+
+	return GenerateSplitPlan(oldLayout, newLayout, targets, options)
+}
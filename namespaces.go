@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// formulas of the locations of namespaced storage
+	LocationERC7201 = "erc7201" // keccak256(abi.encode(uint256(keccak256(namespace)) - 1)) & ~bytes32(uint256(0xff))
+	LocationDiamond = "diamond" // keccak256(position), the diamond storage of EIP-2535
+)
+
+// the NatSpec annotation of a namespaced struct, e.g. /// @custom:storage-location erc7201:example.main, followed by
+// the struct it annotates
+var storageLocationPattern = regexp.MustCompile(`@custom:storage-location\s+([^\s*]+)[^;{}]*?\bstruct\s+([A-Za-z_$][A-Za-z0-9_$]*)`)
+
+// struct to represent a struct that is stored at the root of a namespace instead of the sequential slots of a contract
+type NamespaceDeclaration struct {
+	Label    string `json:"label,omitempty"` // label of the storage item, the name of the struct if empty
+	Struct   string `json:"struct"`          // name of the struct, qualified with the contract if it is defined in another contract
+	Location string `json:"location"`        // formula and namespace, e.g. erc7201:example.main or diamond:diamond.storage.x
+}
+
+// function to compute the root slot of a namespace according to ERC-7201
+func ComputeERC7201Root(namespace string) common.Hash {
+
+	namespaceHash := new(big.Int).Sub(crypto.Keccak256Hash([]byte(namespace)).Big(), big.NewInt(1))
+	root := crypto.Keccak256Hash(common.BigToHash(namespaceHash).Bytes())
+
+	// the last byte is cleared, so the members of the struct do not collide with other namespaces
+	root[31] = 0
+
+	return root
+}
+
+// function to compute the root slot of the diamond storage at the given position, which is keccak256(position)
+func ComputeDiamondRoot(position string) common.Hash {
+
+	return crypto.Keccak256Hash([]byte(position))
+}
+
+// function to compute the root slot of a location given as formula and namespace, e.g. erc7201:example.main
+func ComputeNamespaceRoot(location string) (common.Hash, error) {
+
+	separator := strings.Index(location, ":")
+
+	if separator == -1 || separator == len(location)-1 {
+
+		return common.Hash{}, errors.New("Invalid Storage Location " + location + ", Expected <formula>:<namespace>")
+	}
+
+	formula, namespace := location[:separator], location[separator+1:]
+
+	if formula == LocationERC7201 {
+
+		return ComputeERC7201Root(namespace), nil
+
+	} else if formula == LocationDiamond {
+
+		return ComputeDiamondRoot(namespace), nil
+	}
+
+	return common.Hash{}, errors.New("Unknown Storage Location Formula " + formula + " Of " + location)
+}
+
+// function to add the namespaces of the structs annotated with @custom:storage-location to the contracts that define
+// the structs
+func addStorageLocations(source string, declarations *SourceDeclarations) {
+
+	for _, match := range storageLocationPattern.FindAllStringSubmatch(source, -1) {
+
+		location, structName := match[1], match[2]
+
+	contracts:
+		for i := range declarations.Contracts {
+
+			contract := &declarations.Contracts[i]
+
+			for _, structDeclaration := range contract.Structs {
+
+				if structDeclaration.Name != structName {
+
+					continue
+				}
+
+				// a contract that already has the namespace of the struct is followed by a contract with the same struct
+				for _, namespace := range contract.Namespaces {
+
+					if namespace.Struct == structName {
+
+						continue contracts
+					}
+				}
+
+				contract.Namespaces = append(contract.Namespaces, NamespaceDeclaration{Struct: structName, Location: location})
+				break contracts
+			}
+		}
+	}
+}
+
+// function to place the structs of the namespaces of the linearized contracts at their roots. The namespaces of the
+// base contracts come first. Libraries can not have state variables, their namespaces are used by the contracts through
+// storage pointers, so the namespaces of all libraries of the declarations are placed as well
+func (b *layoutBuilder) placeNamespaces(linearization []string) error {
+
+	contractNames := make([]string, 0, len(linearization))
+
+	for i := len(linearization) - 1; i >= 0; i-- {
+
+		contractNames = append(contractNames, linearization[i])
+	}
+
+	for _, contract := range b.declarations.Contracts {
+
+		if contract.Kind == "library" {
+
+			contractNames = append(contractNames, contract.Name)
+		}
+	}
+
+	roots := make(map[string]string)
+
+	for _, item := range b.layout.Storage {
+
+		if item.Namespace != "" {
+
+			roots[item.Slot] = item.Label
+		}
+	}
+
+	for _, contractName := range contractNames {
+
+		for _, namespace := range b.contracts[contractName].Namespaces {
+
+			label := namespace.Label
+
+			if label == "" {
+
+				label = namespace.Struct[strings.LastIndex(namespace.Struct, ".")+1:]
+			}
+
+			root, err := ComputeNamespaceRoot(namespace.Location)
+
+			if err != nil {
+
+				return errors.New(contractName + "." + label + ": " + err.Error())
+			}
+
+			slot := root.Big().String()
+
+			if roots[slot] == label {
+
+				// the layout already has the namespace, e.g. a layout read from a file
+				continue
+
+			} else if roots[slot] != "" {
+
+				return errors.New("Namespaces Of " + roots[slot] + " And " + label + " Have The Same Root " + root.Hex())
+			}
+
+			for _, item := range b.layout.Storage {
+
+				if item.Label == label {
+
+					return errors.New("Label Of Namespace " + namespace.Location + " Is Already Used By Another Variable " + label)
+				}
+			}
+
+			typeName, err := parseSolidityType(namespace.Struct)
+
+			if err != nil {
+
+				return err
+			}
+
+			typeId, err := b.resolveType(typeName, contractName, "storage")
+
+			if err != nil {
+
+				return errors.New(contractName + "." + label + ": " + err.Error())
+			}
+
+			if len(b.layout.Types[typeId].Members) == 0 {
+
+				return errors.New("Namespace " + namespace.Location + " Of " + contractName + " Is Not A Struct " + namespace.Struct)
+			}
+
+			b.layout.Storage = append(b.layout.Storage, StorageItem{
+				AstId:     b.nextAstId,
+				Contract:  b.getContractPath(contractName),
+				Label:     label,
+				Slot:      slot,
+				Type:      typeId,
+				Namespace: namespace.Location,
+			})
+
+			b.nextAstId++
+			roots[slot] = label
+		}
+	}
+
+	return nil
+}
+
+// adds the namespaced structs of a contract to a layout that was read from a build artifact, since solc does not
+// include them in the storage layout. The contract is given by its name or its fully qualified name, if it is empty the
+// default contract of the declarations is used. Contracts that are not declared have no namespaces
+func AddNamespacedStorage(layout *StorageLayout, declarations *SourceDeclarations, contractName string) error {
+
+	contractName = contractName[strings.LastIndex(contractName, ":")+1:]
+
+	if contractName == "" {
+
+		contractName = getDefaultContract(declarations)
+	}
+
+	builder := newLayoutBuilder(declarations, layout)
+
+	if _, found := builder.contracts[contractName]; !found {
+
+		return nil
+	}
+
+	linearization, err := builder.linearize(contractName, make(map[string]bool))
+
+	if err != nil {
+
+		return err
+	}
+
+	return builder.placeNamespaces(linearization)
+}
+
+// function to merge the declarations of several sources into one, so the namespaces of a contract whose bases are
+// defined in other sources can be placed. Contracts of later sources replace contracts with the same name
+func mergeDeclarations(declarations []*SourceDeclarations, sourceName string) *SourceDeclarations {
+
+	merged := &SourceDeclarations{Source: sourceName, Contracts: make([]ContractDeclaration, 0)}
+
+	for _, source := range declarations {
+
+		merged.Structs = append(merged.Structs, source.Structs...)
+		merged.Enums = append(merged.Enums, source.Enums...)
+		merged.ValueTypes = append(merged.ValueTypes, source.ValueTypes...)
+		merged.Contracts = append(merged.Contracts, source.Contracts...)
+	}
+
+	return merged
+}
+
+// prints the roots of the given storage locations
+func runNamespace(locations []string) error {
+
+	for _, location := range locations {
+
+		root, err := ComputeNamespaceRoot(location)
+
+		if err != nil {
+
+			return err
+		}
+
+		fmt.Println(location + ": " + root.Hex() + " (" + root.Big().String() + ")")
+	}
+
+	return nil
+}
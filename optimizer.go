@@ -0,0 +1,680 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// objectives of the packing optimizer
+	OptimizeSlots  = "slots"  // minimize the number of slots, then the number of slots of the hot variables
+	OptimizeSloads = "sloads" // minimize the number of slots of the hot variables, then the number of slots
+
+	// gas costs of the storage operations since the Berlin and London forks
+	GasColdSload   = 2100  // first access of a slot in a transaction
+	GasSstoreSet   = 20000 // writing a non zero value into a zero slot
+	GasSstoreReset = 2900  // writing into a non zero slot
+
+	// the exact search for the best packing is only used for segments with at most this many packable variables
+	maxExactPackingItems = 14
+)
+
+// struct that holds the inputs of the packing optimizer
+type OptimizerOptions struct {
+	Objective string   `json:"objective"` // OptimizeSlots if empty
+	Hot       []string `json:"hot"`       // variables that are read together by the hot paths of the contract
+	Fixed     []string `json:"fixed"`     // variables that keep their position in addition to inherited variables and gaps
+
+	MappingKeys map[string]MappingKeys `json:"mappingKeys"` // keys of the mappings whose values are moved
+}
+
+// struct that holds the gas estimate of an optimized layout
+type GasEstimate struct {
+	OldSlots        uint64 `json:"oldSlots"`
+	NewSlots        uint64 `json:"newSlots"`
+	OldHotSlots     uint64 `json:"oldHotSlots"`
+	NewHotSlots     uint64 `json:"newHotSlots"`
+	MigrationGas    uint64 `json:"migrationGas"`    // reading the moved slots, writing them and clearing the old slots
+	SavedGasPerCall uint64 `json:"savedGasPerCall"` // cold SLOADs saved by a call that reads all the hot variables
+}
+
+// struct that holds the variables of a packing bin, i.e. of a single slot
+type packingBin struct {
+	used  uint64
+	hot   bool
+	items []int
+}
+
+// function to check if a type is a value type that can share a slot with other value types
+func isPackable(typeDescription TypeDescription) bool {
+
+	return typeDescription.Encoding == "inplace" && typeDescription.Base == "" && len(typeDescription.Members) == 0
+}
+
+// function to find the position of a variable that is declared at the given position, following the packing rules of
+// Solidity. Value types share a slot if they fit, structs and arrays start and end at slot boundaries
+func placeItem(slot *big.Int, offset uint64, typeDescription TypeDescription) (*big.Int, uint64, *big.Int, uint64, error) {
+
+	numberOfBytes, ok := new(big.Int).SetString(typeDescription.NumberOfBytes, 10)
+
+	if !ok || !numberOfBytes.IsUint64() {
+
+		return nil, 0, nil, 0, errors.New("Invalid Number Of Bytes For Type " + typeDescription.Label)
+	}
+
+	size := numberOfBytes.Uint64()
+
+	if isPackable(typeDescription) {
+
+		if offset+size > 32 {
+
+			slot, offset = new(big.Int).Add(slot, big.NewInt(1)), 0
+		}
+
+		return slot, offset, slot, offset + size, nil
+	}
+
+	if offset > 0 {
+
+		slot = new(big.Int).Add(slot, big.NewInt(1))
+	}
+
+	numberOfSlots := new(big.Int).SetUint64((size + 31) / 32)
+
+	return slot, 0, new(big.Int).Add(slot, numberOfSlots), 0, nil
+}
+
+// function to check if a variable must keep its position. Variables of inherited contracts and storage gaps keep
+// their positions, so the layouts of the base contracts do not change
+func isFixedItem(item StorageItem, layout *StorageLayout, options OptimizerOptions) bool {
+
+	for _, label := range options.Fixed {
+
+		if label == item.Label {
+
+			return true
+		}
+	}
+
+	// namespaced structs are stored at the roots of their namespaces
+	if item.Namespace != "" {
+
+		return true
+	}
+
+	// solc lists the variables of the most derived contract last, followed by the namespaced structs
+	mostDerivedContract := ""
+
+	for i := len(layout.Storage) - 1; i >= 0 && mostDerivedContract == ""; i-- {
+
+		if layout.Storage[i].Namespace == "" {
+
+			mostDerivedContract = layout.Storage[i].Contract
+		}
+	}
+
+	return item.Contract != mostDerivedContract || IsStorageGap(item, layout.Types)
+}
+
+// function to compare the costs of two packings according to the objective
+func isPackingBetter(bins, hotBins, bestBins, bestHotBins int, objective string) bool {
+
+	if objective == OptimizeSloads {
+
+		return hotBins < bestHotBins || (hotBins == bestHotBins && bins < bestBins)
+	}
+
+	return bins < bestBins || (bins == bestBins && hotBins < bestHotBins)
+}
+
+// function to search the packing of value types into slots that is best for the objective. The items are sorted by
+// size and each item is put into every slot it fits into or into a new slot
+func searchPacking(sizes []uint64, hot []bool, index int, bins []packingBin, hotBins int, best *[]packingBin, bestHotBins *int, objective string) {
+
+	if *best != nil && !isPackingBetter(len(bins), hotBins, len(*best), *bestHotBins, objective) {
+
+		return
+	}
+
+	if index == len(sizes) {
+
+		*best = make([]packingBin, len(bins))
+
+		for i, bin := range bins {
+
+			(*best)[i] = packingBin{used: bin.used, hot: bin.hot, items: append([]int{}, bin.items...)}
+		}
+
+		*bestHotBins = hotBins
+		return
+	}
+
+	for i := range bins {
+
+		if bins[i].used+sizes[index] > 32 {
+
+			continue
+		}
+
+		previous := bins[i]
+		addedHotBin := hot[index] && !bins[i].hot
+
+		bins[i] = packingBin{used: previous.used + sizes[index], hot: previous.hot || hot[index], items: append(append([]int{}, previous.items...), index)}
+
+		if addedHotBin {
+
+			searchPacking(sizes, hot, index+1, bins, hotBins+1, best, bestHotBins, objective)
+
+		} else {
+
+			searchPacking(sizes, hot, index+1, bins, hotBins, best, bestHotBins, objective)
+		}
+
+		bins[i] = previous
+	}
+
+	newBin := packingBin{used: sizes[index], hot: hot[index], items: []int{index}}
+
+	if hot[index] {
+
+		searchPacking(sizes, hot, index+1, append(bins, newBin), hotBins+1, best, bestHotBins, objective)
+
+	} else {
+
+		searchPacking(sizes, hot, index+1, append(bins, newBin), hotBins, best, bestHotBins, objective)
+	}
+}
+
+// function to pack value types into slots by putting every item into the first slot it fits into. Hot items are
+// packed first so that they share as few slots as possible
+func packFirstFit(sizes []uint64, hot []bool) []packingBin {
+
+	bins := make([]packingBin, 0)
+
+	for _, hotPass := range []bool{true, false} {
+
+		for index := range sizes {
+
+			if hot[index] != hotPass {
+
+				continue
+			}
+
+			found := false
+
+			for i := range bins {
+
+				if bins[i].used+sizes[index] <= 32 {
+
+					bins[i].used += sizes[index]
+					bins[i].hot = bins[i].hot || hot[index]
+					bins[i].items = append(bins[i].items, index)
+					found = true
+
+					break
+				}
+			}
+
+			if !found {
+
+				bins = append(bins, packingBin{used: sizes[index], hot: hot[index], items: []int{index}})
+			}
+		}
+	}
+
+	return bins
+}
+
+// function to order the movable variables of a segment. The packable variables are grouped into the slots found by the
+// packing search, hot slots first, and the other variables follow in their declared order
+func orderSegment(segment []StorageItem, types map[string]TypeDescription, hotLabels map[string]bool, objective string) ([]StorageItem, error) {
+
+	packable := make([]StorageItem, 0)
+	others := make([]StorageItem, 0)
+
+	for _, item := range segment {
+
+		if isPackable(types[item.Type]) {
+
+			packable = append(packable, item)
+
+		} else {
+
+			others = append(others, item)
+		}
+	}
+
+	sizes := make([]uint64, len(packable))
+	hot := make([]bool, len(packable))
+
+	for i, item := range packable {
+
+		numberOfBytes, ok := new(big.Int).SetString(types[item.Type].NumberOfBytes, 10)
+
+		if !ok || !numberOfBytes.IsUint64() || numberOfBytes.Uint64() > 32 {
+
+			return nil, errors.New("Invalid Number Of Bytes For Type " + item.Type)
+		}
+
+		sizes[i] = numberOfBytes.Uint64()
+		hot[i] = hotLabels[item.Label]
+	}
+
+	// larger items first, so the search finds good packings early
+	indices := make([]int, len(packable))
+
+	for i := range indices {
+
+		indices[i] = i
+	}
+
+	sort.SliceStable(indices, func(i, j int) bool { return sizes[indices[i]] > sizes[indices[j]] })
+
+	sortedItems := make([]StorageItem, len(packable))
+	sortedSizes := make([]uint64, len(packable))
+	sortedHot := make([]bool, len(packable))
+
+	for i, index := range indices {
+
+		sortedItems[i], sortedSizes[i], sortedHot[i] = packable[index], sizes[index], hot[index]
+	}
+
+	packable, sizes, hot = sortedItems, sortedSizes, sortedHot
+
+	var bins []packingBin
+
+	if len(packable) <= maxExactPackingItems {
+
+		bestHotBins := 0
+		searchPacking(sizes, hot, 0, make([]packingBin, 0), 0, &bins, &bestHotBins, objective)
+
+	} else {
+
+		bins = packFirstFit(sizes, hot)
+	}
+
+	sort.SliceStable(bins, func(i, j int) bool { return bins[i].hot && !bins[j].hot })
+
+	ordered := make([]StorageItem, 0, len(segment))
+
+	for _, bin := range bins {
+
+		for _, index := range bin.items {
+
+			ordered = append(ordered, packable[index])
+		}
+	}
+
+	return append(ordered, others...), nil
+}
+
+// function to assign the positions of the variables declared in the given order. Fixed variables keep their positions
+func placeItems(items []StorageItem, fixed []bool, types map[string]TypeDescription) ([]StorageItem, error) {
+
+	placed := make([]StorageItem, 0, len(items))
+	slot, offset := big.NewInt(0), uint64(0)
+
+	for i, item := range items {
+
+		typeDescription, found := types[item.Type]
+
+		if !found {
+
+			return nil, errors.New("Type not found " + item.Type)
+		}
+
+		// namespaced structs are not part of the sequential slots
+		if item.Namespace != "" {
+
+			placed = append(placed, item)
+			continue
+		}
+
+		if fixed[i] {
+
+			fixedSlot, ok := new(big.Int).SetString(item.Slot, 10)
+
+			if !ok {
+
+				return nil, errors.New("Invalid Slot " + item.Slot)
+			}
+
+			itemSlot, itemOffset, _, _, err := placeItem(slot, offset, typeDescription)
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			// the variables before a fixed variable must not grow into it
+			if itemSlot.Cmp(fixedSlot) > 0 || (itemSlot.Cmp(fixedSlot) == 0 && itemOffset > item.Offset) {
+
+				return nil, errors.New("Variables Before " + item.Label + " Do Not Fit Before Its Fixed Position")
+			}
+
+			_, _, slot, offset, err = placeItem(fixedSlot, item.Offset, typeDescription)
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			placed = append(placed, item)
+			continue
+		}
+
+		itemSlot, itemOffset, nextSlot, nextOffset, err := placeItem(slot, offset, typeDescription)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		item.Slot = itemSlot.String()
+		item.Offset = itemOffset
+		slot, offset = nextSlot, nextOffset
+
+		placed = append(placed, item)
+	}
+
+	return placed, nil
+}
+
+// function to count the slots used by a layout and the slots used by its hot variables
+func countSlots(layout *StorageLayout, hotLabels map[string]bool) (uint64, uint64, error) {
+
+	slotMap, err := NewSlotMap(layout)
+
+	if err != nil {
+
+		return 0, 0, err
+	}
+
+	hotSlots := make(map[string]bool)
+
+	for _, segment := range slotMap.Segments {
+
+		if hotLabels[segment.Root] {
+
+			hotSlots[segment.Slot.String()] = true
+		}
+	}
+
+	return uint64(len(slotMap.Slots())), uint64(len(hotSlots)), nil
+}
+
+// function to estimate the gas used to move the variables of the old layout to their positions in the new layout. The
+// moved slots are read, written and cleared, assuming all of them are non zero. The data stored at keccak256 of a
+// moved slot and the refunds for cleared slots are not included
+func estimateMigrationGas(oldLayout, newLayout *StorageLayout) (uint64, error) {
+
+	oldSlotMap, err := NewSlotMap(oldLayout)
+
+	if err != nil {
+
+		return 0, err
+	}
+
+	newSlotMap, err := NewSlotMap(newLayout)
+
+	if err != nil {
+
+		return 0, err
+	}
+
+	moved := make(map[string]bool)
+
+	for _, oldItem := range oldLayout.Storage {
+
+		newItem, found := newLayout.FindItem(oldItem.Label)
+		moved[oldItem.Label] = found && (newItem.Slot != oldItem.Slot || newItem.Offset != oldItem.Offset)
+	}
+
+	oldSlots := make(map[string]bool)
+	readSlots := make(map[string]bool)
+	writtenSlots := make(map[string]bool)
+
+	for _, segment := range oldSlotMap.Segments {
+
+		oldSlots[segment.Slot.String()] = true
+
+		if moved[segment.Root] {
+
+			readSlots[segment.Slot.String()] = true
+		}
+	}
+
+	for _, segment := range newSlotMap.Segments {
+
+		if moved[segment.Root] {
+
+			writtenSlots[segment.Slot.String()] = true
+		}
+	}
+
+	gas := uint64(len(readSlots)) * GasColdSload
+
+	for slot := range writtenSlots {
+
+		if !readSlots[slot] {
+
+			gas += GasColdSload
+		}
+
+		if oldSlots[slot] {
+
+			gas += GasSstoreReset
+
+		} else {
+
+			gas += GasSstoreSet
+		}
+	}
+
+	// the old slots that are not reused are cleared
+	for slot := range readSlots {
+
+		if !writtenSlots[slot] {
+
+			gas += GasSstoreReset
+		}
+	}
+
+	return gas, nil
+}
+
+// searches a declaration order of the variables of a layout that uses fewer slots, or fewer slots for the hot variables.
+// Variables of inherited contracts, storage gaps and the fixed variables of the options keep their positions, the
+// variables between them are reordered. Returns the optimized layout, the plan that moves the storage into it and a gas
+// estimate. If no better order is found, the optimized layout is the old layout and the plan is empty
+func OptimizeLayout(layout *StorageLayout, options OptimizerOptions) (*StorageLayout, []ReorgInfo, []DataType, GasEstimate, error) {
+
+	if options.Objective == "" {
+
+		options.Objective = OptimizeSlots
+	}
+
+	if options.Objective != OptimizeSlots && options.Objective != OptimizeSloads {
+
+		return nil, nil, nil, GasEstimate{}, errors.New("Invalid Optimizer Objective " + options.Objective)
+	}
+
+	hotLabels := make(map[string]bool)
+
+	for _, label := range options.Hot {
+
+		if _, found := layout.FindItem(label); !found {
+
+			return nil, nil, nil, GasEstimate{}, errors.New("Hot Variable Not Found In Layout " + label)
+		}
+
+		hotLabels[label] = true
+	}
+
+	optimizedLayout := &StorageLayout{Storage: layout.Storage, Types: layout.Types}
+	reorgInfos, dataTypes := make([]ReorgInfo, 0), make([]DataType, 0)
+
+	var err error
+	estimate := GasEstimate{}
+
+	if estimate.OldSlots, estimate.OldHotSlots, err = countSlots(layout, hotLabels); err != nil {
+
+		return nil, nil, nil, GasEstimate{}, err
+	}
+
+	estimate.NewSlots, estimate.NewHotSlots = estimate.OldSlots, estimate.OldHotSlots
+
+	if len(layout.Storage) != 0 {
+
+		items := make([]StorageItem, 0, len(layout.Storage))
+		fixed := make([]bool, 0, len(layout.Storage))
+		segment := make([]StorageItem, 0)
+
+		// the movable variables between two fixed variables are ordered as one segment
+		flushSegment := func() error {
+
+			ordered, err := orderSegment(segment, layout.Types, hotLabels, options.Objective)
+
+			if err != nil {
+
+				return err
+			}
+
+			for _, item := range ordered {
+
+				items = append(items, item)
+				fixed = append(fixed, false)
+			}
+
+			segment = make([]StorageItem, 0)
+			return nil
+		}
+
+		for _, item := range layout.Storage {
+
+			if !isFixedItem(item, layout, options) {
+
+				segment = append(segment, item)
+				continue
+			}
+
+			if err := flushSegment(); err != nil {
+
+				return nil, nil, nil, GasEstimate{}, err
+			}
+
+			items = append(items, item)
+			fixed = append(fixed, true)
+		}
+
+		if err := flushSegment(); err != nil {
+
+			return nil, nil, nil, GasEstimate{}, err
+		}
+
+		placedItems, err := placeItems(items, fixed, layout.Types)
+
+		if err != nil {
+
+			return nil, nil, nil, GasEstimate{}, err
+		}
+
+		candidate := &StorageLayout{Storage: placedItems, Types: layout.Types}
+
+		newSlots, newHotSlots, err := countSlots(candidate, hotLabels)
+
+		if err != nil {
+
+			return nil, nil, nil, GasEstimate{}, err
+		}
+
+		// the old order is kept unless the new order is better, so the storage is not touched in vain
+		if isPackingBetter(int(newSlots), int(newHotSlots), int(estimate.OldSlots), int(estimate.OldHotSlots), options.Objective) {
+
+			optimizedLayout = candidate
+			estimate.NewSlots, estimate.NewHotSlots = newSlots, newHotSlots
+
+			if reorgInfos, dataTypes, err = GenerateReorgPlan(layout, optimizedLayout, PlanOptions{MappingKeys: options.MappingKeys}); err != nil {
+
+				return nil, nil, nil, GasEstimate{}, err
+			}
+		}
+	}
+
+	if estimate.MigrationGas, err = estimateMigrationGas(layout, optimizedLayout); err != nil {
+
+		return nil, nil, nil, GasEstimate{}, err
+	}
+
+	if estimate.NewHotSlots < estimate.OldHotSlots {
+
+		estimate.SavedGasPerCall = (estimate.OldHotSlots - estimate.NewHotSlots) * GasColdSload
+	}
+
+	return optimizedLayout, reorgInfos, dataTypes, estimate, nil
+}
+
+// optimizes a layout and writes the new layout, the plan and the gas estimate to the output directory
+func runOptimize(layoutPath, outputDirectory, optionsPath string) error {
+
+	layout, err := ReadStorageLayoutFromFile(layoutPath)
+
+	if err != nil {
+
+		return err
+	}
+
+	options := OptimizerOptions{}
+
+	if optionsPath != "" {
+
+		if err := readJSONFile(optionsPath, &options); err != nil {
+
+			return err
+		}
+	}
+
+	optimizedLayout, reorgInfos, dataTypes, estimate, err := OptimizeLayout(layout, options)
+
+	if err != nil {
+
+		return err
+	}
+
+	outputs := map[string]interface{}{
+		"new_layout.json":         optimizedLayout,
+		"storage_reorg_info.json": reorgInfos,
+		"data_types.json":         dataTypes,
+		"gas_estimate.json":       estimate,
+	}
+
+	for name, value := range outputs {
+
+		data, err := json.MarshalIndent(value, "", "  ")
+
+		if err != nil {
+
+			return err
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(outputDirectory, name), data, 0644); err != nil {
+
+			return err
+		}
+	}
+
+	for _, item := range optimizedLayout.Storage {
+
+		fmt.Println(fmt.Sprintf("%-20s slot %s offset %d", item.Label, item.Slot, item.Offset))
+	}
+
+	fmt.Println(green + fmt.Sprintf("%d slots instead of %d, %d slots of hot variables instead of %d", estimate.NewSlots, estimate.OldSlots, estimate.NewHotSlots, estimate.OldHotSlots) + reset)
+	fmt.Println(green + fmt.Sprintf("Migration gas %d, saved gas per call %d", estimate.MigrationGas, estimate.SavedGasPerCall) + reset)
+
+	return nil
+}
@@ -0,0 +1,806 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// struct that describes how the value of a variable of the new layout is computed by a registered transform or by an expression
+type TransformSpec struct {
+	Transform  string   `json:"transform"`
+	Inputs     []string `json:"inputs"`     // labels of the old variables passed to the transform, the variable itself if empty
+	Expression string   `json:"expression"` // expression over the old variables, used instead of a transform
+}
+
+// struct that holds the optional inputs of the planner
+type PlanOptions struct {
+	InitialValues      map[string]json.RawMessage
+	Transforms         map[string]TransformSpec
+	MappingKeys        map[string]MappingKeys // keys of the mappings whose values are reorganized
+	TruncationPolicies map[string]string      // policies of the fixed size arrays that shrink, see arrays.go
+	Structs            map[string]StructSpec  // added and removed members of structs, see structs.go
+	FieldMappings      map[string]string      // old paths of the fields moved into or out of structs, see fields.go
+}
+
+// function to find the storage objects that are present in both the old and the new layout.
+// A storage object is common if it is paired with an object of the new layout, see PairStorageItems, and has the same
+// data type in both layouts. Storage gaps are common if they are present in both layouts, whatever their length, see
+// gaps.go
+func GetCommonObjects(oldLayout, newLayout *StorageLayout) ([]ReorgInfo, error) {
+
+	reorgInfos := make([]ReorgInfo, 0)
+	pairs := PairStorageItems(oldLayout, newLayout)
+
+	for i, oldItem := range oldLayout.Storage {
+
+		if j, found := pairs[i]; found {
+
+			newItem := newLayout.Storage[j]
+
+			if IsStorageGap(oldItem, oldLayout.Types) != IsStorageGap(newItem, newLayout.Types) {
+
+				continue
+
+			} else if IsStorageGap(oldItem, oldLayout.Types) {
+
+				reorgInfo, err := GetStorageGap(oldItem, newItem, oldLayout, newLayout)
+
+				if err != nil {
+
+					return nil, err
+				}
+
+				reorgInfos = append(reorgInfos, reorgInfo)
+				continue
+			}
+
+			isTypeEqual := IsTypeEqual(oldItem.Type, newItem.Type, oldLayout.Types, newLayout.Types)
+			isConversion := !isTypeEqual && IsValueTypeConversion(oldItem.Type, newItem.Type, oldLayout.Types, newLayout.Types)
+			isResize := !isTypeEqual && (IsFixedArrayResize(oldItem.Type, newItem.Type, oldLayout.Types, newLayout.Types) || IsArrayKindConversion(oldItem.Type, newItem.Type, oldLayout.Types, newLayout.Types))
+
+			if !isTypeEqual && !isConversion && !isResize {
+
+				continue
+			}
+
+			if ContainsInternalFunction(oldItem.Type, oldLayout.Types) {
+
+				return nil, errors.New("Internal Function Pointer " + oldItem.Label + " Can Not Be Reorganized, Its Value Depends On The Code Of The Old Contract")
+			}
+
+			prevSlot, err := SlotToHash(oldItem.Slot)
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			newSlot, err := SlotToHash(newItem.Slot)
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			reorgInfo := ReorgInfo{
+				Label:      oldItem.Label,
+				Type:       oldItem.Type,
+				PrevSlot:   prevSlot,
+				NewSlot:    newSlot,
+				PrevOffset: oldItem.Offset,
+				NewOffset:  newItem.Offset,
+			}
+
+			//converted values keep their bytes, the new type is only recorded. Resized arrays need the new length
+			if isConversion || isResize {
+
+				reorgInfo.NewType = newItem.Type
+			}
+
+			setDeclaringContracts(&reorgInfo, oldItem, newItem, oldLayout, newLayout)
+			reorgInfos = append(reorgInfos, reorgInfo)
+		}
+	}
+
+	return reorgInfos, nil
+}
+
+// function to convert a type of the layouts into a DataType. The base types and the member types are processed first
+func processType(oldLayout, newLayout *StorageLayout, typeName string, insertedTypes map[string]bool, dataTypes *[]DataType) error {
+
+	if insertedTypes[typeName] {
+
+		return nil
+	}
+
+	oldType, found := oldLayout.Types[typeName]
+
+	if !found {
+
+		return errors.New("Type not found " + typeName)
+	}
+
+	newType, found := newLayout.Types[typeName]
+
+	if !found {
+
+		return errors.New("Type not found in new layout " + typeName)
+	}
+
+	prevNumberOfBytes, err := oldLayout.GetNumberOfBytes(typeName)
+
+	if err != nil {
+
+		return err
+	}
+
+	newNumberOfBytes, err := newLayout.GetNumberOfBytes(typeName)
+
+	if err != nil {
+
+		return err
+	}
+
+	insertedTypes[typeName] = true
+
+	dataType := DataType{
+		Type:              typeName,
+		Label:             oldType.Label,
+		Base:              oldType.Base,
+		Encoding:          oldType.Encoding,
+		PrevNumberOfBytes: prevNumberOfBytes,
+		NewNumberOfBytes:  newNumberOfBytes,
+		Key:               oldType.Key,
+		Value:             oldType.Value,
+		EnumMapping:       GetEnumMapping(oldType.EnumMembers, newType.EnumMembers),
+		UnderlyingType:    oldType.UnderlyingType,
+	}
+
+	//if there is a base type process it too
+	if oldType.Base != "" {
+
+		if err := processType(oldLayout, newLayout, oldType.Base, insertedTypes, dataTypes); err != nil {
+
+			return err
+		}
+	}
+
+	//if the data type is a struct then process the members that are present in both layouts
+	if len(oldType.Members) != 0 {
+
+		newMembers := make(map[string]StorageItem)
+
+		for _, member := range newType.Members {
+
+			newMembers[member.Label] = member
+		}
+
+		for _, member := range oldType.Members {
+
+			newMember, found := newMembers[member.Label]
+
+			// members whose type changed are handled like a removed and an added member
+			if !found || !IsTypeEqual(member.Type, newMember.Type, oldLayout.Types, newLayout.Types) {
+
+				continue
+			}
+
+			prevSlot, err := SlotToHash(member.Slot)
+
+			if err != nil {
+
+				return err
+			}
+
+			newSlot, err := SlotToHash(newMember.Slot)
+
+			if err != nil {
+
+				return err
+			}
+
+			dataType.Members = append(dataType.Members, Member{
+				Label:      member.Label,
+				PrevOffset: member.Offset,
+				NewOffset:  newMember.Offset,
+				PrevSlot:   prevSlot,
+				NewSlot:    newSlot,
+				Type:       member.Type,
+			})
+
+			if err := processType(oldLayout, newLayout, member.Type, insertedTypes, dataTypes); err != nil {
+
+				return err
+			}
+		}
+	}
+
+	//if the data type is a mapping then process the key and the value types
+	for _, typeName := range []string{oldType.Key, oldType.Value} {
+
+		if typeName == "" {
+
+			continue
+		}
+
+		if err := processType(oldLayout, newLayout, typeName, insertedTypes, dataTypes); err != nil {
+
+			return err
+		}
+	}
+
+	*dataTypes = append(*dataTypes, dataType)
+
+	return nil
+}
+
+// function to convert a type that is only used by variables of the new layout into a DataType. The old size and
+// the old positions of the members are zero
+func processNewType(newLayout *StorageLayout, typeName string, insertedTypes map[string]bool, dataTypes *[]DataType) error {
+
+	if insertedTypes[typeName] {
+
+		return nil
+	}
+
+	newType, found := newLayout.Types[typeName]
+
+	if !found {
+
+		return errors.New("Type not found in new layout " + typeName)
+	}
+
+	newNumberOfBytes, err := newLayout.GetNumberOfBytes(typeName)
+
+	if err != nil {
+
+		return err
+	}
+
+	insertedTypes[typeName] = true
+
+	dataType := DataType{
+		Type:             typeName,
+		Label:            newType.Label,
+		Base:             newType.Base,
+		Encoding:         newType.Encoding,
+		NewNumberOfBytes: newNumberOfBytes,
+		Key:              newType.Key,
+		Value:            newType.Value,
+		UnderlyingType:   newType.UnderlyingType,
+	}
+
+	if newType.Base != "" {
+
+		if err := processNewType(newLayout, newType.Base, insertedTypes, dataTypes); err != nil {
+
+			return err
+		}
+	}
+
+	for _, member := range newType.Members {
+
+		newSlot, err := SlotToHash(member.Slot)
+
+		if err != nil {
+
+			return err
+		}
+
+		dataType.Members = append(dataType.Members, Member{
+			Label:     member.Label,
+			NewOffset: member.Offset,
+			NewSlot:   newSlot,
+			Type:      member.Type,
+		})
+
+		if err := processNewType(newLayout, member.Type, insertedTypes, dataTypes); err != nil {
+
+			return err
+		}
+	}
+
+	for _, typeName := range []string{newType.Key, newType.Value} {
+
+		if typeName == "" {
+
+			continue
+		}
+
+		if err := processNewType(newLayout, typeName, insertedTypes, dataTypes); err != nil {
+
+			return err
+		}
+	}
+
+	*dataTypes = append(*dataTypes, dataType)
+
+	return nil
+}
+
+// function to convert a type that is only used by variables of the old layout into a DataType. The new size and
+// the new positions of the members are zero
+func processOldType(oldLayout *StorageLayout, typeName string, insertedTypes map[string]bool, dataTypes *[]DataType) error {
+
+	if insertedTypes[typeName] {
+
+		return nil
+	}
+
+	oldType, found := oldLayout.Types[typeName]
+
+	if !found {
+
+		return errors.New("Type not found " + typeName)
+	}
+
+	prevNumberOfBytes, err := oldLayout.GetNumberOfBytes(typeName)
+
+	if err != nil {
+
+		return err
+	}
+
+	insertedTypes[typeName] = true
+
+	dataType := DataType{
+		Type:              typeName,
+		Label:             oldType.Label,
+		Base:              oldType.Base,
+		Encoding:          oldType.Encoding,
+		PrevNumberOfBytes: prevNumberOfBytes,
+		Key:               oldType.Key,
+		Value:             oldType.Value,
+		UnderlyingType:    oldType.UnderlyingType,
+	}
+
+	if oldType.Base != "" {
+
+		if err := processOldType(oldLayout, oldType.Base, insertedTypes, dataTypes); err != nil {
+
+			return err
+		}
+	}
+
+	for _, member := range oldType.Members {
+
+		prevSlot, err := SlotToHash(member.Slot)
+
+		if err != nil {
+
+			return err
+		}
+
+		dataType.Members = append(dataType.Members, Member{
+			Label:      member.Label,
+			PrevOffset: member.Offset,
+			PrevSlot:   prevSlot,
+			Type:       member.Type,
+		})
+
+		if err := processOldType(oldLayout, member.Type, insertedTypes, dataTypes); err != nil {
+
+			return err
+		}
+	}
+
+	for _, typeName := range []string{oldType.Key, oldType.Value} {
+
+		if typeName == "" {
+
+			continue
+		}
+
+		if err := processOldType(oldLayout, typeName, insertedTypes, dataTypes); err != nil {
+
+			return err
+		}
+	}
+
+	*dataTypes = append(*dataTypes, dataType)
+
+	return nil
+}
+
+// function to convert a type that may be present in only one of the layouts into a DataType
+func processAnyType(oldLayout, newLayout *StorageLayout, typeName string, insertedTypes map[string]bool, dataTypes *[]DataType) error {
+
+	_, inOldLayout := oldLayout.Types[typeName]
+	_, inNewLayout := newLayout.Types[typeName]
+
+	if inOldLayout && inNewLayout {
+
+		return processType(oldLayout, newLayout, typeName, insertedTypes, dataTypes)
+
+	} else if inNewLayout {
+
+		return processNewType(newLayout, typeName, insertedTypes, dataTypes)
+	}
+
+	return processOldType(oldLayout, typeName, insertedTypes, dataTypes)
+}
+
+// function to find the data types of the storage objects that require reorganization
+func GetDataTypes(oldLayout, newLayout *StorageLayout, reorgInfos []ReorgInfo) ([]DataType, error) {
+
+	insertedTypes := make(map[string]bool)
+	dataTypes := make([]DataType, 0)
+
+	for _, reorgInfo := range reorgInfos {
+
+		if reorgInfo.IsComputed() || reorgInfo.NewType != "" {
+
+			continue
+		}
+
+		if err := processType(oldLayout, newLayout, reorgInfo.Type, insertedTypes, &dataTypes); err != nil {
+
+			return nil, err
+		}
+	}
+
+	//the transformed and converted variables may use types that are present in only one of the layouts
+	for _, reorgInfo := range reorgInfos {
+
+		if !reorgInfo.IsTransformed() && reorgInfo.NewType == "" {
+
+			continue
+		}
+
+		typeNames := []string{reorgInfo.Type}
+
+		//the elements of a resized array keep their old and new sizes
+		if IsFixedArrayResize(reorgInfo.Type, reorgInfo.NewType, oldLayout.Types, newLayout.Types) || IsArrayKindConversion(reorgInfo.Type, reorgInfo.NewType, oldLayout.Types, newLayout.Types) {
+
+			typeNames = []string{oldLayout.Types[reorgInfo.Type].Base, reorgInfo.Type}
+		}
+
+		if reorgInfo.NewType != "" {
+
+			typeNames = append(typeNames, reorgInfo.NewType)
+		}
+
+		for _, input := range reorgInfo.Inputs {
+
+			typeNames = append(typeNames, input.Type)
+		}
+
+		for _, typeName := range typeNames {
+
+			if err := processAnyType(oldLayout, newLayout, typeName, insertedTypes, &dataTypes); err != nil {
+
+				return nil, err
+			}
+		}
+	}
+
+	//the types of the initialized variables are processed last so that types used by both layouts, e.g. by the inputs
+	//of transforms and expressions, keep their old size
+	for _, reorgInfo := range reorgInfos {
+
+		if reorgInfo.InitialValue == nil || reorgInfo.IsTransformed() {
+
+			continue
+		}
+
+		if err := processNewType(newLayout, reorgInfo.Type, insertedTypes, &dataTypes); err != nil {
+
+			return nil, err
+		}
+	}
+
+	return dataTypes, nil
+}
+
+// function to create reorganization messages that compute the values of variables of the new layout with transforms
+func GetTransforms(oldLayout, newLayout *StorageLayout, transforms map[string]TransformSpec) ([]ReorgInfo, error) {
+
+	reorgInfos := make([]ReorgInfo, 0)
+
+	for label := range transforms {
+
+		if _, found := newLayout.FindItem(label); !found {
+
+			return nil, errors.New("Transformed Variable Not Found In New Layout " + label)
+		}
+	}
+
+	for _, newItem := range newLayout.Storage {
+
+		spec, found := transforms[newItem.Label]
+
+		if !found {
+
+			continue
+		}
+
+		newSlot, err := SlotToHash(newItem.Slot)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		reorgInfo := ReorgInfo{
+			Label:     newItem.Label,
+			Type:      newItem.Type,
+			NewSlot:   newSlot,
+			NewOffset: newItem.Offset,
+			Transform: spec.Transform,
+		}
+
+		inputLabels := spec.Inputs
+
+		// expressions take the old variables they reference as inputs
+		if spec.Expression != "" {
+
+			if spec.Transform != "" || len(spec.Inputs) != 0 {
+
+				return nil, errors.New("Expression Can Not Be Combined With A Transform Or Inputs For " + newItem.Label)
+			}
+
+			expression, err := ParseExpression(spec.Expression)
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			reorgInfo.Expression = spec.Expression
+			inputLabels = expression.Variables()
+
+		} else if spec.Transform == "" {
+
+			return nil, errors.New("No Transform Or Expression For " + newItem.Label)
+
+		} else if len(spec.Inputs) == 0 {
+
+			// without inputs the old value of the variable itself is transformed
+			oldItem, found := oldLayout.FindItem(newItem.Label)
+
+			if !found {
+
+				return nil, errors.New("Transformed Variable Not Found In Old Layout " + newItem.Label)
+			}
+
+			prevSlot, err := SlotToHash(oldItem.Slot)
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			reorgInfo.Type = oldItem.Type
+			reorgInfo.PrevSlot = prevSlot
+			reorgInfo.PrevOffset = oldItem.Offset
+
+			if oldItem.Type != newItem.Type {
+
+				reorgInfo.NewType = newItem.Type
+			}
+		}
+
+		for _, inputLabel := range inputLabels {
+
+			oldItem, found := oldLayout.FindItem(inputLabel)
+
+			if !found {
+
+				return nil, errors.New("Transform Input Not Found In Old Layout " + inputLabel)
+			}
+
+			prevSlot, err := SlotToHash(oldItem.Slot)
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			reorgInfo.Inputs = append(reorgInfo.Inputs, TransformInput{
+				Label:      oldItem.Label,
+				Type:       oldItem.Type,
+				PrevSlot:   prevSlot,
+				PrevOffset: oldItem.Offset,
+			})
+		}
+
+		reorgInfos = append(reorgInfos, reorgInfo)
+	}
+
+	return reorgInfos, nil
+}
+
+// function to create reorganization messages that initialize the variables that are only present in the new layout
+func GetInitializers(oldLayout, newLayout *StorageLayout, initialValues map[string]json.RawMessage) ([]ReorgInfo, error) {
+
+	reorgInfos := make([]ReorgInfo, 0)
+
+	for label := range initialValues {
+
+		if _, found := newLayout.FindItem(label); !found {
+
+			return nil, errors.New("Initialized Variable Not Found In New Layout " + label)
+		}
+
+		if _, found := oldLayout.FindItem(label); found {
+
+			return nil, errors.New("Initialized Variable Already Present In Old Layout " + label)
+		}
+	}
+
+	for _, newItem := range newLayout.Storage {
+
+		initialValue, found := initialValues[newItem.Label]
+
+		if !found {
+
+			continue
+		}
+
+		newSlot, err := SlotToHash(newItem.Slot)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		reorgInfos = append(reorgInfos, ReorgInfo{
+			Label:        newItem.Label,
+			Type:         newItem.Type,
+			PrevSlot:     common.Hash{},
+			NewSlot:      newSlot,
+			NewOffset:    newItem.Offset,
+			InitialValue: initialValue,
+		})
+	}
+
+	return reorgInfos, nil
+}
+
+// function to add the keys whose values are reorganized to the reorganization messages of mappings
+func AddMappingKeys(reorgInfos []ReorgInfo, oldLayout *StorageLayout, mappingKeys map[string]MappingKeys) error {
+
+	for label, keys := range mappingKeys {
+
+		found := false
+
+		for i := range reorgInfos {
+
+			if reorgInfos[i].Label != label || reorgInfos[i].IsComputed() {
+
+				continue
+			}
+
+			if !IsMappingEncoding(oldLayout.Types[reorgInfos[i].Type].Encoding) {
+
+				return errors.New("Keys Given For Variable That Is Not A Mapping " + label)
+			}
+
+			reorgInfos[i].Keys = keys.Keys
+			reorgInfos[i].Complete = keys.Complete
+			found = true
+		}
+
+		if !found {
+
+			return errors.New("Keys Given For Mapping That Is Not Present In Both Layouts " + label)
+		}
+	}
+
+	return nil
+}
+
+// generates the reorganization messages and the data types required to reorganize the storage of a contract
+// from the old layout to the new layout. Variables of the new layout that have an initial value are initialized and
+// variables that have a transform are computed instead of being copied
+func GenerateReorgPlan(oldLayout, newLayout *StorageLayout, options PlanOptions) ([]ReorgInfo, []DataType, error) {
+
+	commonObjects, err := GetCommonObjects(oldLayout, newLayout)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	reorgInfos := make([]ReorgInfo, 0, len(commonObjects))
+
+	for _, reorgInfo := range commonObjects {
+
+		if _, found := options.Transforms[reorgInfo.Label]; !found {
+
+			reorgInfos = append(reorgInfos, reorgInfo)
+		}
+	}
+
+	fieldMappings, err := GetFieldMappings(oldLayout, newLayout, options.FieldMappings, commonObjects)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	reorgInfos = append(reorgInfos, fieldMappings...)
+
+	initializers, err := GetInitializers(oldLayout, newLayout, options.InitialValues)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	if err := AddMappingKeys(reorgInfos, oldLayout, options.MappingKeys); err != nil {
+
+		return nil, nil, err
+	}
+
+	if err := AddTruncationPolicies(reorgInfos, oldLayout, newLayout, options.TruncationPolicies); err != nil {
+
+		return nil, nil, err
+	}
+
+	reorgInfos = append(reorgInfos, initializers...)
+
+	transforms, err := GetTransforms(oldLayout, newLayout, options.Transforms)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	reorgInfos = append(reorgInfos, transforms...)
+
+	dataTypes, err := GetDataTypes(oldLayout, newLayout, reorgInfos)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	if dataTypes, err = AddStructChanges(dataTypes, oldLayout, newLayout, options.Structs); err != nil {
+
+		return nil, nil, err
+	}
+
+	dataTypesMap := make(map[string]DataType)
+
+	for _, dataType := range dataTypes {
+
+		dataTypesMap[dataType.Type] = dataType
+	}
+
+	// expressions are type checked when the plan is generated so that errors are found before reorganizing
+	for _, reorgInfo := range reorgInfos {
+
+		if reorgInfo.Expression == "" {
+
+			continue
+		}
+
+		if _, err := CheckReorgExpression(reorgInfo, dataTypesMap); err != nil {
+
+			return nil, nil, err
+		}
+	}
+
+	for _, dataType := range dataTypes {
+
+		for _, member := range dataType.AddedMembers {
+
+			if member.Expression == "" {
+
+				continue
+			}
+
+			memberInfo := ReorgInfo{Label: member.Label, Type: member.Type, Expression: member.Expression, Inputs: member.Inputs}
+
+			if _, err := CheckReorgExpression(memberInfo, dataTypesMap); err != nil {
+
+				return nil, nil, err
+			}
+		}
+	}
+
+	return reorgInfos, dataTypes, nil
+}
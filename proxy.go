@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// the slots of EIP-1967, bytes32(uint256(keccak256('eip1967.proxy.<name>')) - 1), which hold the state of the proxy
+// instead of the state of the implementation
+var eip1967Slots = map[string]common.Hash{
+	"eip1967.implementation": common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc"),
+	"eip1967.admin":          common.HexToHash("0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103"),
+	"eip1967.beacon":         common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50"),
+}
+
+// the slots protected in proxy mode if no slots are configured
+var DefaultProtectedSlots = []string{"eip1967.implementation", "eip1967.admin", "eip1967.beacon"}
+
+// struct that holds the options of the proxy mode of a reorganization
+type ProxyOptions struct {
+	ProtectedSlots []string `json:"protectedSlots"` // the slots of EIP-1967 if omitted, see ParseProtectedSlot
+}
+
+// function to parse a protected slot, given as the name of an EIP-1967 slot, e.g. eip1967.admin, as a storage
+// location, e.g. erc7201:openzeppelin.storage.Initializable, or as a hex or decimal slot number
+func ParseProtectedSlot(entry string) (common.Hash, error) {
+
+	if slot, found := eip1967Slots[entry]; found {
+
+		return slot, nil
+
+	} else if strings.HasPrefix(entry, "0x") && len(entry) <= 66 {
+
+		slot, ok := new(big.Int).SetString(entry[2:], 16)
+
+		if ok {
+
+			return common.BigToHash(slot), nil
+		}
+
+	} else if slot, ok := new(big.Int).SetString(entry, 10); ok && slot.Sign() >= 0 && slot.BitLen() <= 256 {
+
+		return common.BigToHash(slot), nil
+
+	} else if strings.Contains(entry, ":") {
+
+		return ComputeNamespaceRoot(entry)
+	}
+
+	return common.Hash{}, errors.New("Invalid Protected Slot " + entry)
+}
+
+// function to get the protected slots of the proxy options, which are the slots of EIP-1967 if none are configured
+func (o ProxyOptions) GetProtectedSlots() ([]common.Hash, error) {
+
+	entries := o.ProtectedSlots
+
+	if entries == nil {
+
+		entries = DefaultProtectedSlots
+	}
+
+	slots := make([]common.Hash, 0, len(entries))
+
+	for _, entry := range entries {
+
+		slot, err := ParseProtectedSlot(entry)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		slots = append(slots, slot)
+	}
+
+	return slots, nil
+}
+
+// function to enable the proxy mode. The protected slots are neither moved nor deleted by the reorganization, and the
+// reorganization fails if it writes to one of them
+func (s *StorageReorganizer) SetProtectedSlots(slots []common.Hash) {
+
+	s.protectedSlots = make(map[common.Hash]bool)
+
+	for _, slot := range slots {
+
+		s.protectedSlots[slot] = true
+	}
+}
+
+// function to check if a slot is protected by the proxy mode
+func (s *StorageReorganizer) IsProtected(key common.Hash) bool {
+
+	return s.protectedSlots[key]
+}
+
+// function to check that the reorganization did not write to a protected slot
+func (s *StorageReorganizer) checkProtectedSlots() error {
+
+	for key := range s.modifiedStorage[s.addr] {
+
+		if s.IsProtected(key) {
+
+			return errors.New("Reorganization Writes To Protected Slot " + key.Hex())
+		}
+	}
+
+	return nil
+}
+
+// returns the slots of the old storage that hold data but were not read by the reorganization, sorted by their keys.
+// Commit deletes them, so their data is lost. Protected slots and the slots of mappings that keep their values in
+// place are kept by Commit and are not reported
+func (s *StorageReorganizer) GetOrphanedSlots() []common.Hash {
+
+	orphanedSlots := make([]common.Hash, 0)
+
+	for key, value := range s.commitedStorage {
+
+		if value != (common.Hash{}) && !s.readKeys[key] && !s.IsProtected(key) && !s.isKeptSlot(key) {
+
+			orphanedSlots = append(orphanedSlots, key)
+		}
+	}
+
+	sort.Slice(orphanedSlots, func(i, j int) bool { return orphanedSlots[i].Big().Cmp(orphanedSlots[j].Big()) < 0 })
+
+	return orphanedSlots
+}
+
+// function to check that the variables of a layout do not use a protected slot. Only the slots of the variables and
+// of the namespaced structs are checked, the slots of the data of mappings and dynamic arrays are checked by the
+// reorganization when it writes them
+func CheckProtectedSlots(layout *StorageLayout, protectedSlots []common.Hash) error {
+
+	slotMap, err := NewSlotMap(layout)
+
+	if err != nil {
+
+		return err
+	}
+
+	for _, protectedSlot := range protectedSlots {
+
+		if segments := slotMap.SegmentsInSlot(protectedSlot.Big()); len(segments) != 0 {
+
+			return errors.New("Protected Slot " + protectedSlot.Hex() + " Collides With " + segments[0].Label)
+		}
+	}
+
+	return nil
+}
+
+// function to read the protected slots of a test, nil if the test does not use the proxy mode
+func readProtectedSlots(directoryPath string) ([]common.Hash, error) {
+
+	if _, err := os.Stat(directoryPath + "/" + "proxy.json"); err != nil {
+
+		return nil, nil
+	}
+
+	var options ProxyOptions
+
+	if err := readJSONFile(directoryPath+"/"+"proxy.json", &options); err != nil {
+
+		return nil, err
+	}
+
+	return options.GetProtectedSlots()
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// struct that describes a registered version of the storage layout of a contract
+type LayoutVersion struct {
+	Version    string `json:"version"`
+	Layout     string `json:"layout"`            // path of the storage layout or build artifact, relative to the registry file
+	Source     string `json:"source,omitempty"`  // path of the source the layout was generated from, used to check the source hash
+	Compiler   string `json:"compiler"`          // version of the compiler that generated the layout
+	SourceHash string `json:"sourceHash"`        // keccak256 of the source the layout was generated from
+	Options    string `json:"options,omitempty"` // directory with the plan options of the upgrade from the previous version
+}
+
+// struct that holds the registered versions of the storage layout of a contract, ordered from the oldest to the newest
+type LayoutRegistry struct {
+	Contract  string          `json:"contract"`
+	Versions  []LayoutVersion `json:"versions"`
+	Cache     string          `json:"cache,omitempty"` // directory where derived plans are cached, relative to the registry file
+	directory string          // directory of the registry file, the paths of the versions are relative to it
+}
+
+// struct that holds a derived plan together with the key of the inputs it was derived from
+type CachedPlan struct {
+	Key        string      `json:"key"`
+	ReorgInfos []ReorgInfo `json:"reorgInfos"`
+	DataTypes  []DataType  `json:"dataTypes"`
+}
+
+// struct that describes a problem of a registered version
+type RegistryIssue struct {
+	Version      string
+	Message      string
+	Incompatible bool // no plan can be derived from the previous version
+}
+
+var sourceHashPattern = regexp.MustCompile(`^0x[0-9a-f]{64}$`)
+
+// reads a layout registry from a JSON file
+func ReadLayoutRegistryFromFile(filePath string) (*LayoutRegistry, error) {
+
+	var registry LayoutRegistry
+
+	if err := readJSONFile(filePath, &registry); err != nil {
+
+		return nil, err
+	}
+
+	registry.directory = filepath.Dir(filePath)
+
+	return &registry, nil
+}
+
+// function to get the path of a file of the registry
+func (r *LayoutRegistry) getPath(path string) string {
+
+	if filepath.IsAbs(path) {
+
+		return path
+	}
+
+	return filepath.Join(r.directory, path)
+}
+
+// function to find the index of a registered version
+func (r *LayoutRegistry) FindVersion(version string) (int, error) {
+
+	for i, layoutVersion := range r.Versions {
+
+		if layoutVersion.Version == version {
+
+			return i, nil
+		}
+	}
+
+	return -1, errors.New("Version Not Registered " + version + " Of " + r.Contract)
+}
+
+// function to read the storage layout of a registered version, which may also be a build artifact, see LoadStorageLayout
+func (r *LayoutRegistry) ReadLayout(index int) (*StorageLayout, error) {
+
+	return LoadStorageLayout(r.getPath(r.Versions[index].Layout), r.Contract)
+}
+
+// function to read the plan options of the upgrade from the previous version to the version with the given index
+func (r *LayoutRegistry) ReadOptions(index int) (PlanOptions, error) {
+
+	if r.Versions[index].Options == "" {
+
+		return PlanOptions{}, nil
+	}
+
+	return ReadPlanOptionsFromDirectory(r.getPath(r.Versions[index].Options))
+}
+
+// checks that the versions are unique and that every version has a readable layout, a compiler version and a valid
+// source hash. If the source of a version is registered its hash must match the source hash
+func (r *LayoutRegistry) Validate() error {
+
+	if r.Contract == "" {
+
+		return errors.New("Registry Without Contract Name")
+	}
+
+	if len(r.Versions) == 0 {
+
+		return errors.New("No Versions Registered For " + r.Contract)
+	}
+
+	versions := make(map[string]bool)
+
+	for i, layoutVersion := range r.Versions {
+
+		if layoutVersion.Version == "" {
+
+			return fmt.Errorf("Version %d Of %s Has No Name", i, r.Contract)
+		}
+
+		if versions[layoutVersion.Version] {
+
+			return errors.New("Version Registered Twice " + layoutVersion.Version)
+		}
+
+		versions[layoutVersion.Version] = true
+
+		if layoutVersion.Compiler == "" {
+
+			return errors.New("No Compiler Version For Version " + layoutVersion.Version)
+		}
+
+		if !sourceHashPattern.MatchString(layoutVersion.SourceHash) {
+
+			return errors.New("Invalid Source Hash For Version " + layoutVersion.Version)
+		}
+
+		if layoutVersion.Source != "" {
+
+			source, err := ioutil.ReadFile(r.getPath(layoutVersion.Source))
+
+			if err != nil {
+
+				return err
+			}
+
+			if crypto.Keccak256Hash(source).Hex() != layoutVersion.SourceHash {
+
+				return errors.New("Source Hash Mismatch For Version " + layoutVersion.Version)
+			}
+		}
+
+		if _, err := r.ReadLayout(i); err != nil {
+
+			return errors.New("Can Not Read Layout Of Version " + layoutVersion.Version + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// checks every upgrade between two consecutive versions. Versions whose plan can not be derived from the previous
+// version are incompatible, unsafe changes reported by the upgrade safety checker are reported as well
+func (r *LayoutRegistry) CheckVersions() ([]RegistryIssue, error) {
+
+	issues := make([]RegistryIssue, 0)
+
+	for i := 1; i < len(r.Versions); i++ {
+
+		version := r.Versions[i].Version
+
+		oldLayout, err := r.ReadLayout(i - 1)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		newLayout, err := r.ReadLayout(i)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		if _, _, err := r.generateUpgradePlan(i); err != nil {
+
+			issues = append(issues, RegistryIssue{Version: version, Message: err.Error(), Incompatible: true})
+			continue
+		}
+
+		results, err := CheckLayouts(oldLayout, newLayout)
+
+		if err != nil {
+
+			issues = append(issues, RegistryIssue{Version: version, Message: err.Error(), Incompatible: true})
+			continue
+		}
+
+		for _, result := range results {
+
+			if result.Unsafe {
+
+				issues = append(issues, RegistryIssue{Version: version, Message: result.Label + ": " + result.Message})
+			}
+		}
+	}
+
+	return issues, nil
+}
+
+// function to generate the plan of the upgrade from the previous version to the version with the given index
+func (r *LayoutRegistry) generateUpgradePlan(index int) ([]ReorgInfo, []DataType, error) {
+
+	oldLayout, err := r.ReadLayout(index - 1)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	newLayout, err := r.ReadLayout(index)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	options, err := r.ReadOptions(index)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	return GenerateReorgPlan(oldLayout, newLayout, options)
+}
+
+// function to compute the key of a derived plan from the contents of the layouts and the options it depends on, so a
+// cached plan is derived again if one of them changed
+func (r *LayoutRegistry) getPlanKey(fromIndex, toIndex int) (common.Hash, error) {
+
+	first, last := fromIndex, toIndex
+
+	if first > last {
+
+		first, last = last, first
+	}
+
+	data := []byte(r.Contract + "\n" + r.Versions[fromIndex].Version + "\n" + r.Versions[toIndex].Version + "\n")
+
+	for i := first; i <= last; i++ {
+
+		layout, err := ioutil.ReadFile(r.getPath(r.Versions[i].Layout))
+
+		if err != nil {
+
+			return common.Hash{}, err
+		}
+
+		data = append(data, crypto.Keccak256(layout)...)
+
+		if i == first || r.Versions[i].Options == "" {
+
+			continue
+		}
+
+		// only the option files are part of the key, the other files of the directory do not change the plan
+		for _, name := range []string{"initial_values.json", "transforms.json", "mapping_keys.json", "truncation_policies.json", "struct_members.json", "field_mappings.json"} {
+
+			option, err := ioutil.ReadFile(filepath.Join(r.getPath(r.Versions[i].Options), name))
+
+			if err == nil {
+
+				data = append(data, crypto.Keccak256([]byte(name), option)...)
+			}
+		}
+	}
+
+	return crypto.Keccak256Hash(data), nil
+}
+
+// function to get the path of the cached plan between two versions
+func (r *LayoutRegistry) getCachePath(cacheDirectory, fromVersion, toVersion string) string {
+
+	return filepath.Join(cacheDirectory, r.Contract+"_"+fromVersion+"_"+toVersion+".json")
+}
+
+// derives the plan that reorganizes the storage from one registered version to another. An upgrade composes the plans of
+// the versions in between, a downgrade inverts the plan of the upgrade. If a cache directory is given, the derived plan
+// is cached there and reused as long as the layouts and the options it depends on do not change
+func (r *LayoutRegistry) DerivePlan(fromVersion, toVersion, cacheDirectory string) ([]ReorgInfo, []DataType, error) {
+
+	fromIndex, err := r.FindVersion(fromVersion)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	toIndex, err := r.FindVersion(toVersion)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	key, err := r.getPlanKey(fromIndex, toIndex)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	cachePath := r.getCachePath(cacheDirectory, fromVersion, toVersion)
+
+	if cacheDirectory != "" {
+
+		if data, err := ioutil.ReadFile(cachePath); err == nil {
+
+			var cachedPlan CachedPlan
+
+			if json.Unmarshal(data, &cachedPlan) == nil && cachedPlan.Key == key.Hex() {
+
+				return cachedPlan.ReorgInfos, cachedPlan.DataTypes, nil
+			}
+		}
+	}
+
+	reorgInfos, dataTypes, err := r.derivePlan(fromIndex, toIndex)
+
+	if err != nil {
+
+		return nil, nil, err
+	}
+
+	if cacheDirectory != "" {
+
+		data, err := json.MarshalIndent(CachedPlan{Key: key.Hex(), ReorgInfos: reorgInfos, DataTypes: dataTypes}, "", "  ")
+
+		if err != nil {
+
+			return nil, nil, err
+		}
+
+		if err := os.MkdirAll(cacheDirectory, 0755); err != nil {
+
+			return nil, nil, err
+		}
+
+		if err := ioutil.WriteFile(cachePath, data, 0644); err != nil {
+
+			return nil, nil, err
+		}
+	}
+
+	return reorgInfos, dataTypes, nil
+}
+
+// function to derive the plan between two versions without the cache
+func (r *LayoutRegistry) derivePlan(fromIndex, toIndex int) ([]ReorgInfo, []DataType, error) {
+
+	if fromIndex == toIndex {
+
+		return make([]ReorgInfo, 0), make([]DataType, 0), nil
+	}
+
+	if fromIndex > toIndex {
+
+		reorgInfos, dataTypes, err := r.derivePlan(toIndex, fromIndex)
+
+		if err != nil {
+
+			return nil, nil, err
+		}
+
+		oldLayout, err := r.ReadLayout(toIndex)
+
+		if err != nil {
+
+			return nil, nil, err
+		}
+
+		inverseReorgInfos, inverseDataTypes, err := InvertLosslessReorgPlan(oldLayout, reorgInfos, dataTypes)
+
+		if err != nil {
+
+			return nil, nil, errors.New("Can Not Downgrade From " + r.Versions[fromIndex].Version + " To " + r.Versions[toIndex].Version + ": " + err.Error())
+		}
+
+		return inverseReorgInfos, inverseDataTypes, nil
+	}
+
+	reorgInfos, dataTypes, err := r.generateUpgradePlan(fromIndex + 1)
+
+	if err != nil {
+
+		return nil, nil, errors.New("Can Not Upgrade To Version " + r.Versions[fromIndex+1].Version + ": " + err.Error())
+	}
+
+	for i := fromIndex + 2; i <= toIndex; i++ {
+
+		nextReorgInfos, nextDataTypes, err := r.generateUpgradePlan(i)
+
+		if err != nil {
+
+			return nil, nil, errors.New("Can Not Upgrade To Version " + r.Versions[i].Version + ": " + err.Error())
+		}
+
+		if reorgInfos, dataTypes, err = ComposeReorgPlans(reorgInfos, dataTypes, nextReorgInfos, nextDataTypes); err != nil {
+
+			return nil, nil, err
+		}
+	}
+
+	return reorgInfos, dataTypes, nil
+}
+
+// function to get the directory where the derived plans are cached, empty if the registry does not cache plans
+func (r *LayoutRegistry) GetCacheDirectory() string {
+
+	if r.Cache == "" {
+
+		return ""
+	}
+
+	return r.getPath(r.Cache)
+}
+
+// validates a registry and checks its versions. If two versions are given, the plan between them is derived and
+// written to the output directory in the format of the tests
+func runRegistry(registryPath string, versions []string, outputDirectory string) error {
+
+	registry, err := ReadLayoutRegistryFromFile(registryPath)
+
+	if err != nil {
+
+		return err
+	}
+
+	if err := registry.Validate(); err != nil {
+
+		return err
+	}
+
+	if len(versions) == 0 {
+
+		issues, err := registry.CheckVersions()
+
+		if err != nil {
+
+			return err
+		}
+
+		numberOfIncompatibleVersions := 0
+
+		for _, issue := range issues {
+
+			color := yellow
+
+			if issue.Incompatible {
+
+				color = red
+				numberOfIncompatibleVersions++
+			}
+
+			fmt.Println(color + issue.Version + ": " + issue.Message + reset)
+		}
+
+		if numberOfIncompatibleVersions > 0 {
+
+			return fmt.Errorf("%d incompatible versions found", numberOfIncompatibleVersions)
+		}
+
+		fmt.Println(green + "All versions of " + registry.Contract + " are compatible 🎉🎉🎉" + reset)
+		return nil
+	}
+
+	reorgInfos, dataTypes, err := registry.DerivePlan(versions[0], versions[1], registry.GetCacheDirectory())
+
+	if err != nil {
+
+		return err
+	}
+
+	for name, value := range map[string]interface{}{"storage_reorg_info.json": reorgInfos, "data_types.json": dataTypes} {
+
+		data, err := json.MarshalIndent(value, "", "  ")
+
+		if err != nil {
+
+			return err
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(outputDirectory, name), data, 0644); err != nil {
+
+			return err
+		}
+	}
+
+	fmt.Println(green + fmt.Sprintf("Plan from %s to %s written to %s", versions[0], versions[1], outputDirectory) + reset)
+	return nil
+}
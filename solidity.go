@@ -0,0 +1,1735 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// struct to represent a state variable or a struct member in a declaration list. The type is written like in
+// Solidity, e.g. uint64[5][] or mapping(address => Position)
+type VariableDeclaration struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// struct to represent the declaration of a struct
+type StructDeclaration struct {
+	Name    string                `json:"name"`
+	Members []VariableDeclaration `json:"members"`
+}
+
+// struct to represent the declaration of an enum
+type EnumDeclaration struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// struct to represent the declaration of a user defined value type, e.g. type Price is uint128
+type ValueTypeDeclaration struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// struct to represent the declarations of a contract that affect its storage layout
+type ContractDeclaration struct {
+	Name       string                 `json:"name"`
+	Kind       string                 `json:"kind,omitempty"`  // contract if empty, abstract, interface or library
+	Bases      []string               `json:"bases,omitempty"` // base contracts in the order of the is clause
+	Structs    []StructDeclaration    `json:"structs,omitempty"`
+	Enums      []EnumDeclaration      `json:"enums,omitempty"`
+	ValueTypes []ValueTypeDeclaration `json:"valueTypes,omitempty"`
+	Variables  []VariableDeclaration  `json:"variables,omitempty"`  // state variables, constants and immutables are not included
+	Namespaces []NamespaceDeclaration `json:"namespaces,omitempty"` // structs stored at the roots of namespaces, see namespaces.go
+}
+
+// struct to represent the declarations of a source file
+type SourceDeclarations struct {
+	Source     string                 `json:"source"` // prefix of the contract of the storage items, e.g. the path of the source
+	Structs    []StructDeclaration    `json:"structs,omitempty"`
+	Enums      []EnumDeclaration      `json:"enums,omitempty"`
+	ValueTypes []ValueTypeDeclaration `json:"valueTypes,omitempty"`
+	Contracts  []ContractDeclaration  `json:"contracts"`
+}
+
+// struct to represent a parsed Solidity type name
+type solidityType struct {
+	Name       string          // elementary type or path of a user defined type, mapping, function or an empty name for arrays
+	Key        *solidityType   // key type of a mapping
+	Value      *solidityType   // value type of a mapping
+	Base       *solidityType   // base type of an array
+	Length     string          // length of a fixed size array, empty for dynamic arrays
+	Parameters []*solidityType // parameter types of a function type
+	Returns    []*solidityType // return types of a function type
+	Visibility string          // internal or external for function types
+	Mutability string          // pure, view, payable or nonpayable for function types
+}
+
+// struct that holds the state of the parser of Solidity declarations
+type solidityParser struct {
+	tokens   []string
+	position int
+}
+
+// struct that holds the state of the computation of a storage layout
+type layoutBuilder struct {
+	declarations   *SourceDeclarations
+	contracts      map[string]*ContractDeclaration
+	linearizations map[string][]string
+	layout         *StorageLayout
+	resolvingTypes map[string]bool
+	nextAstId      int64
+}
+
+// keywords that start a declaration of a contract member that is not a state variable
+var skippedMembers = map[string]bool{
+	"function": true, "modifier": true, "constructor": true, "fallback": true, "receive": true,
+	"event": true, "error": true, "using": true, "pragma": true, "import": true,
+}
+
+// function to split Solidity source code into tokens. Comments are dropped, string literals are kept as single tokens
+func tokenizeSolidity(source string) ([]string, error) {
+
+	tokens := make([]string, 0)
+
+	for i := 0; i < len(source); {
+
+		c := source[i]
+
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+
+			i++
+
+		} else if strings.HasPrefix(source[i:], "//") {
+
+			end := strings.IndexByte(source[i:], '\n')
+
+			if end == -1 {
+
+				break
+			}
+
+			i += end
+
+		} else if strings.HasPrefix(source[i:], "/*") {
+
+			end := strings.Index(source[i+2:], "*/")
+
+			if end == -1 {
+
+				return nil, errors.New("Unterminated Comment")
+			}
+
+			i += end + 4
+
+		} else if c == '"' || c == '\'' {
+
+			j := i + 1
+
+			for j < len(source) && source[j] != c {
+
+				if source[j] == '\\' {
+
+					j++
+				}
+
+				j++
+			}
+
+			if j >= len(source) {
+
+				return nil, errors.New("Unterminated String Literal")
+			}
+
+			tokens = append(tokens, source[i:j+1])
+			i = j + 1
+
+		} else if isIdentifierByte(c) {
+
+			j := i
+
+			for j < len(source) && isIdentifierByte(source[j]) {
+
+				j++
+			}
+
+			tokens = append(tokens, source[i:j])
+			i = j
+
+		} else if strings.HasPrefix(source[i:], "=>") {
+
+			tokens = append(tokens, "=>")
+			i += 2
+
+		} else {
+
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+// function to check if a byte can be part of an identifier or a number
+func isIdentifierByte(c byte) bool {
+
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// function to check if a token is an identifier
+func isIdentifier(token string) bool {
+
+	return token != "" && isIdentifierByte(token[0]) && (token[0] < '0' || token[0] > '9')
+}
+
+// returns the next token without consuming it, or an empty string at the end of the tokens
+func (p *solidityParser) peek() string {
+
+	if p.position >= len(p.tokens) {
+
+		return ""
+	}
+
+	return p.tokens[p.position]
+}
+
+// consumes the next token
+func (p *solidityParser) next() string {
+
+	token := p.peek()
+	p.position++
+
+	return token
+}
+
+// consumes the next token and checks that it is the expected token
+func (p *solidityParser) expect(expected string) error {
+
+	if token := p.next(); token != expected {
+
+		return errors.New("Expected " + expected + " But Found " + token)
+	}
+
+	return nil
+}
+
+// consumes an identifier
+func (p *solidityParser) expectIdentifier() (string, error) {
+
+	token := p.next()
+
+	if !isIdentifier(token) {
+
+		return "", errors.New("Expected Identifier But Found " + token)
+	}
+
+	return token, nil
+}
+
+// skips the tokens up to and including the closing bracket of the bracket that was just consumed
+func (p *solidityParser) skipBalanced(open, close string) error {
+
+	depth := 1
+
+	for depth > 0 {
+
+		token := p.next()
+
+		if token == "" {
+
+			return errors.New("Missing " + close)
+		}
+
+		if token == open {
+
+			depth++
+
+		} else if token == close {
+
+			depth--
+		}
+	}
+
+	return nil
+}
+
+// skips a statement or a definition up to the semicolon that ends it, or up to the end of its body
+func (p *solidityParser) skipStatement() error {
+
+	depth := 0
+
+	for {
+
+		token := p.next()
+
+		switch token {
+
+		case "":
+			return errors.New("Unexpected End Of Source")
+		case "(", "[":
+			depth++
+		case ")", "]":
+			depth--
+		case "{":
+			if err := p.skipBalanced("{", "}"); err != nil {
+
+				return err
+			}
+
+			if depth == 0 {
+
+				return nil
+			}
+		case ";":
+			if depth == 0 {
+
+				return nil
+			}
+		}
+	}
+}
+
+// parses a type name, e.g. uint64[5][], mapping(address => uint256) or function (uint256) external returns (uint256)
+func (p *solidityParser) parseType() (*solidityType, error) {
+
+	var typeName *solidityType
+	token := p.next()
+
+	if token == "mapping" {
+
+		if err := p.expect("("); err != nil {
+
+			return nil, err
+		}
+
+		key, err := p.parseType()
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		// mapping keys and values may be named
+		if isIdentifier(p.peek()) {
+
+			p.next()
+		}
+
+		if err := p.expect("=>"); err != nil {
+
+			return nil, err
+		}
+
+		value, err := p.parseType()
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		if isIdentifier(p.peek()) {
+
+			p.next()
+		}
+
+		if err := p.expect(")"); err != nil {
+
+			return nil, err
+		}
+
+		typeName = &solidityType{Name: "mapping", Key: key, Value: value}
+
+	} else if token == "function" {
+
+		parameters, err := p.parseParameters()
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		typeName = &solidityType{Name: "function", Parameters: parameters, Visibility: "internal", Mutability: "nonpayable"}
+
+		for {
+
+			token := p.peek()
+
+			if token == "internal" || token == "external" {
+
+				typeName.Visibility = p.next()
+
+			} else if token == "pure" || token == "view" || token == "payable" || token == "nonpayable" {
+
+				typeName.Mutability = p.next()
+
+			} else if token == "returns" {
+
+				p.next()
+
+				if typeName.Returns, err = p.parseParameters(); err != nil {
+
+					return nil, err
+				}
+
+			} else {
+
+				break
+			}
+		}
+
+	} else if isIdentifier(token) {
+
+		name := token
+
+		for p.peek() == "." {
+
+			p.next()
+			identifier, err := p.expectIdentifier()
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			name += "." + identifier
+		}
+
+		if name == "address" && p.peek() == "payable" {
+
+			name += " " + p.next()
+		}
+
+		typeName = &solidityType{Name: name}
+
+	} else {
+
+		return nil, errors.New("Expected Type But Found " + token)
+	}
+
+	for p.peek() == "[" {
+
+		p.next()
+		length := ""
+
+		if p.peek() != "]" {
+
+			length = p.next()
+		}
+
+		if err := p.expect("]"); err != nil {
+
+			return nil, err
+		}
+
+		typeName = &solidityType{Base: typeName, Length: length}
+	}
+
+	return typeName, nil
+}
+
+// parses the parameter list of a function type, the names and data locations of the parameters are dropped
+func (p *solidityParser) parseParameters() ([]*solidityType, error) {
+
+	if err := p.expect("("); err != nil {
+
+		return nil, err
+	}
+
+	parameters := make([]*solidityType, 0)
+
+	for p.peek() != ")" {
+
+		parameter, err := p.parseType()
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		parameters = append(parameters, parameter)
+
+		for isIdentifier(p.peek()) {
+
+			p.next()
+		}
+
+		if p.peek() == "," {
+
+			p.next()
+		}
+	}
+
+	p.next()
+	return parameters, nil
+}
+
+// function to get the canonical form of a type name, which is used in the declaration lists
+func (t *solidityType) String() string {
+
+	if t.Base != nil {
+
+		return t.Base.String() + "[" + t.Length + "]"
+
+	} else if t.Name == "mapping" {
+
+		return "mapping(" + t.Key.String() + " => " + t.Value.String() + ")"
+
+	} else if t.Name == "function" {
+
+		return "function (" + joinTypes(t.Parameters, ",") + ") " + t.Visibility + " " + t.Mutability + " returns (" + joinTypes(t.Returns, ",") + ")"
+	}
+
+	return t.Name
+}
+
+// function to join the canonical forms of type names
+func joinTypes(types []*solidityType, separator string) string {
+
+	names := make([]string, len(types))
+
+	for i, typeName := range types {
+
+		names[i] = typeName.String()
+	}
+
+	return strings.Join(names, separator)
+}
+
+// function to parse a type name written like in Solidity
+func parseSolidityType(typeName string) (*solidityType, error) {
+
+	tokens, err := tokenizeSolidity(typeName)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	parser := &solidityParser{tokens: tokens}
+	parsedType, err := parser.parseType()
+
+	if err != nil {
+
+		return nil, errors.New("Invalid Type " + typeName + ": " + err.Error())
+	}
+
+	if parser.peek() != "" {
+
+		return nil, errors.New("Invalid Type " + typeName)
+	}
+
+	return parsedType, nil
+}
+
+// parses a struct, enum or user defined value type definition. Returns false if the next tokens are not a type definition
+func (p *solidityParser) parseTypeDefinition(structs *[]StructDeclaration, enums *[]EnumDeclaration, valueTypes *[]ValueTypeDeclaration) (bool, error) {
+
+	switch p.peek() {
+
+	case "struct":
+
+		p.next()
+		name, err := p.expectIdentifier()
+
+		if err != nil {
+
+			return true, err
+		}
+
+		if err := p.expect("{"); err != nil {
+
+			return true, err
+		}
+
+		structDeclaration := StructDeclaration{Name: name, Members: make([]VariableDeclaration, 0)}
+
+		for p.peek() != "}" {
+
+			memberType, err := p.parseType()
+
+			if err != nil {
+
+				return true, err
+			}
+
+			memberName, err := p.expectIdentifier()
+
+			if err != nil {
+
+				return true, err
+			}
+
+			if err := p.expect(";"); err != nil {
+
+				return true, err
+			}
+
+			structDeclaration.Members = append(structDeclaration.Members, VariableDeclaration{Name: memberName, Type: memberType.String()})
+		}
+
+		p.next()
+		*structs = append(*structs, structDeclaration)
+
+	case "enum":
+
+		p.next()
+		name, err := p.expectIdentifier()
+
+		if err != nil {
+
+			return true, err
+		}
+
+		if err := p.expect("{"); err != nil {
+
+			return true, err
+		}
+
+		enumDeclaration := EnumDeclaration{Name: name, Members: make([]string, 0)}
+
+		for p.peek() != "}" {
+
+			member, err := p.expectIdentifier()
+
+			if err != nil {
+
+				return true, err
+			}
+
+			enumDeclaration.Members = append(enumDeclaration.Members, member)
+
+			if p.peek() == "," {
+
+				p.next()
+			}
+		}
+
+		p.next()
+		*enums = append(*enums, enumDeclaration)
+
+	case "type":
+
+		p.next()
+		name, err := p.expectIdentifier()
+
+		if err != nil {
+
+			return true, err
+		}
+
+		if err := p.expect("is"); err != nil {
+
+			return true, err
+		}
+
+		underlyingType, err := p.parseType()
+
+		if err != nil {
+
+			return true, err
+		}
+
+		if err := p.expect(";"); err != nil {
+
+			return true, err
+		}
+
+		*valueTypes = append(*valueTypes, ValueTypeDeclaration{Name: name, Type: underlyingType.String()})
+
+	default:
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// parses a state variable declaration. Returns false if the variable does not occupy storage, e.g. a constant
+func (p *solidityParser) parseVariable() (VariableDeclaration, bool, error) {
+
+	variableType, err := p.parseType()
+
+	if err != nil {
+
+		return VariableDeclaration{}, false, err
+	}
+
+	inStorage := true
+
+	for {
+
+		token := p.peek()
+
+		if token == "public" || token == "private" || token == "internal" {
+
+			p.next()
+
+		} else if token == "constant" || token == "immutable" || token == "transient" {
+
+			p.next()
+			inStorage = false
+
+		} else if token == "override" {
+
+			p.next()
+
+			if p.peek() == "(" {
+
+				p.next()
+
+				if err := p.skipBalanced("(", ")"); err != nil {
+
+					return VariableDeclaration{}, false, err
+				}
+			}
+
+		} else {
+
+			break
+		}
+	}
+
+	name, err := p.expectIdentifier()
+
+	if err != nil {
+
+		return VariableDeclaration{}, false, err
+	}
+
+	if p.peek() == "=" {
+
+		if err := p.skipStatement(); err != nil {
+
+			return VariableDeclaration{}, false, err
+		}
+
+	} else if err := p.expect(";"); err != nil {
+
+		return VariableDeclaration{}, false, err
+	}
+
+	return VariableDeclaration{Name: name, Type: variableType.String()}, inStorage, nil
+}
+
+// parses a contract, interface or library definition
+func (p *solidityParser) parseContract() (ContractDeclaration, error) {
+
+	contract := ContractDeclaration{Kind: p.next()}
+
+	if contract.Kind == "abstract" {
+
+		if err := p.expect("contract"); err != nil {
+
+			return contract, err
+		}
+	}
+
+	name, err := p.expectIdentifier()
+
+	if err != nil {
+
+		return contract, err
+	}
+
+	contract.Name = name
+
+	if p.peek() == "is" {
+
+		p.next()
+
+		for {
+
+			base, err := p.parseType()
+
+			if err != nil {
+
+				return contract, err
+			}
+
+			contract.Bases = append(contract.Bases, base.Name)
+
+			// arguments of the base constructors
+			if p.peek() == "(" {
+
+				p.next()
+
+				if err := p.skipBalanced("(", ")"); err != nil {
+
+					return contract, err
+				}
+			}
+
+			if p.peek() != "," {
+
+				break
+			}
+
+			p.next()
+		}
+	}
+
+	if err := p.expect("{"); err != nil {
+
+		return contract, err
+	}
+
+	for p.peek() != "}" {
+
+		token := p.peek()
+
+		if token == "" {
+
+			return contract, errors.New("Missing } Of Contract " + contract.Name)
+		}
+
+		if found, err := p.parseTypeDefinition(&contract.Structs, &contract.Enums, &contract.ValueTypes); found {
+
+			if err != nil {
+
+				return contract, err
+			}
+
+			continue
+		}
+
+		// variables of function types start with the function keyword followed by the parameters
+		if skippedMembers[token] && !(token == "function" && p.position+1 < len(p.tokens) && p.tokens[p.position+1] == "(") {
+
+			if err := p.skipStatement(); err != nil {
+
+				return contract, err
+			}
+
+			continue
+		}
+
+		variable, inStorage, err := p.parseVariable()
+
+		if err != nil {
+
+			return contract, errors.New("Contract " + contract.Name + ": " + err.Error())
+		}
+
+		if inStorage {
+
+			contract.Variables = append(contract.Variables, variable)
+		}
+	}
+
+	p.next()
+	return contract, nil
+}
+
+// parses the declarations of Solidity source code that determine the storage layout of its contracts. The bodies of
+// functions and modifiers are skipped, so only the declarations need to be valid Solidity
+func ParseDeclarations(source, sourceName string) (*SourceDeclarations, error) {
+
+	tokens, err := tokenizeSolidity(source)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	parser := &solidityParser{tokens: tokens}
+	declarations := &SourceDeclarations{Source: sourceName, Contracts: make([]ContractDeclaration, 0)}
+
+	for parser.peek() != "" {
+
+		token := parser.peek()
+
+		if token == "contract" || token == "abstract" || token == "interface" || token == "library" {
+
+			contract, err := parser.parseContract()
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			declarations.Contracts = append(declarations.Contracts, contract)
+			continue
+		}
+
+		if found, err := parser.parseTypeDefinition(&declarations.Structs, &declarations.Enums, &declarations.ValueTypes); found {
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			continue
+		}
+
+		// file level functions, constants, errors, events and directives
+		if err := parser.skipStatement(); err != nil {
+
+			return nil, err
+		}
+	}
+
+	// the annotations of namespaced structs are comments, which are dropped by the tokenizer
+	addStorageLocations(source, declarations)
+
+	return declarations, nil
+}
+
+// function to compute the C3 linearization of a contract, from the most derived to the most base contract
+func (b *layoutBuilder) linearize(name string, visiting map[string]bool) ([]string, error) {
+
+	if linearization, found := b.linearizations[name]; found {
+
+		return linearization, nil
+	}
+
+	contract, found := b.contracts[name]
+
+	if !found {
+
+		return nil, errors.New("Contract Not Found " + name)
+	}
+
+	if visiting[name] {
+
+		return nil, errors.New("Cyclic Inheritance Of " + name)
+	}
+
+	visiting[name] = true
+
+	// the bases are listed from the most base like to the most derived, so they are merged in reverse order
+	sequences := make([][]string, 0, len(contract.Bases)+1)
+	reversedBases := make([]string, 0, len(contract.Bases))
+
+	for i := len(contract.Bases) - 1; i >= 0; i-- {
+
+		baseLinearization, err := b.linearize(contract.Bases[i], visiting)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		sequences = append(sequences, append([]string{}, baseLinearization...))
+		reversedBases = append(reversedBases, contract.Bases[i])
+	}
+
+	sequences = append(sequences, reversedBases)
+	linearization := []string{name}
+
+	for {
+
+		remaining := make([][]string, 0, len(sequences))
+
+		for _, sequence := range sequences {
+
+			if len(sequence) != 0 {
+
+				remaining = append(remaining, sequence)
+			}
+		}
+
+		sequences = remaining
+
+		if len(sequences) == 0 {
+
+			break
+		}
+
+		// the next contract is the first head that is not in the tail of any sequence
+		head := ""
+
+		for _, sequence := range sequences {
+
+			inTail := false
+
+			for _, other := range sequences {
+
+				for _, contractName := range other[1:] {
+
+					inTail = inTail || contractName == sequence[0]
+				}
+			}
+
+			if !inTail {
+
+				head = sequence[0]
+				break
+			}
+		}
+
+		if head == "" {
+
+			return nil, errors.New("Linearization Of " + name + " Is Impossible")
+		}
+
+		linearization = append(linearization, head)
+
+		for i, sequence := range sequences {
+
+			if sequence[0] == head {
+
+				sequences[i] = sequence[1:]
+			}
+		}
+	}
+
+	delete(visiting, name)
+	b.linearizations[name] = linearization
+
+	return linearization, nil
+}
+
+// function to find the definition of a user defined type that is visible in a contract. Returns the kind of the
+// definition, the name of the contract that defines it, or an empty name for file level definitions, and the definition
+func (b *layoutBuilder) findDefinition(name, scope string) (string, string, interface{}, error) {
+
+	contractNames := make([]string, 0)
+
+	if dot := strings.LastIndex(name, "."); dot != -1 {
+
+		contractNames = append(contractNames, name[:dot])
+		name = name[dot+1:]
+
+	} else if scope != "" {
+
+		linearization, err := b.linearize(scope, make(map[string]bool))
+
+		if err != nil {
+
+			return "", "", nil, err
+		}
+
+		contractNames = linearization
+	}
+
+	for _, contractName := range contractNames {
+
+		contract, found := b.contracts[contractName]
+
+		if !found {
+
+			return "", "", nil, errors.New("Contract Not Found " + contractName)
+		}
+
+		if kind, definition := findTypeDefinition(name, contract.Structs, contract.Enums, contract.ValueTypes); kind != "" {
+
+			return kind, contractName, definition, nil
+		}
+	}
+
+	if kind, definition := findTypeDefinition(name, b.declarations.Structs, b.declarations.Enums, b.declarations.ValueTypes); kind != "" {
+
+		return kind, "", definition, nil
+	}
+
+	if contract, found := b.contracts[name]; found {
+
+		return "contract", "", contract, nil
+	}
+
+	return "", "", nil, errors.New("Type Not Found " + name)
+}
+
+// function to find a struct, enum or user defined value type by its name
+func findTypeDefinition(name string, structs []StructDeclaration, enums []EnumDeclaration, valueTypes []ValueTypeDeclaration) (string, interface{}) {
+
+	for i := range structs {
+
+		if structs[i].Name == name {
+
+			return "struct", &structs[i]
+		}
+	}
+
+	for i := range enums {
+
+		if enums[i].Name == name {
+
+			return "enum", &enums[i]
+		}
+	}
+
+	for i := range valueTypes {
+
+		if valueTypes[i].Name == name {
+
+			return "valueType", &valueTypes[i]
+		}
+	}
+
+	return "", nil
+}
+
+// function to get the contract field of the storage items declared in a contract
+func (b *layoutBuilder) getContractPath(contractName string) string {
+
+	if b.declarations.Source == "" {
+
+		return contractName
+	}
+
+	return b.declarations.Source + ":" + contractName
+}
+
+// function to get the type description of an elementary type
+func getElementaryType(name, location string) (string, TypeDescription, bool) {
+
+	switch name {
+
+	case "uint":
+		name = "uint256"
+	case "int":
+		name = "int256"
+	case "byte":
+		name = "bytes1"
+	}
+
+	if name == "bool" {
+
+		return "t_bool", TypeDescription{Encoding: "inplace", Label: "bool", NumberOfBytes: "1"}, true
+
+	} else if name == "address" || name == "address payable" {
+
+		return "t_" + strings.Replace(name, " ", "_", 1), TypeDescription{Encoding: "inplace", Label: name, NumberOfBytes: "20"}, true
+
+	} else if name == "string" || name == "bytes" {
+
+		// the keys of mappings are stored in memory before they are hashed
+		if location == "storage" {
+
+			return "t_" + name + "_storage", TypeDescription{Encoding: "bytes", Label: name, NumberOfBytes: "32"}, true
+		}
+
+		return "t_" + name + "_memory_ptr", TypeDescription{Encoding: "bytes", Label: name, NumberOfBytes: "32"}, true
+	}
+
+	for _, prefix := range []string{"uint", "int", "bytes"} {
+
+		if !strings.HasPrefix(name, prefix) {
+
+			continue
+		}
+
+		size, err := strconv.ParseUint(name[len(prefix):], 10, 64)
+
+		if err != nil {
+
+			return "", TypeDescription{}, false
+		}
+
+		numberOfBytes := size
+
+		if prefix != "bytes" {
+
+			if size == 0 || size > 256 || size%8 != 0 {
+
+				return "", TypeDescription{}, false
+			}
+
+			numberOfBytes = size / 8
+
+		} else if size == 0 || size > 32 {
+
+			return "", TypeDescription{}, false
+		}
+
+		return "t_" + name, TypeDescription{Encoding: "inplace", Label: name, NumberOfBytes: strconv.FormatUint(numberOfBytes, 10)}, true
+	}
+
+	return "", TypeDescription{}, false
+}
+
+// function to resolve a type name to its type id and add its type description to the layout. The location is storage
+// for state variables and struct members, and memory for the keys of mappings and the parameters of function types
+func (b *layoutBuilder) resolveType(typeName *solidityType, scope, location string) (string, error) {
+
+	if typeName.Base != nil {
+
+		return b.resolveArray(typeName, scope)
+
+	} else if typeName.Name == "mapping" {
+
+		return b.resolveMapping(typeName, scope)
+
+	} else if typeName.Name == "function" {
+
+		return b.resolveFunction(typeName, scope)
+	}
+
+	if typeId, typeDescription, found := getElementaryType(typeName.Name, location); found {
+
+		b.layout.Types[typeId] = typeDescription
+		return typeId, nil
+	}
+
+	kind, contractName, definition, err := b.findDefinition(typeName.Name, scope)
+
+	if err != nil {
+
+		return "", err
+	}
+
+	// the labels of the types defined in a contract are qualified with the name of the contract
+	qualifiedName := contractName + "." + typeName.Name[strings.LastIndex(typeName.Name, ".")+1:]
+
+	if contractName == "" {
+
+		qualifiedName = qualifiedName[1:]
+	}
+
+	switch kind {
+
+	case "struct":
+
+		return b.resolveStruct(definition.(*StructDeclaration), contractName, qualifiedName)
+
+	case "enum":
+
+		enumDeclaration := definition.(*EnumDeclaration)
+
+		if len(enumDeclaration.Members) == 0 || len(enumDeclaration.Members) > 256 {
+
+			return "", errors.New("Invalid Number Of Members Of Enum " + qualifiedName)
+		}
+
+		typeId := "t_enum(" + enumDeclaration.Name + ")"
+		b.layout.Types[typeId] = TypeDescription{Encoding: "inplace", Label: "enum " + qualifiedName, NumberOfBytes: "1", EnumMembers: enumDeclaration.Members}
+
+		return typeId, nil
+
+	case "valueType":
+
+		valueTypeDeclaration := definition.(*ValueTypeDeclaration)
+		_, underlyingType, found := getElementaryType(valueTypeDeclaration.Type, "storage")
+
+		if !found || underlyingType.Encoding != "inplace" {
+
+			return "", errors.New("Invalid Underlying Type Of " + qualifiedName)
+		}
+
+		typeId := "t_userDefinedValueType(" + valueTypeDeclaration.Name + ")"
+		b.layout.Types[typeId] = TypeDescription{Encoding: "inplace", Label: qualifiedName, NumberOfBytes: underlyingType.NumberOfBytes, UnderlyingType: underlyingType.Label}
+
+		return typeId, nil
+	}
+
+	contract := definition.(*ContractDeclaration)
+	typeId := "t_contract(" + contract.Name + ")"
+	b.layout.Types[typeId] = TypeDescription{Encoding: "inplace", Label: "contract " + contract.Name, NumberOfBytes: "20"}
+
+	return typeId, nil
+}
+
+// function to resolve an array type. The elements of fixed size arrays are packed like the variables of a struct,
+// except that an element never spans two slots
+func (b *layoutBuilder) resolveArray(typeName *solidityType, scope string) (string, error) {
+
+	baseId, err := b.resolveType(typeName.Base, scope, "storage")
+
+	if err != nil {
+
+		return "", err
+	}
+
+	baseDescription, found := b.layout.Types[baseId]
+
+	if !found && typeName.Length != "" {
+
+		return "", errors.New("Recursive Struct In Fixed Size Array " + typeName.String())
+	}
+
+	if typeName.Length == "" {
+
+		typeId := "t_array(" + baseId + ")dyn_storage"
+		b.layout.Types[typeId] = TypeDescription{Encoding: "dynamic_array", Label: b.getLabel(typeName.Base, baseId) + "[]", NumberOfBytes: "32", Base: baseId}
+
+		return typeId, nil
+	}
+
+	length, ok := new(big.Int).SetString(typeName.Length, 0)
+
+	if !ok || length.Sign() <= 0 {
+
+		return "", errors.New("Invalid Array Length " + typeName.Length)
+	}
+
+	baseSize, ok := new(big.Int).SetString(baseDescription.NumberOfBytes, 10)
+
+	if !ok {
+
+		return "", errors.New("Invalid Number Of Bytes For Type " + baseId)
+	}
+
+	numberOfSlots := new(big.Int)
+
+	if isPackable(baseDescription) {
+
+		elementsPerSlot := new(big.Int).Div(big.NewInt(32), baseSize)
+		numberOfSlots.Add(length, new(big.Int).Sub(elementsPerSlot, big.NewInt(1)))
+		numberOfSlots.Div(numberOfSlots, elementsPerSlot)
+
+	} else {
+
+		numberOfSlots.Mul(length, new(big.Int).Div(baseSize, big.NewInt(32)))
+	}
+
+	typeId := "t_array(" + baseId + ")" + length.String() + "_storage"
+	b.layout.Types[typeId] = TypeDescription{
+		Encoding:      "inplace",
+		Label:         baseDescription.Label + "[" + length.String() + "]",
+		NumberOfBytes: new(big.Int).Mul(numberOfSlots, big.NewInt(32)).String(),
+		Base:          baseId,
+	}
+
+	return typeId, nil
+}
+
+// function to get the label of a resolved type. The label of a struct that is being resolved is not yet known
+func (b *layoutBuilder) getLabel(typeName *solidityType, typeId string) string {
+
+	if typeDescription, found := b.layout.Types[typeId]; found {
+
+		return typeDescription.Label
+	}
+
+	return "struct " + typeName.String()
+}
+
+// function to resolve a mapping type
+func (b *layoutBuilder) resolveMapping(typeName *solidityType, scope string) (string, error) {
+
+	keyId, err := b.resolveType(typeName.Key, scope, "memory")
+
+	if err != nil {
+
+		return "", err
+	}
+
+	valueId, err := b.resolveType(typeName.Value, scope, "storage")
+
+	if err != nil {
+
+		return "", err
+	}
+
+	typeId := "t_mapping(" + keyId + "," + valueId + ")"
+	b.layout.Types[typeId] = TypeDescription{
+		Encoding:      "mapping",
+		Label:         "mapping(" + b.layout.Types[keyId].Label + " => " + b.getLabel(typeName.Value, valueId) + ")",
+		NumberOfBytes: "32",
+		Key:           keyId,
+		Value:         valueId,
+	}
+
+	return typeId, nil
+}
+
+// function to resolve a function type. Internal functions are stored as 8 byte code positions, external functions as
+// an address and a 4 byte selector. The parameter types are not part of the layout
+func (b *layoutBuilder) resolveFunction(typeName *solidityType, scope string) (string, error) {
+
+	ids := make([][]string, 2)
+	labels := make([][]string, 2)
+
+	for i, parameters := range [][]*solidityType{typeName.Parameters, typeName.Returns} {
+
+		for _, parameter := range parameters {
+
+			// the parameters are resolved in a separate layout so their types are not added
+			parameterBuilder := *b
+			parameterBuilder.layout = &StorageLayout{Types: make(map[string]TypeDescription)}
+
+			parameterId, err := parameterBuilder.resolveType(parameter, scope, "memory")
+
+			if err != nil {
+
+				return "", err
+			}
+
+			ids[i] = append(ids[i], parameterId)
+			labels[i] = append(labels[i], parameterBuilder.layout.Types[parameterId].Label)
+		}
+	}
+
+	label := "function (" + strings.Join(labels[0], ",") + ")"
+	typeId := "t_function_" + typeName.Visibility + "_" + typeName.Mutability + "(" + strings.Join(ids[0], ",") + ")returns(" + strings.Join(ids[1], ",") + ")"
+	numberOfBytes := "8"
+
+	if typeName.Visibility == "external" {
+
+		label += " external"
+		numberOfBytes = "24"
+	}
+
+	if typeName.Mutability != "nonpayable" {
+
+		label += " " + typeName.Mutability
+	}
+
+	if len(labels[1]) != 0 {
+
+		label += " returns (" + strings.Join(labels[1], ",") + ")"
+	}
+
+	b.layout.Types[typeId] = TypeDescription{Encoding: "inplace", Label: label, NumberOfBytes: numberOfBytes}
+	return typeId, nil
+}
+
+// function to resolve a struct type. The members are placed like state variables starting at slot 0, and the struct
+// occupies whole slots
+func (b *layoutBuilder) resolveStruct(structDeclaration *StructDeclaration, contractName, qualifiedName string) (string, error) {
+
+	typeId := "t_struct(" + structDeclaration.Name + ")_storage"
+
+	// structs can contain themselves through mappings and dynamic arrays
+	if _, found := b.layout.Types[typeId]; found || b.resolvingTypes[typeId] {
+
+		return typeId, nil
+	}
+
+	if len(structDeclaration.Members) == 0 {
+
+		return "", errors.New("Struct Without Members " + qualifiedName)
+	}
+
+	b.resolvingTypes[typeId] = true
+	defer delete(b.resolvingTypes, typeId)
+
+	declaringContracts := make([]string, len(structDeclaration.Members))
+
+	for i := range declaringContracts {
+
+		declaringContracts[i] = contractName
+	}
+
+	members, numberOfSlots, err := b.placeVariables(structDeclaration.Members, declaringContracts)
+
+	if err != nil {
+
+		return "", err
+	}
+
+	b.layout.Types[typeId] = TypeDescription{
+		Encoding:      "inplace",
+		Label:         "struct " + qualifiedName,
+		NumberOfBytes: new(big.Int).Mul(numberOfSlots, big.NewInt(32)).String(),
+		Members:       members,
+	}
+
+	return typeId, nil
+}
+
+// function to place variables one after the other following the packing rules of Solidity. The types of the variables
+// are resolved in the contracts that declare them. Returns the placed variables and the number of slots they occupy
+func (b *layoutBuilder) placeVariables(variables []VariableDeclaration, declaringContracts []string) ([]StorageItem, *big.Int, error) {
+
+	items := make([]StorageItem, 0, len(variables))
+	slot, offset := big.NewInt(0), uint64(0)
+
+	for i, variable := range variables {
+
+		typeName, err := parseSolidityType(variable.Type)
+
+		if err != nil {
+
+			return nil, nil, err
+		}
+
+		typeId, err := b.resolveType(typeName, declaringContracts[i], "storage")
+
+		if err != nil {
+
+			return nil, nil, errors.New(variable.Name + ": " + err.Error())
+		}
+
+		typeDescription, found := b.layout.Types[typeId]
+
+		if !found {
+
+			return nil, nil, errors.New(variable.Name + ": Recursive Struct " + typeId)
+		}
+
+		itemSlot, itemOffset, nextSlot, nextOffset, err := placeItem(slot, offset, typeDescription)
+
+		if err != nil {
+
+			return nil, nil, err
+		}
+
+		items = append(items, StorageItem{
+			AstId:    b.nextAstId,
+			Contract: b.getContractPath(declaringContracts[i]),
+			Label:    variable.Name,
+			Offset:   itemOffset,
+			Slot:     itemSlot.String(),
+			Type:     typeId,
+		})
+
+		b.nextAstId++
+		slot, offset = nextSlot, nextOffset
+	}
+
+	if offset > 0 {
+
+		slot = new(big.Int).Add(slot, big.NewInt(1))
+	}
+
+	return items, slot, nil
+}
+
+// computes the storage layout of a contract like solc --storage-layout. The state variables of the base contracts
+// come first, in the order of the C3 linearization, and are packed following the packing rules of Solidity. If the
+// contract name is empty, the last contract of the declarations that is not an interface or a library is used
+func ComputeStorageLayout(declarations *SourceDeclarations, contractName string) (*StorageLayout, error) {
+
+	builder := newLayoutBuilder(declarations, &StorageLayout{Storage: make([]StorageItem, 0), Types: make(map[string]TypeDescription)})
+
+	if contractName == "" {
+
+		contractName = getDefaultContract(declarations)
+	}
+
+	linearization, err := builder.linearize(contractName, make(map[string]bool))
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	// the variables of all contracts are placed as if they were declared in a single contract
+	variables := make([]VariableDeclaration, 0)
+	declaringContracts := make([]string, 0)
+
+	for i := len(linearization) - 1; i >= 0; i-- {
+
+		for _, variable := range builder.contracts[linearization[i]].Variables {
+
+			variables = append(variables, variable)
+			declaringContracts = append(declaringContracts, linearization[i])
+		}
+	}
+
+	if builder.layout.Storage, _, err = builder.placeVariables(variables, declaringContracts); err != nil {
+
+		return nil, err
+	}
+
+	// the structs of namespaces are stored at the roots computed from their locations instead of the next slots
+	if err := builder.placeNamespaces(linearization); err != nil {
+
+		return nil, err
+	}
+
+	return builder.layout, nil
+}
+
+// function to create the builder of the layout of a contract of the given declarations
+func newLayoutBuilder(declarations *SourceDeclarations, layout *StorageLayout) *layoutBuilder {
+
+	builder := &layoutBuilder{
+		declarations:   declarations,
+		contracts:      make(map[string]*ContractDeclaration),
+		linearizations: make(map[string][]string),
+		layout:         layout,
+		resolvingTypes: make(map[string]bool),
+	}
+
+	for i := range declarations.Contracts {
+
+		builder.contracts[declarations.Contracts[i].Name] = &declarations.Contracts[i]
+	}
+
+	return builder
+}
+
+// function to get the contract whose layout is computed if no contract is given, which is the last contract of the
+// declarations that is not an interface or a library
+func getDefaultContract(declarations *SourceDeclarations) string {
+
+	for i := len(declarations.Contracts) - 1; i >= 0; i-- {
+
+		if declarations.Contracts[i].Kind != "interface" && declarations.Contracts[i].Kind != "library" {
+
+			return declarations.Contracts[i].Name
+		}
+	}
+
+	return ""
+}
+
+// reads a declaration list, either as JSON or as Solidity source code
+func ReadDeclarationsFromFile(filePath string) (*SourceDeclarations, error) {
+
+	byteVal, err := ioutil.ReadFile(filePath)
+
+	if err != nil {
+		fmt.Println(red + err.Error() + reset)
+		return nil, err
+	}
+
+	if strings.HasSuffix(filePath, ".json") {
+
+		var declarations SourceDeclarations
+
+		if err := json.Unmarshal(byteVal, &declarations); err != nil {
+
+			return nil, err
+		}
+
+		return &declarations, nil
+	}
+
+	return ParseDeclarations(string(byteVal), filePath)
+}
+
+// function to compare two storage layouts. The ast ids and the contracts of the storage items are not compared,
+// since they depend on how the layouts were generated
+func CompareStorageLayouts(expected, actual *StorageLayout) error {
+
+	if len(expected.Storage) != len(actual.Storage) {
+
+		return errors.New("Number Of Storage Items Differs: " + strconv.Itoa(len(expected.Storage)) + " Instead Of " + strconv.Itoa(len(actual.Storage)))
+	}
+
+	for i, item := range expected.Storage {
+
+		if err := compareStorageItems(item, actual.Storage[i]); err != nil {
+
+			return err
+		}
+	}
+
+	if len(expected.Types) != len(actual.Types) {
+
+		return errors.New("Number Of Types Differs: " + strconv.Itoa(len(expected.Types)) + " Instead Of " + strconv.Itoa(len(actual.Types)))
+	}
+
+	for typeId, expectedType := range expected.Types {
+
+		actualType, found := actual.Types[typeId]
+
+		if !found {
+
+			return errors.New("Type Not Found " + typeId)
+		}
+
+		if expectedType.Encoding != actualType.Encoding || expectedType.Label != actualType.Label || expectedType.NumberOfBytes != actualType.NumberOfBytes ||
+			expectedType.Base != actualType.Base || expectedType.Key != actualType.Key || expectedType.Value != actualType.Value ||
+			expectedType.UnderlyingType != actualType.UnderlyingType || strings.Join(expectedType.EnumMembers, ",") != strings.Join(actualType.EnumMembers, ",") {
+
+			return errors.New("Type Differs " + typeId)
+		}
+
+		if len(expectedType.Members) != len(actualType.Members) {
+
+			return errors.New("Members Of Type Differ " + typeId)
+		}
+
+		for i, member := range expectedType.Members {
+
+			if err := compareStorageItems(member, actualType.Members[i]); err != nil {
+
+				return errors.New(typeId + ": " + err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// function to compare the positions and types of two storage items
+func compareStorageItems(expected, actual StorageItem) error {
+
+	if expected.Label != actual.Label || expected.Slot != actual.Slot || expected.Offset != actual.Offset || expected.Type != actual.Type || expected.Namespace != actual.Namespace {
+
+		return errors.New(fmt.Sprintf("Storage Item Differs: %s at slot %s offset %d of type %s instead of %s at slot %s offset %d of type %s",
+			actual.Label, actual.Slot, actual.Offset, actual.Type, expected.Label, expected.Slot, expected.Offset, expected.Type))
+	}
+
+	return nil
+}
+
+// function to check the sizes and member positions of the data types of a plan against the computed layouts
+func CheckDataTypes(dataTypes []DataType, oldLayout, newLayout *StorageLayout) error {
+
+	for _, dataType := range dataTypes {
+
+		oldType, inOld := oldLayout.Types[dataType.Type]
+		newType, inNew := newLayout.Types[dataType.Type]
+
+		if !inOld && !inNew {
+
+			return errors.New("Type Not Found In Computed Layouts " + dataType.Type)
+		}
+
+		if inOld && oldType.NumberOfBytes != strconv.FormatUint(dataType.PrevNumberOfBytes, 10) {
+
+			return errors.New("Old Number Of Bytes Differs For Type " + dataType.Type)
+		}
+
+		if inNew && newType.NumberOfBytes != strconv.FormatUint(dataType.NewNumberOfBytes, 10) {
+
+			return errors.New("New Number Of Bytes Differs For Type " + dataType.Type)
+		}
+
+		for _, member := range dataType.Members {
+
+			for _, oldMember := range oldType.Members {
+
+				if oldMember.Label == member.Label {
+
+					if slot, err := SlotToHash(oldMember.Slot); err != nil || slot != member.PrevSlot || oldMember.Offset != member.PrevOffset {
+
+						return errors.New("Old Position Differs For Member " + member.Label + " Of " + dataType.Type)
+					}
+				}
+			}
+
+			for _, newMember := range newType.Members {
+
+				if newMember.Label == member.Label {
+
+					if slot, err := SlotToHash(newMember.Slot); err != nil || slot != member.NewSlot || newMember.Offset != member.NewOffset {
+
+						return errors.New("New Position Differs For Member " + member.Label + " Of " + dataType.Type)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// computes the storage layout of a contract and prints it as JSON
+func runLayout(filePath, contractName string) error {
+
+	declarations, err := ReadDeclarationsFromFile(filePath)
+
+	if err != nil {
+
+		return err
+	}
+
+	layout, err := ComputeStorageLayout(declarations, contractName)
+
+	if err != nil {
+
+		return err
+	}
+
+	data, err := json.MarshalIndent(layout, "", "  ")
+
+	if err != nil {
+
+		return err
+	}
+
+	fmt.Println(string(data))
+	return nil
+}
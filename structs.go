@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// policies for the members that were removed from a struct
+	RemovedMembersReport  = "report"  // the data of the removed members is dropped, the upgrade safety checker reports them
+	RemovedMembersArchive = "archive" // the values of the removed members are decoded and exported before they are deleted
+)
+
+// struct that describes how the value of a member that was added to a struct is computed
+type MemberSpec struct {
+	InitialValue json.RawMessage `json:"initialValue"`
+	Transform    string          `json:"transform"`
+	Inputs       []string        `json:"inputs"`     // labels of the old members passed to the transform
+	Expression   string          `json:"expression"` // expression over the old members of the same struct
+}
+
+// struct that describes how the members of a struct that were added or removed are reorganized
+type StructSpec struct {
+	Members map[string]MemberSpec `json:"members"` // added members keyed by their labels
+	Removed string                `json:"removed"` // policy for the removed members
+}
+
+// function to check if a member of a struct in the old layout is also present in the new layout with the same type
+func findCommonMember(member StorageItem, newMembers []StorageItem, oldTypes, newTypes map[string]TypeDescription) (StorageItem, bool) {
+
+	for _, newMember := range newMembers {
+
+		if newMember.Label == member.Label && IsTypeEqual(member.Type, newMember.Type, oldTypes, newTypes) {
+
+			return newMember, true
+		}
+	}
+
+	return StorageItem{}, false
+}
+
+// function to create the member of a data type that computes the value of a member that was added to a struct
+func getAddedMember(newMember StorageItem, spec MemberSpec, oldMembers []StorageItem) (Member, error) {
+
+	newSlot, err := SlotToHash(newMember.Slot)
+
+	if err != nil {
+
+		return Member{}, err
+	}
+
+	member := Member{
+		Label:        newMember.Label,
+		NewOffset:    newMember.Offset,
+		NewSlot:      newSlot,
+		Type:         newMember.Type,
+		InitialValue: spec.InitialValue,
+		Transform:    spec.Transform,
+		Expression:   spec.Expression,
+	}
+
+	inputLabels := spec.Inputs
+
+	if spec.Expression != "" {
+
+		if spec.Transform != "" || len(spec.Inputs) != 0 || spec.InitialValue != nil {
+
+			return Member{}, errors.New("Expression Can Not Be Combined With A Transform, Inputs Or An Initial Value For Member " + newMember.Label)
+		}
+
+		expression, err := ParseExpression(spec.Expression)
+
+		if err != nil {
+
+			return Member{}, err
+		}
+
+		inputLabels = expression.Variables()
+
+	} else if spec.Transform != "" {
+
+		if spec.InitialValue != nil {
+
+			return Member{}, errors.New("Transform Can Not Be Combined With An Initial Value For Member " + newMember.Label)
+		}
+
+		if len(spec.Inputs) == 0 {
+
+			return Member{}, errors.New("Transform Of Added Member " + newMember.Label + " Requires Inputs")
+		}
+
+	} else if spec.InitialValue == nil {
+
+		return Member{}, errors.New("No Initial Value, Transform Or Expression For Member " + newMember.Label)
+	}
+
+	for _, inputLabel := range inputLabels {
+
+		found := false
+
+		for _, oldMember := range oldMembers {
+
+			if oldMember.Label != inputLabel {
+
+				continue
+			}
+
+			prevSlot, err := SlotToHash(oldMember.Slot)
+
+			if err != nil {
+
+				return Member{}, err
+			}
+
+			member.Inputs = append(member.Inputs, TransformInput{
+				Label:      oldMember.Label,
+				Type:       oldMember.Type,
+				PrevSlot:   prevSlot,
+				PrevOffset: oldMember.Offset,
+			})
+
+			found = true
+		}
+
+		if !found {
+
+			return Member{}, errors.New("Input " + inputLabel + " Of Member " + newMember.Label + " Not Found In The Old Struct")
+		}
+	}
+
+	return member, nil
+}
+
+// function to add the members that were added to or removed from the structs of the data types according to the
+// struct specs, keyed by the struct names e.g. MyContract.Person. The types of the added, archived and input members
+// are added to the data types
+func AddStructChanges(dataTypes []DataType, oldLayout, newLayout *StorageLayout, specs map[string]StructSpec) ([]DataType, error) {
+
+	insertedTypes := make(map[string]bool)
+
+	for _, dataType := range dataTypes {
+
+		insertedTypes[dataType.Type] = true
+	}
+
+	names := make([]string, 0, len(specs))
+
+	for name := range specs {
+
+		names = append(names, name)
+	}
+
+	// the specs are processed in a fixed order so that the data types are always in the same order
+	sort.Strings(names)
+
+	for _, name := range names {
+
+		spec := specs[name]
+		index := -1
+
+		for i, dataType := range dataTypes {
+
+			if dataType.Label == "struct "+name && dataType.PrevNumberOfBytes != 0 && dataType.NewNumberOfBytes != 0 {
+
+				index = i
+			}
+		}
+
+		if index == -1 {
+
+			return nil, errors.New("Struct Not Found In Both Layouts " + name)
+		}
+
+		if spec.Removed != "" && spec.Removed != RemovedMembersReport && spec.Removed != RemovedMembersArchive {
+
+			return nil, errors.New("Invalid Policy For Removed Members " + spec.Removed + " Of " + name)
+		}
+
+		typeName := dataTypes[index].Type
+		oldType := oldLayout.Types[typeName]
+		newType := newLayout.Types[typeName]
+
+		addedMembers := make([]Member, 0)
+		archivedMembers := make([]Member, 0)
+		typeNames := make([]string, 0)
+
+		for label := range spec.Members {
+
+			found := false
+
+			for _, newMember := range newType.Members {
+
+				found = found || newMember.Label == label
+			}
+
+			if !found {
+
+				return nil, errors.New("Member " + label + " Not Found In The New Struct " + name)
+			}
+		}
+
+		for _, newMember := range newType.Members {
+
+			memberSpec, found := spec.Members[newMember.Label]
+
+			if !found {
+
+				continue
+			}
+
+			if _, isCommon := findCommonMember(newMember, oldType.Members, newLayout.Types, oldLayout.Types); isCommon {
+
+				return nil, errors.New("Member " + newMember.Label + " Of " + name + " Is Not Added")
+			}
+
+			member, err := getAddedMember(newMember, memberSpec, oldType.Members)
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			addedMembers = append(addedMembers, member)
+			typeNames = append(typeNames, member.Type)
+
+			for _, input := range member.Inputs {
+
+				typeNames = append(typeNames, input.Type)
+			}
+		}
+
+		if spec.Removed == RemovedMembersArchive {
+
+			for _, oldMember := range oldType.Members {
+
+				if _, isCommon := findCommonMember(oldMember, newType.Members, oldLayout.Types, newLayout.Types); isCommon {
+
+					continue
+				}
+
+				prevSlot, err := SlotToHash(oldMember.Slot)
+
+				if err != nil {
+
+					return nil, err
+				}
+
+				archivedMembers = append(archivedMembers, Member{
+					Label:      oldMember.Label,
+					PrevOffset: oldMember.Offset,
+					PrevSlot:   prevSlot,
+					Type:       oldMember.Type,
+				})
+
+				typeNames = append(typeNames, oldMember.Type)
+			}
+		}
+
+		for _, memberTypeName := range typeNames {
+
+			if err := processAnyType(oldLayout, newLayout, memberTypeName, insertedTypes, &dataTypes); err != nil {
+
+				return nil, err
+			}
+		}
+
+		if len(addedMembers) != 0 {
+
+			dataTypes[index].AddedMembers = addedMembers
+		}
+
+		if len(archivedMembers) != 0 {
+
+			dataTypes[index].ArchivedMembers = archivedMembers
+		}
+	}
+
+	return dataTypes, nil
+}
+
+// Writes the values of the members that were added to a struct and exports the values of the archived members for a
+// single struct whose old data starts at prevSlot and whose new data starts at newSlot
+func (s *StorageReorganizer) ReorganizeStructChanges(structDataType DataType, prevSlot, newSlot *big.Int, label string) error {
+
+	for _, member := range structDataType.ArchivedMembers {
+
+		value, err := s.DecodeValue(member.Type, new(big.Int).Add(prevSlot, member.PrevSlot.Big()), member.PrevOffset)
+
+		if err != nil {
+
+			return err
+		}
+
+		s.exportedValues[label+"."+member.Label] = value
+	}
+
+	for _, member := range structDataType.AddedMembers {
+
+		memberMessage := ReorgInfo{
+			Label:        label + "." + member.Label,
+			Type:         member.Type,
+			NewSlot:      common.BigToHash(new(big.Int).Add(newSlot, member.NewSlot.Big())),
+			NewOffset:    member.NewOffset,
+			InitialValue: member.InitialValue,
+			Transform:    member.Transform,
+			Expression:   member.Expression,
+		}
+
+		// the inputs are old members of the same struct
+		for _, input := range member.Inputs {
+
+			input.PrevSlot = common.BigToHash(new(big.Int).Add(prevSlot, input.PrevSlot.Big()))
+			memberMessage.Inputs = append(memberMessage.Inputs, input)
+		}
+
+		if err := s.ReorganizeComputedValue(memberMessage); err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// interface implemented by user-defined functions that compute the new value of a variable from old values.
+// Apply receives the decoded old values keyed by their labels and returns the value that is stored in the new location
+type Transform interface {
+	Apply(oldValues map[string]interface{}) (interface{}, error)
+}
+
+// adapter to use an ordinary function as a Transform
+type TransformFunc func(oldValues map[string]interface{}) (interface{}, error)
+
+func (f TransformFunc) Apply(oldValues map[string]interface{}) (interface{}, error) {
+
+	return f(oldValues)
+}
+
+// struct that holds the position of an old variable whose value is passed to a transform
+type TransformInput struct {
+	Label      string      `json:"label"`
+	Type       string      `json:"type"`
+	PrevSlot   common.Hash `json:"oldSlot"`
+	PrevOffset uint64      `json:"oldOffset"`
+}
+
+// registers a transform. Reorganization messages refer to it by name in their "transform" field
+func (s *StorageReorganizer) RegisterTransform(name string, transform Transform) {
+
+	s.transforms[name] = transform
+}
+
+// computes the new value of a variable with its transform and writes it into the new location. If the message has no
+// inputs, the old value of the variable itself is passed to the transform
+func (s *StorageReorganizer) ReorganizeTransform(reorgMessage ReorgInfo) error {
+
+	transform, found := s.transforms[reorgMessage.Transform]
+
+	if !found {
+
+		return errors.New("Transform Not Registered " + reorgMessage.Transform)
+	}
+
+	inputs := reorgMessage.Inputs
+
+	if len(inputs) == 0 {
+
+		inputs = []TransformInput{{
+			Label:      reorgMessage.Label,
+			Type:       reorgMessage.Type,
+			PrevSlot:   reorgMessage.PrevSlot,
+			PrevOffset: reorgMessage.PrevOffset,
+		}}
+	}
+
+	oldValues := make(map[string]interface{})
+
+	for _, input := range inputs {
+
+		oldValue, err := s.DecodeValue(input.Type, input.PrevSlot.Big(), input.PrevOffset)
+
+		if err != nil {
+
+			return errors.New("Can Not Decode " + input.Label + ": " + err.Error())
+		}
+
+		oldValues[input.Label] = oldValue
+	}
+
+	newValue, err := transform.Apply(oldValues)
+
+	if err != nil {
+
+		return errors.New("Transform " + reorgMessage.Transform + " Failed For " + reorgMessage.Label + ": " + err.Error())
+	}
+
+	newType := reorgMessage.Type
+
+	if reorgMessage.NewType != "" {
+
+		newType = reorgMessage.NewType
+	}
+
+	if err := s.EncodeValue(newType, newValue, reorgMessage.NewSlot.Big(), reorgMessage.NewOffset); err != nil {
+
+		return errors.New("Can Not Store " + reorgMessage.Label + ": " + err.Error())
+	}
+
+	return nil
+}
+
+// returns the integer value of a transform that has exactly one input
+func getSingleIntegerInput(oldValues map[string]interface{}) (*big.Int, error) {
+
+	if len(oldValues) != 1 {
+
+		return nil, errors.New("Expected A Single Input")
+	}
+
+	for _, value := range oldValues {
+
+		return ParseInteger(value)
+	}
+
+	return nil, errors.New("Expected A Single Input")
+}
+
+// returns a transform that converts a fixed point number from one number of decimals to another
+func ScaleDecimals(fromDecimals, toDecimals uint) Transform {
+
+	return TransformFunc(func(oldValues map[string]interface{}) (interface{}, error) {
+
+		value, err := getSingleIntegerInput(oldValues)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		if toDecimals >= fromDecimals {
+
+			return new(big.Int).Mul(value, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(toDecimals-fromDecimals)), nil)), nil
+		}
+
+		divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(fromDecimals-toDecimals)), nil)
+		quotient, remainder := new(big.Int).QuoRem(value, divisor, new(big.Int))
+
+		if remainder.Sign() != 0 {
+
+			return nil, errors.New("Precision Lost When Scaling " + value.String())
+		}
+
+		return quotient, nil
+	})
+}
+
+// returns a transform that extracts numberOfBits bits starting at bit "from" of an integer, e.g. to split a packed uint256 into two uint128s
+func ExtractBits(from, numberOfBits uint) Transform {
+
+	return TransformFunc(func(oldValues map[string]interface{}) (interface{}, error) {
+
+		value, err := getSingleIntegerInput(oldValues)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), numberOfBits), big.NewInt(1))
+
+		return new(big.Int).And(new(big.Int).Rsh(value, from), mask), nil
+	})
+}
+
+// returns a transform that maps the old integer values (e.g. of a bool) to new integer values (e.g. of an enum)
+func MapValues(mapping map[int64]int64) Transform {
+
+	return TransformFunc(func(oldValues map[string]interface{}) (interface{}, error) {
+
+		value, err := getSingleIntegerInput(oldValues)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		if !value.IsInt64() {
+
+			return nil, errors.New("No Mapping For Value " + value.String())
+		}
+
+		newValue, found := mapping[value.Int64()]
+
+		if !found {
+
+			return nil, errors.New("No Mapping For Value " + value.String())
+		}
+
+		return big.NewInt(newValue), nil
+	})
+}
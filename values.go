@@ -0,0 +1,708 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Values of storage variables are represented as follows:
+//   - value types (uintN, intN, bool, address, bytesN, ...) as *big.Int
+//   - bytes and string as []byte
+//   - fixed size and dynamic arrays as []interface{}
+//   - structs as map[string]interface{} keyed by the member labels
+
+// function to get the length of a fixed size array from its label e.g. 3 for uint8[3]
+func GetArrayLength(label string) (uint64, error) {
+
+	start := strings.LastIndex(label, "[")
+
+	if start == -1 || !strings.HasSuffix(label, "]") {
+
+		return 0, errors.New("Not A Fixed Size Array " + label)
+	}
+
+	length, err := strconv.ParseUint(label[start+1:len(label)-1], 10, 64)
+
+	if err != nil {
+
+		return 0, errors.New("Not A Fixed Size Array " + label)
+	}
+
+	return length, nil
+}
+
+// function to check if a data type is a signed integer
+func IsSignedInteger(dataType DataType) bool {
+
+	return strings.HasPrefix(GetEncodingLabel(dataType), "int")
+}
+
+// function to get the number of slots and the position of the i-th element of an array whose elements are of the given size.
+// Elements smaller than a slot are packed, larger elements start at a new slot
+func GetElementPosition(elementSize uint64, i uint64) (uint64, uint64) {
+
+	if elementSize < 32 {
+
+		elementsPerSlot := 32 / elementSize
+
+		return i / elementsPerSlot, (i % elementsPerSlot) * elementSize
+	}
+
+	return i * ((elementSize + 31) / 32), 0
+}
+
+// converts the JSON representation of a value into the value of the given data type
+func (s *StorageReorganizer) ParseValue(typeName string, raw json.RawMessage) (interface{}, error) {
+
+	dataType, found := s.dataTypes[typeName]
+
+	if !found {
+
+		return nil, errors.New("Type not found " + typeName)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var value interface{}
+
+	if err := decoder.Decode(&value); err != nil {
+
+		return nil, err
+	}
+
+	return s.convertJSONValue(dataType, value)
+}
+
+func (s *StorageReorganizer) convertJSONValue(dataType DataType, value interface{}) (interface{}, error) {
+
+	switch dataType.Encoding {
+
+	case "bytes", EncodingVyperBytes:
+
+		str, ok := value.(string)
+
+		if !ok {
+
+			return nil, errors.New("Expected A String For " + dataType.Label)
+		}
+
+		if (dataType.Label == "bytes" || strings.HasPrefix(dataType.Label, "Bytes[")) && strings.HasPrefix(str, "0x") {
+
+			return hexutil.Decode(str)
+		}
+
+		return []byte(str), nil
+
+	case "dynamic_array", "inplace":
+
+		if len(dataType.Members) != 0 {
+
+			object, ok := value.(map[string]interface{})
+
+			if !ok {
+
+				return nil, errors.New("Expected An Object For " + dataType.Label)
+			}
+
+			result := make(map[string]interface{})
+
+			for label, memberValue := range object {
+
+				member, found := GetMember(dataType, label)
+
+				if !found {
+
+					return nil, errors.New("Unknown Member " + label + " Of " + dataType.Label)
+				}
+
+				memberDataType, found := s.dataTypes[member.Type]
+
+				if !found {
+
+					return nil, errors.New("Struct Member Not Found")
+				}
+
+				converted, err := s.convertJSONValue(memberDataType, memberValue)
+
+				if err != nil {
+
+					return nil, err
+				}
+
+				result[label] = converted
+			}
+
+			return result, nil
+		}
+
+		if dataType.Base != "" {
+
+			elements, ok := value.([]interface{})
+
+			if !ok {
+
+				return nil, errors.New("Expected An Array For " + dataType.Label)
+			}
+
+			baseDataType, found := s.dataTypes[dataType.Base]
+
+			if !found {
+
+				return nil, errors.New("Type not found " + dataType.Base)
+			}
+
+			result := make([]interface{}, 0, len(elements))
+
+			for _, element := range elements {
+
+				converted, err := s.convertJSONValue(baseDataType, element)
+
+				if err != nil {
+
+					return nil, err
+				}
+
+				result = append(result, converted)
+			}
+
+			return result, nil
+		}
+
+		return ParseInteger(value)
+
+	default:
+
+		return nil, errors.New("Values Of Encoding " + dataType.Encoding + " Are Not Supported")
+	}
+}
+
+// converts a JSON number, boolean or a decimal or hex string into an integer
+func ParseInteger(value interface{}) (*big.Int, error) {
+
+	switch v := value.(type) {
+
+	case bool:
+
+		if v {
+
+			return big.NewInt(1), nil
+		}
+
+		return big.NewInt(0), nil
+
+	case json.Number:
+
+		return parseIntegerString(v.String())
+
+	case string:
+
+		return parseIntegerString(v)
+
+	case *big.Int:
+
+		return v, nil
+
+	case int:
+
+		return big.NewInt(int64(v)), nil
+
+	case int64:
+
+		return big.NewInt(v), nil
+
+	case uint64:
+
+		return new(big.Int).SetUint64(v), nil
+
+	default:
+
+		return nil, fmt.Errorf("invalid integer value %v", value)
+	}
+}
+
+func parseIntegerString(str string) (*big.Int, error) {
+
+	negative := strings.HasPrefix(str, "-")
+	digits := strings.TrimPrefix(str, "-")
+	base := 10
+
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+
+		digits = digits[2:]
+		base = 16
+	}
+
+	result, ok := new(big.Int).SetString(digits, base)
+
+	if !ok {
+
+		return nil, errors.New("Invalid Integer " + str)
+	}
+
+	if negative {
+
+		result.Neg(result)
+	}
+
+	return result, nil
+}
+
+// function to get a struct member given its label
+func GetMember(dataType DataType, label string) (Member, bool) {
+
+	for _, member := range dataType.Members {
+
+		if member.Label == label {
+
+			return member, true
+		}
+	}
+
+	return Member{}, false
+}
+
+// function to write a byte of the modified storage. The byte must not have been written by the reorganization already
+func (s *StorageReorganizer) writeModifiedByte(key common.Hash, offset uint64, val byte) error {
+
+	if s.IsWritten(key, offset) {
+
+		return fmt.Errorf("collision at slot %s offset %d", key.Hex(), offset)
+	}
+
+	slot := s.GetModifiedState(key)
+	slot[31-offset] = val
+	s.SetModifiedState(key, slot)
+	s.MarkWritten(key, offset, offset+1)
+
+	return nil
+}
+
+// function to write a word of the modified storage
+func (s *StorageReorganizer) writeModifiedWord(key common.Hash, val common.Hash) error {
+
+	for offset := uint64(0); offset < 32; offset++ {
+
+		if err := s.writeModifiedByte(key, offset, val[31-offset]); err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodes a value of the given data type into the modified storage at the given slot and offset
+func (s *StorageReorganizer) EncodeValue(typeName string, value interface{}, slot *big.Int, offset uint64) error {
+
+	dataType, found := s.dataTypes[typeName]
+
+	if !found {
+
+		return errors.New("Type not found " + typeName)
+	}
+
+	key := common.BigToHash(slot)
+
+	switch dataType.Encoding {
+
+	case "bytes":
+
+		data, ok := value.([]byte)
+
+		if str, isString := value.(string); isString {
+
+			data, ok = []byte(str), true
+		}
+
+		if !ok {
+
+			return errors.New("Expected Bytes For " + dataType.Label)
+		}
+
+		// short bytes are stored in the slot together with length*2, long bytes store length*2+1 in the slot and the data at keccak256(slot)
+		if len(data) < 32 {
+
+			var word common.Hash
+
+			copy(word[:], data)
+			word[31] = byte(len(data) * 2)
+
+			return s.writeModifiedWord(key, word)
+		}
+
+		if err := s.writeModifiedWord(key, common.BigToHash(big.NewInt(int64(len(data)*2+1)))); err != nil {
+
+			return err
+		}
+
+		dataSlot := common.BytesToHash(crypto.Keccak256(key[:])).Big()
+
+		for i := 0; i < len(data); i += 32 {
+
+			var word common.Hash
+
+			copy(word[:], data[i:])
+
+			if err := s.writeModifiedWord(common.BigToHash(new(big.Int).Add(dataSlot, big.NewInt(int64(i/32)))), word); err != nil {
+
+				return err
+			}
+		}
+
+		return nil
+
+	case "dynamic_array":
+
+		elements, ok := value.([]interface{})
+
+		if !ok {
+
+			return errors.New("Expected An Array For " + dataType.Label)
+		}
+
+		if err := s.writeModifiedWord(key, common.BigToHash(big.NewInt(int64(len(elements))))); err != nil {
+
+			return err
+		}
+
+		return s.encodeElements(dataType.Base, elements, common.BytesToHash(crypto.Keccak256(key[:])).Big())
+
+	case "inplace":
+
+		if len(dataType.Members) != 0 {
+
+			object, ok := value.(map[string]interface{})
+
+			if !ok {
+
+				return errors.New("Expected An Object For " + dataType.Label)
+			}
+
+			for _, member := range dataType.Members {
+
+				memberValue, found := object[member.Label]
+
+				if !found {
+
+					continue
+				}
+
+				if err := s.EncodeValue(member.Type, memberValue, new(big.Int).Add(slot, member.NewSlot.Big()), member.NewOffset); err != nil {
+
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		if dataType.Base != "" {
+
+			elements, ok := value.([]interface{})
+
+			if !ok {
+
+				return errors.New("Expected An Array For " + dataType.Label)
+			}
+
+			length, err := GetArrayLength(dataType.Label)
+
+			if err != nil {
+
+				return err
+			}
+
+			if uint64(len(elements)) > length {
+
+				return fmt.Errorf("%d elements do not fit in %s", len(elements), dataType.Label)
+			}
+
+			return s.encodeElements(dataType.Base, elements, slot)
+		}
+
+		integer, err := ParseInteger(value)
+
+		if err != nil {
+
+			return errors.New("Expected An Integer For " + dataType.Label)
+		}
+
+		return s.encodeInteger(dataType, integer, key, offset)
+
+	default:
+
+		return errors.New("Values Of Encoding " + dataType.Encoding + " Are Not Supported")
+	}
+}
+
+// encodes the elements of an array starting at the given slot
+func (s *StorageReorganizer) encodeElements(baseTypeName string, elements []interface{}, slot *big.Int) error {
+
+	_, elementSize, err := s.GetNumberOfBytes(baseTypeName)
+
+	if err != nil {
+
+		return err
+	}
+
+	for i, element := range elements {
+
+		slotIndex, offset := GetElementPosition(elementSize, uint64(i))
+
+		if err := s.EncodeValue(baseTypeName, element, new(big.Int).Add(slot, new(big.Int).SetUint64(slotIndex)), offset); err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodes an integer into the bytes of a value type. Negative integers are stored in two's complement
+func (s *StorageReorganizer) encodeInteger(dataType DataType, integer *big.Int, key common.Hash, offset uint64) error {
+
+	size := dataType.NewNumberOfBytes
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(size*8))
+	encoded := new(big.Int).Set(integer)
+
+	if IsSignedInteger(dataType) {
+
+		half := new(big.Int).Rsh(limit, 1)
+
+		if integer.Cmp(half) >= 0 || integer.Cmp(new(big.Int).Neg(half)) < 0 {
+
+			return errors.New("Value " + integer.String() + " Does Not Fit In " + dataType.Label)
+		}
+
+		if integer.Sign() < 0 {
+
+			encoded.Add(encoded, limit)
+		}
+
+	} else if integer.Sign() < 0 || integer.Cmp(limit) >= 0 {
+
+		return errors.New("Value " + integer.String() + " Does Not Fit In " + dataType.Label)
+	}
+
+	var word common.Hash
+
+	encoded.FillBytes(word[:])
+
+	for i := uint64(0); i < size; i++ {
+
+		if err := s.writeModifiedByte(key, offset+i, word[31-i]); err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodes the value of a data type stored in the commited storage at the given slot and offset
+func (s *StorageReorganizer) DecodeValue(typeName string, slot *big.Int, offset uint64) (interface{}, error) {
+
+	dataType, found := s.dataTypes[typeName]
+
+	if !found {
+
+		return nil, errors.New("Type not found " + typeName)
+	}
+
+	key := common.BigToHash(slot)
+	word := s.GetCommitedState(key)
+
+	switch dataType.Encoding {
+
+	case "bytes":
+
+		// short bytes are stored in the slot together with length*2
+		if word[31]&1 == 0 {
+
+			length := int(word[31] / 2)
+
+			if length > 31 {
+
+				return nil, errors.New("Invalid Short Bytes At Slot " + key.Hex())
+			}
+
+			return append([]byte{}, word[:length]...), nil
+		}
+
+		length := new(big.Int).Rsh(word.Big(), 1)
+
+		if !length.IsInt64() || length.Int64() > 1<<24 {
+
+			return nil, errors.New("Invalid Long Bytes At Slot " + key.Hex())
+		}
+
+		data := make([]byte, 0, length.Int64())
+		dataSlot := common.BytesToHash(crypto.Keccak256(key[:])).Big()
+
+		for i := int64(0); i < length.Int64(); i += 32 {
+
+			curSlot := s.GetCommitedState(common.BigToHash(new(big.Int).Add(dataSlot, big.NewInt(i/32))))
+			data = append(data, curSlot[:]...)
+		}
+
+		return data[:length.Int64()], nil
+
+	case "dynamic_array":
+
+		length := word.Big()
+
+		if !length.IsUint64() || length.Uint64() > 1<<24 {
+
+			return nil, errors.New("Invalid Dynamic Array Length At Slot " + key.Hex())
+		}
+
+		return s.decodeElements(dataType.Base, length.Uint64(), common.BytesToHash(crypto.Keccak256(key[:])).Big())
+
+	case "inplace":
+
+		if len(dataType.Members) != 0 {
+
+			result := make(map[string]interface{})
+
+			for _, member := range dataType.Members {
+
+				memberValue, err := s.DecodeValue(member.Type, new(big.Int).Add(slot, member.PrevSlot.Big()), member.PrevOffset)
+
+				if err != nil {
+
+					return nil, err
+				}
+
+				result[member.Label] = memberValue
+			}
+
+			return result, nil
+		}
+
+		if dataType.Base != "" {
+
+			length, err := GetArrayLength(dataType.Label)
+
+			if err != nil {
+
+				return nil, err
+			}
+
+			return s.decodeElements(dataType.Base, length, slot)
+		}
+
+		size := dataType.PrevNumberOfBytes
+		integer := new(big.Int).SetBytes(word[32-offset-size : 32-offset])
+
+		// signed integers are stored in two's complement
+		if IsSignedInteger(dataType) && integer.Bit(int(size*8-1)) == 1 {
+
+			integer.Sub(integer, new(big.Int).Lsh(big.NewInt(1), uint(size*8)))
+		}
+
+		return integer, nil
+
+	default:
+
+		return nil, errors.New("Values Of Encoding " + dataType.Encoding + " Are Not Supported")
+	}
+}
+
+// decodes the elements of an array starting at the given slot
+func (s *StorageReorganizer) decodeElements(baseTypeName string, length uint64, slot *big.Int) ([]interface{}, error) {
+
+	elementSize, _, err := s.GetNumberOfBytes(baseTypeName)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	elements := make([]interface{}, 0, length)
+
+	for i := uint64(0); i < length; i++ {
+
+		slotIndex, offset := GetElementPosition(elementSize, i)
+
+		element, err := s.DecodeValue(baseTypeName, new(big.Int).Add(slot, new(big.Int).SetUint64(slotIndex)), offset)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		elements = append(elements, element)
+	}
+
+	return elements, nil
+}
+
+// function to check if a decoded value is zero, i.e. if all the bytes it was decoded from are zero
+func IsZeroValue(value interface{}) bool {
+
+	switch v := value.(type) {
+
+	case *big.Int:
+
+		return v.Sign() == 0
+
+	case []byte:
+
+		return len(v) == 0
+
+	case []interface{}:
+
+		for _, element := range v {
+
+			if !IsZeroValue(element) {
+
+				return false
+			}
+		}
+
+		return true
+
+	case map[string]interface{}:
+
+		for _, member := range v {
+
+			if !IsZeroValue(member) {
+
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// writes the initial value of a variable that is only present in the new layout. The initial value must not
+// collide with the data that has been moved by the reorganization
+func (s *StorageReorganizer) ReorganizeInitialValue(reorgMessage ReorgInfo) error {
+
+	value, err := s.ParseValue(reorgMessage.Type, reorgMessage.InitialValue)
+
+	if err != nil {
+
+		return errors.New("Invalid Initial Value For " + reorgMessage.Label + ": " + err.Error())
+	}
+
+	if err := s.EncodeValue(reorgMessage.Type, value, reorgMessage.NewSlot.Big(), reorgMessage.NewOffset); err != nil {
+
+		return errors.New("Can Not Initialize " + reorgMessage.Label + ": " + err.Error())
+	}
+
+	return nil
+}
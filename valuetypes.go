@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// categories of the value types in the storage layout
+	ValueTypeAddress          = "address"
+	ValueTypeContract         = "contract"
+	ValueTypeBool             = "bool"
+	ValueTypeEnum             = "enum"
+	ValueTypeUserDefined      = "user_defined"
+	ValueTypeInternalFunction = "internal_function"
+	ValueTypeExternalFunction = "external_function"
+	ValueTypeElementary       = "elementary"
+)
+
+// function to find the category of a value type from its type identifier, e.g. t_contract(IERC20) or
+// t_userDefinedValueType(Price). It returns an empty string for types that are not value types
+func GetValueTypeCategory(typeName string, typeDescription TypeDescription) string {
+
+	if typeDescription.Encoding != "inplace" || typeDescription.Base != "" || len(typeDescription.Members) != 0 {
+
+		return ""
+	}
+
+	if strings.HasPrefix(typeName, "t_function_internal") {
+
+		return ValueTypeInternalFunction
+
+	} else if strings.HasPrefix(typeName, "t_function_external") {
+
+		return ValueTypeExternalFunction
+
+	} else if strings.HasPrefix(typeName, "t_userDefinedValueType") {
+
+		return ValueTypeUserDefined
+
+	} else if strings.HasPrefix(typeName, "t_contract") {
+
+		return ValueTypeContract
+
+	} else if strings.HasPrefix(typeName, "t_enum") {
+
+		return ValueTypeEnum
+
+	} else if strings.HasPrefix(typeName, "t_address") {
+
+		return ValueTypeAddress
+
+	} else if typeName == "t_bool" {
+
+		return ValueTypeBool
+	}
+
+	return ValueTypeElementary
+}
+
+// function to check if a data type contains an internal function pointer. Internal function pointers are code
+// positions in the old contract, so their values are meaningless in the new contract
+func ContainsInternalFunction(typeName string, types map[string]TypeDescription) bool {
+
+	typeDescription, found := types[typeName]
+
+	if !found {
+
+		return false
+	}
+
+	if GetValueTypeCategory(typeName, typeDescription) == ValueTypeInternalFunction {
+
+		return true
+	}
+
+	for _, name := range []string{typeDescription.Base, typeDescription.Value} {
+
+		if name != "" && ContainsInternalFunction(name, types) {
+
+			return true
+		}
+	}
+
+	for _, member := range typeDescription.Members {
+
+		if ContainsInternalFunction(member.Type, types) {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// function to check if a variable whose value type changed can be copied without changing its bytes. Contracts and
+// addresses can be converted into each other, user defined value types into their underlying types and back
+func IsValueTypeConversion(oldTypeName, newTypeName string, oldTypes, newTypes map[string]TypeDescription) bool {
+
+	oldType, found := oldTypes[oldTypeName]
+
+	if !found {
+
+		return false
+	}
+
+	newType, found := newTypes[newTypeName]
+
+	if !found || oldType.NumberOfBytes != newType.NumberOfBytes {
+
+		return false
+	}
+
+	oldCategory := GetValueTypeCategory(oldTypeName, oldType)
+	newCategory := GetValueTypeCategory(newTypeName, newType)
+
+	isAddressLike := func(category string) bool {
+
+		return category == ValueTypeAddress || category == ValueTypeContract
+	}
+
+	if isAddressLike(oldCategory) && isAddressLike(newCategory) {
+
+		return true
+	}
+
+	if oldCategory == ValueTypeUserDefined && newCategory == ValueTypeUserDefined {
+
+		return oldType.UnderlyingType != "" && oldType.UnderlyingType == newType.UnderlyingType
+
+	} else if oldCategory == ValueTypeUserDefined {
+
+		return oldType.UnderlyingType != "" && oldType.UnderlyingType == newType.Label
+
+	} else if newCategory == ValueTypeUserDefined {
+
+		return newType.UnderlyingType != "" && newType.UnderlyingType == oldType.Label
+	}
+
+	return false
+}
+
+// function to check if a data type of the reorganizer is an internal function pointer
+func IsInternalFunctionType(dataType DataType) bool {
+
+	return strings.HasPrefix(dataType.Type, "t_function_internal")
+}
+
+// function to get the label of the type that determines how a value is encoded. User defined value types are
+// encoded like their underlying types and contracts like addresses
+func GetEncodingLabel(dataType DataType) string {
+
+	if dataType.UnderlyingType != "" {
+
+		return dataType.UnderlyingType
+
+	} else if strings.HasPrefix(dataType.Label, "contract ") {
+
+		return "address"
+	}
+
+	return dataType.Label
+}
+
+// returns an error for data types that can not be reorganized
+func checkReorganizable(dataType DataType) error {
+
+	if IsInternalFunctionType(dataType) {
+
+		return errors.New("Internal Function Pointer " + dataType.Label + " Can Not Be Reorganized, Its Value Depends On The Code Of The Old Contract")
+	}
+
+	return nil
+}
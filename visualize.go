@@ -0,0 +1,804 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// symbols used to draw the bytes of the variables in the ASCII slot map
+const slotMapSymbols = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// pattern of the escape sequences that color the output in the terminal
+var terminalColorPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// colors used to draw the variables in the terminal and in the SVG
+var terminalColors = []string{cyan, yellow, magenta, green, orange, blue, red}
+var svgColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+
+// struct to represent the bytes of a slot that are occupied by a variable or a part of it
+type SlotSegment struct {
+	Label    string
+	Root     string
+	Contract string // contract that declares the variable, see inheritance.go
+	Type     string
+	Slot     *big.Int
+	Offset   uint64
+	Size     uint64
+}
+
+// struct to represent the keccak derived region where a dynamic array or bytes stores its data
+type DataRegion struct {
+	Label    string
+	Root     string
+	Contract string
+	Type     string
+	Slot     *big.Int
+	DataSlot common.Hash
+}
+
+// struct that holds the slot map of a storage layout
+type SlotMap struct {
+	Segments []SlotSegment
+	Regions  []DataRegion
+}
+
+// function to add the segments of a variable of the given type located at the given slot and offset
+func (m *SlotMap) addType(types map[string]TypeDescription, root, label, typeName string, slot *big.Int, offset uint64) error {
+
+	typeDescription, found := types[typeName]
+
+	if !found {
+
+		return errors.New("Type not found " + typeName)
+	}
+
+	numberOfBytes, ok := new(big.Int).SetString(typeDescription.NumberOfBytes, 10)
+
+	if !ok || !numberOfBytes.IsUint64() {
+
+		return errors.New("Invalid Number Of Bytes For Type " + typeName)
+	}
+
+	size := numberOfBytes.Uint64()
+
+	// the data of dynamic arrays and bytes is stored at keccak256(slot)
+	if typeDescription.Encoding == "dynamic_array" || typeDescription.Encoding == "bytes" {
+
+		m.Segments = append(m.Segments, SlotSegment{Label: label, Root: root, Type: typeName, Slot: slot, Offset: offset, Size: size})
+		m.Regions = append(m.Regions, DataRegion{
+			Label:    label,
+			Root:     root,
+			Type:     typeName,
+			Slot:     slot,
+			DataSlot: common.BytesToHash(crypto.Keccak256(common.BigToHash(slot).Bytes())),
+		})
+
+		return nil
+	}
+
+	if typeDescription.Encoding != "inplace" {
+
+		m.Segments = append(m.Segments, SlotSegment{Label: label, Root: root, Type: typeName, Slot: slot, Offset: offset, Size: size})
+		return nil
+	}
+
+	// struct members are located relative to the first slot of the struct
+	if len(typeDescription.Members) != 0 {
+
+		for _, member := range typeDescription.Members {
+
+			memberSlot, err := SlotToHash(member.Slot)
+
+			if err != nil {
+
+				return err
+			}
+
+			err = m.addType(types, root, label+"."+member.Label, member.Type, new(big.Int).Add(slot, memberSlot.Big()), member.Offset)
+
+			if err != nil {
+
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if typeDescription.Base != "" {
+
+		numberOfElements, err := GetArrayLength(typeDescription.Label)
+
+		if err != nil {
+
+			return err
+		}
+
+		return m.addElements(types, root, label, typeDescription.Base, slot, numberOfElements)
+	}
+
+	// a value that does not fit into the rest of its slot continues at the start of the next slot
+	for remaining, curSlot := size, new(big.Int).Set(slot); remaining > 0; curSlot = new(big.Int).Add(curSlot, big.NewInt(1)) {
+
+		segmentSize := remaining
+
+		if segmentSize > 32-offset {
+
+			segmentSize = 32 - offset
+		}
+
+		m.Segments = append(m.Segments, SlotSegment{Label: label, Root: root, Type: typeName, Slot: curSlot, Offset: offset, Size: segmentSize})
+		remaining -= segmentSize
+		offset = 0
+	}
+
+	return nil
+}
+
+// function to add the segments of the elements of an array that start at the given slot
+func (m *SlotMap) addElements(types map[string]TypeDescription, root, label, baseType string, slot *big.Int, numberOfElements uint64) error {
+
+	baseDescription, found := types[baseType]
+
+	if !found {
+
+		return errors.New("Type not found " + baseType)
+	}
+
+	baseSize, ok := new(big.Int).SetString(baseDescription.NumberOfBytes, 10)
+
+	if !ok || baseSize.Sign() == 0 {
+
+		return errors.New("Invalid Number Of Bytes For Type " + baseType)
+	}
+
+	elementSize := baseSize.Uint64()
+
+	// elements that are smaller than a slot are packed, larger elements start at a new slot
+	if elementSize < 32 {
+
+		elementsPerSlot := 32 / elementSize
+
+		for i := uint64(0); i < numberOfElements; i++ {
+
+			err := m.addType(types, root, fmt.Sprintf("%s[%d]", label, i), baseType, new(big.Int).Add(slot, new(big.Int).SetUint64(i/elementsPerSlot)), (i%elementsPerSlot)*elementSize)
+
+			if err != nil {
+
+				return err
+			}
+		}
+
+	} else {
+
+		slotsPerElement := (elementSize + 31) / 32
+
+		for i := uint64(0); i < numberOfElements; i++ {
+
+			err := m.addType(types, root, fmt.Sprintf("%s[%d]", label, i), baseType, new(big.Int).Add(slot, new(big.Int).SetUint64(i*slotsPerElement)), 0)
+
+			if err != nil {
+
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// builds the slot map of a storage layout
+func NewSlotMap(layout *StorageLayout) (*SlotMap, error) {
+
+	slotMap := &SlotMap{}
+
+	for _, item := range layout.Storage {
+
+		slot, err := SlotToHash(item.Slot)
+
+		if err != nil {
+
+			return nil, err
+		}
+
+		firstSegment, firstRegion := len(slotMap.Segments), len(slotMap.Regions)
+
+		if err := slotMap.addType(layout.Types, item.Label, item.Label, item.Type, slot.Big(), item.Offset); err != nil {
+
+			return nil, err
+		}
+
+		for i := firstSegment; i < len(slotMap.Segments); i++ {
+
+			slotMap.Segments[i].Contract = getContractName(item)
+		}
+
+		for i := firstRegion; i < len(slotMap.Regions); i++ {
+
+			slotMap.Regions[i].Contract = getContractName(item)
+		}
+	}
+
+	return slotMap, nil
+}
+
+// returns the slots used by the slot map in ascending order
+func (m *SlotMap) Slots() []*big.Int {
+
+	seen := make(map[string]bool)
+	slots := make([]*big.Int, 0)
+
+	for _, segment := range m.Segments {
+
+		if !seen[segment.Slot.String()] {
+
+			seen[segment.Slot.String()] = true
+			slots = append(slots, segment.Slot)
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Cmp(slots[j]) < 0 })
+
+	return slots
+}
+
+// returns the segments stored in a slot
+func (m *SlotMap) SegmentsInSlot(slot *big.Int) []SlotSegment {
+
+	segments := make([]SlotSegment, 0)
+
+	for _, segment := range m.Segments {
+
+		if segment.Slot.Cmp(slot) == 0 {
+
+			segments = append(segments, segment)
+		}
+	}
+
+	return segments
+}
+
+// struct that holds everything required to draw the reorganization of a contract's storage
+type LayoutVisualizer struct {
+	oldMap      *SlotMap
+	newMap      *SlotMap
+	newLayout   *StorageLayout
+	reorgInfos  []ReorgInfo
+	colorIndex  map[string]int
+	symbolIndex map[string]int
+	qualified   bool // set if the variables are named by their contract and label, see variableName
+}
+
+// returns a new LayoutVisualizer object. Every variable gets the same color and symbol in both layouts
+func NewLayoutVisualizer(oldLayout, newLayout *StorageLayout, reorgInfos []ReorgInfo) (*LayoutVisualizer, error) {
+
+	oldMap, err := NewSlotMap(oldLayout)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	newMap, err := NewSlotMap(newLayout)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	visualizer := &LayoutVisualizer{
+		oldMap:      oldMap,
+		newMap:      newMap,
+		newLayout:   newLayout,
+		reorgInfos:  reorgInfos,
+		colorIndex:  make(map[string]int),
+		symbolIndex: make(map[string]int),
+		qualified:   isInheritanceChain(oldLayout) || isInheritanceChain(newLayout),
+	}
+
+	// the variables of a renamed contract get the old name of their contract, so they keep their color and arrow
+	oldContracts := make(map[string]string)
+
+	for _, reorgInfo := range reorgInfos {
+
+		if reorgInfo.NewContract != "" {
+
+			oldContracts[reorgInfo.NewContract+"."+reorgInfo.Label] = reorgInfo.Contract
+		}
+	}
+
+	for i, segment := range newMap.Segments {
+
+		if contract, found := oldContracts[segment.Contract+"."+segment.Root]; found {
+
+			newMap.Segments[i].Contract = contract
+		}
+	}
+
+	for i, region := range newMap.Regions {
+
+		if contract, found := oldContracts[region.Contract+"."+region.Root]; found {
+
+			newMap.Regions[i].Contract = contract
+		}
+	}
+
+	for _, slotMap := range []*SlotMap{oldMap, newMap} {
+
+		for _, segment := range slotMap.Segments {
+
+			name := visualizer.variableName(segment.Contract, segment.Root)
+
+			if _, found := visualizer.colorIndex[name]; !found {
+
+				visualizer.colorIndex[name] = len(visualizer.colorIndex)
+				visualizer.symbolIndex[name] = len(visualizer.symbolIndex)
+			}
+		}
+	}
+
+	return visualizer, nil
+}
+
+// function to get the name of a variable in the visualization. The variables of an inheritance chain are qualified by
+// their contract, since different base contracts may declare variables with the same label
+func (v *LayoutVisualizer) variableName(contract, label string) string {
+
+	if !v.qualified || contract == "" {
+
+		return label
+	}
+
+	return contract + "." + label
+}
+
+// function to get the name of the variable of a reorganization message. Only paired variables record their contract,
+// the contract of an added variable is looked up in the new layout
+func (v *LayoutVisualizer) reorgName(reorgInfo ReorgInfo) string {
+
+	contract := reorgInfo.Contract
+
+	if item, found := v.newLayout.FindItem(reorgInfo.Label); contract == "" && found {
+
+		contract = getContractName(item)
+	}
+
+	return v.variableName(contract, reorgInfo.Label)
+}
+
+// function to check if a variable is moved by the reorganization
+func (v *LayoutVisualizer) isReorganized(name string) bool {
+
+	for _, reorgInfo := range v.reorgInfos {
+
+		if v.reorgName(reorgInfo) == name {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *LayoutVisualizer) symbol(name string) byte {
+
+	return slotMapSymbols[v.symbolIndex[name]%len(slotMapSymbols)]
+}
+
+// function to get the terminal color of a variable
+func (v *LayoutVisualizer) terminalColor(name string) string {
+
+	return terminalColors[v.colorIndex[name]%len(terminalColors)]
+}
+
+// draws a slot as 32 characters with the most significant byte on the left, the same way the slot value is printed
+func (v *LayoutVisualizer) drawSlot(segments []SlotSegment) string {
+
+	var builder strings.Builder
+
+	for i := 31; i >= 0; {
+
+		found := false
+
+		for _, segment := range segments {
+
+			if uint64(i) >= segment.Offset && uint64(i) < segment.Offset+segment.Size {
+
+				// all the bytes of the segment are drawn with a single color
+				name := v.variableName(segment.Contract, segment.Root)
+				numberOfBytes := i - int(segment.Offset) + 1
+				builder.WriteString(v.terminalColor(name) + strings.Repeat(string(v.symbol(name)), numberOfBytes) + reset)
+				i -= numberOfBytes
+				found = true
+				break
+			}
+		}
+
+		if !found {
+
+			builder.WriteString(".")
+			i--
+		}
+	}
+
+	return builder.String()
+}
+
+// renders the old and the new slot map side by side as an ASCII grid followed by the moves of the variables
+func (v *LayoutVisualizer) RenderASCII() string {
+
+	var builder strings.Builder
+
+	oldSlots := v.oldMap.Slots()
+	newSlots := v.newMap.Slots()
+	numberOfRows := len(oldSlots)
+
+	if len(newSlots) > numberOfRows {
+
+		numberOfRows = len(newSlots)
+	}
+
+	builder.WriteString(fmt.Sprintf("%-8s %-32s    %-8s %-32s\n", "slot", "old layout", "slot", "new layout"))
+
+	for i := 0; i < numberOfRows; i++ {
+
+		if i < len(oldSlots) {
+
+			builder.WriteString(fmt.Sprintf("%-8s %s", oldSlots[i].String(), v.drawSlot(v.oldMap.SegmentsInSlot(oldSlots[i]))))
+
+		} else {
+
+			builder.WriteString(strings.Repeat(" ", 41))
+		}
+
+		builder.WriteString("    ")
+
+		if i < len(newSlots) {
+
+			builder.WriteString(fmt.Sprintf("%-8s %s", newSlots[i].String(), v.drawSlot(v.newMap.SegmentsInSlot(newSlots[i]))))
+		}
+
+		builder.WriteString("\n")
+	}
+
+	builder.WriteString("\nLegend:\n")
+
+	names := make([]string, 0, len(v.symbolIndex))
+
+	for name := range v.symbolIndex {
+
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool { return v.symbolIndex[names[i]] < v.symbolIndex[names[j]] })
+
+	for _, name := range names {
+
+		builder.WriteString(fmt.Sprintf("  %s%c%s %s\n", v.terminalColor(name), v.symbol(name), reset, name))
+	}
+
+	if baseMoves := GetBaseMoves(v.reorgInfos); len(baseMoves) != 0 {
+
+		builder.WriteString("\nBase contracts:\n")
+
+		for _, baseMove := range baseMoves {
+
+			builder.WriteString("  " + baseMove.String() + "\n")
+		}
+	}
+
+	builder.WriteString("\nMoves:\n")
+
+	for _, reorgInfo := range v.reorgInfos {
+
+		// variables of different contracts of an inheritance chain may have the same label
+		label := reorgInfo.Label
+
+		if reorgInfo.Contract != "" {
+
+			label = reorgInfo.Contract + "." + label
+		}
+
+		name := v.reorgName(reorgInfo)
+
+		if reorgInfo.Gap {
+
+			builder.WriteString(fmt.Sprintf("  %s%c%s %s: storage gap at slot %s --> slot %s, its contents are not moved\n", v.terminalColor(name), v.symbol(name), reset,
+				label, reorgInfo.PrevSlot.Big(), reorgInfo.NewSlot.Big()))
+
+			continue
+		}
+
+		// initialized and computed variables have no old location to move from
+		if reorgInfo.IsComputed() {
+
+			origin := "computed"
+
+			if reorgInfo.InitialValue != nil {
+
+				origin = "initialized"
+			}
+
+			builder.WriteString(fmt.Sprintf("  %s%c%s %s: %s at slot %s offset %d\n", v.terminalColor(name), v.symbol(name), reset,
+				label, origin, reorgInfo.NewSlot.Big(), reorgInfo.NewOffset))
+
+			continue
+		}
+
+		builder.WriteString(fmt.Sprintf("  %s%c%s %s: slot %s offset %d --> slot %s offset %d\n", v.terminalColor(name), v.symbol(name), reset,
+			label, reorgInfo.PrevSlot.Big(), reorgInfo.PrevOffset, reorgInfo.NewSlot.Big(), reorgInfo.NewOffset))
+	}
+
+	builder.WriteString("\nData regions:\n")
+
+	for _, oldRegion := range v.oldMap.Regions {
+
+		for _, newRegion := range v.newMap.Regions {
+
+			if oldRegion.Label == newRegion.Label && oldRegion.Contract == newRegion.Contract && v.isReorganized(v.variableName(oldRegion.Contract, oldRegion.Root)) {
+
+				builder.WriteString(fmt.Sprintf("  %s: keccak256(%s) = %s --> keccak256(%s) = %s\n", oldRegion.Label, oldRegion.Slot, oldRegion.DataSlot.Hex(), newRegion.Slot, newRegion.DataSlot.Hex()))
+			}
+		}
+	}
+
+	builder.WriteString("\nNot reorganized:\n")
+
+	for _, name := range names {
+
+		if !v.isReorganized(name) {
+
+			builder.WriteString("  " + name + "\n")
+		}
+	}
+
+	return builder.String()
+}
+
+const (
+	// dimensions of the SVG slot map
+	svgByteWidth   = 12
+	svgRowHeight   = 28
+	svgLabelWidth  = 90
+	svgColumnGap   = 160
+	svgHeaderSpace = 40
+)
+
+// draws one of the slot maps of the SVG and returns the position of the first segment and data region of every variable
+func (v *LayoutVisualizer) drawSVGColumn(builder *strings.Builder, slotMap *SlotMap, x int, title string) (map[string][2]int, map[string][2]int) {
+
+	segmentPositions := make(map[string][2]int)
+	regionPositions := make(map[string][2]int)
+
+	builder.WriteString(fmt.Sprintf("<text x=\"%d\" y=\"20\" font-weight=\"bold\">%s</text>\n", x, html.EscapeString(title)))
+
+	slots := slotMap.Slots()
+
+	for row, slot := range slots {
+
+		y := svgHeaderSpace + row*svgRowHeight
+
+		builder.WriteString(fmt.Sprintf("<text x=\"%d\" y=\"%d\">slot %s</text>\n", x, y+18, slot))
+		builder.WriteString(fmt.Sprintf("<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"#f4f4f4\" stroke=\"#999\"/>\n", x+svgLabelWidth, y, 32*svgByteWidth, svgRowHeight-4))
+
+		for _, segment := range slotMap.SegmentsInSlot(slot) {
+
+			name := v.variableName(segment.Contract, segment.Root)
+			segmentX := x + svgLabelWidth + int(32-segment.Offset-segment.Size)*svgByteWidth
+			color := svgColors[v.colorIndex[name]%len(svgColors)]
+
+			builder.WriteString(fmt.Sprintf("<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" stroke=\"#333\"><title>%s (offset %d, %d bytes)</title></rect>\n",
+				segmentX, y, int(segment.Size)*svgByteWidth, svgRowHeight-4, color, html.EscapeString(segment.Label), segment.Offset, segment.Size))
+			builder.WriteString(fmt.Sprintf("<text x=\"%d\" y=\"%d\" font-size=\"10\" fill=\"#fff\">%s</text>\n", segmentX+2, y+16, html.EscapeString(segment.Label)))
+
+			if _, found := segmentPositions[name]; !found {
+
+				segmentPositions[name] = [2]int{segmentX, y + (svgRowHeight-4)/2}
+			}
+		}
+	}
+
+	for i, region := range slotMap.Regions {
+
+		y := svgHeaderSpace + (len(slots)+1+i)*svgRowHeight
+		color := svgColors[v.colorIndex[v.variableName(region.Contract, region.Root)]%len(svgColors)]
+
+		builder.WriteString(fmt.Sprintf("<text x=\"%d\" y=\"%d\">keccak256(%s)</text>\n", x, y+18, region.Slot))
+		builder.WriteString(fmt.Sprintf("<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" fill-opacity=\"0.4\" stroke=\"#333\" stroke-dasharray=\"4\"><title>%s</title></rect>\n",
+			x+svgLabelWidth, y, 32*svgByteWidth, svgRowHeight-4, color, region.DataSlot.Hex()))
+		builder.WriteString(fmt.Sprintf("<text x=\"%d\" y=\"%d\" font-size=\"10\">data of %s</text>\n", x+svgLabelWidth+4, y+16, html.EscapeString(region.Label)))
+
+		name := v.variableName(region.Contract, region.Label)
+
+		if _, found := regionPositions[name]; !found {
+
+			regionPositions[name] = [2]int{x + svgLabelWidth, y + (svgRowHeight-4)/2}
+		}
+	}
+
+	return segmentPositions, regionPositions
+}
+
+// renders the old and the new slot map side by side as an SVG image with arrows that show where each variable moves
+func (v *LayoutVisualizer) RenderSVG() string {
+
+	var body strings.Builder
+
+	columnWidth := svgLabelWidth + 32*svgByteWidth
+	oldX := 10
+	newX := oldX + columnWidth + svgColumnGap
+
+	oldSegments, oldRegions := v.drawSVGColumn(&body, v.oldMap, oldX, "old layout")
+	newSegments, newRegions := v.drawSVGColumn(&body, v.newMap, newX, "new layout")
+
+	for _, reorgInfo := range v.reorgInfos {
+
+		if reorgInfo.Gap || reorgInfo.IsComputed() {
+
+			continue
+		}
+
+		name := v.reorgName(reorgInfo)
+		color := svgColors[v.colorIndex[name]%len(svgColors)]
+		arrows := [][2][2]int{}
+
+		if from, found := oldSegments[name]; found {
+
+			if to, found := newSegments[name]; found {
+
+				arrows = append(arrows, [2][2]int{{oldX + columnWidth, from[1]}, to})
+			}
+		}
+
+		for label, from := range oldRegions {
+
+			if label != name && !strings.HasPrefix(label, name+".") && !strings.HasPrefix(label, name+"[") {
+
+				continue
+			}
+
+			if to, found := newRegions[label]; found {
+
+				arrows = append(arrows, [2][2]int{{oldX + columnWidth, from[1]}, to})
+			}
+		}
+
+		for _, arrow := range arrows {
+
+			body.WriteString(fmt.Sprintf("<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"%s\" stroke-width=\"2\" marker-end=\"url(#arrow)\"/>\n",
+				arrow[0][0], arrow[0][1], arrow[1][0], arrow[1][1], color))
+		}
+	}
+
+	numberOfRows := len(v.oldMap.Slots()) + len(v.oldMap.Regions)
+
+	if rows := len(v.newMap.Slots()) + len(v.newMap.Regions); rows > numberOfRows {
+
+		numberOfRows = rows
+	}
+
+	width := newX + columnWidth + 10
+	height := svgHeaderSpace + (numberOfRows+2)*svgRowHeight
+
+	var builder strings.Builder
+
+	builder.WriteString(fmt.Sprintf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"12\">\n", width, height))
+	builder.WriteString("<defs><marker id=\"arrow\" markerWidth=\"10\" markerHeight=\"10\" refX=\"9\" refY=\"3\" orient=\"auto\"><path d=\"M0,0 L0,6 L9,3 z\" fill=\"#333\"/></marker></defs>\n")
+	builder.WriteString(body.String())
+	builder.WriteString("</svg>\n")
+
+	return builder.String()
+}
+
+// renders the SVG slot map inside a standalone HTML page
+func (v *LayoutVisualizer) RenderHTML() string {
+
+	return "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Storage Reorganization</title>\n</head>\n<body>\n" + v.RenderSVG() + "</body>\n</html>\n"
+}
+
+// reads the layouts and the plan of a test directory and returns their visualizer
+func readLayoutVisualizer(directoryPath string) (*LayoutVisualizer, error) {
+
+	oldLayout, err := ReadStorageLayoutFromFile(directoryPath + "/" + "old_layout.json")
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	newLayout, err := ReadStorageLayoutFromFile(directoryPath + "/" + "new_layout.json")
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	reorgInfos, err := ReadReorgInfoFromFile(directoryPath + "/" + "storage_reorg_info.json")
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return NewLayoutVisualizer(oldLayout, newLayout, reorgInfos)
+}
+
+// checks that the ASCII slot map of a test is the expected rendering in slot_map.txt. The colors of the terminal are
+// not part of the expected rendering
+func checkSlotMap(directoryPath string) error {
+
+	if _, err := os.Stat(directoryPath + "/" + "slot_map.txt"); err != nil {
+
+		return nil
+	}
+
+	expectedRendering, err := ioutil.ReadFile(directoryPath + "/" + "slot_map.txt")
+
+	if err != nil {
+
+		return err
+	}
+
+	visualizer, err := readLayoutVisualizer(directoryPath)
+
+	if err != nil {
+
+		return err
+	}
+
+	rendering := terminalColorPattern.ReplaceAllString(visualizer.RenderASCII(), "")
+	renderedLines := strings.Split(rendering, "\n")
+	expectedLines := strings.Split(string(expectedRendering), "\n")
+
+	for i, line := range renderedLines {
+
+		if i >= len(expectedLines) || line != expectedLines[i] {
+
+			return fmt.Errorf("Slot Map Differs From slot_map.txt At Line %d: %s", i+1, line)
+		}
+	}
+
+	if len(expectedLines) != len(renderedLines) {
+
+		return errors.New("Slot Map Is Shorter Than slot_map.txt")
+	}
+
+	return nil
+}
+
+// draws the reorganization of the test directory in the terminal and optionally writes it to an HTML or SVG file
+func runVisualize(directoryPath string, outputPath string) error {
+
+	visualizer, err := readLayoutVisualizer(directoryPath)
+
+	if err != nil {
+
+		return err
+	}
+
+	fmt.Print(visualizer.RenderASCII())
+
+	if outputPath == "" {
+
+		return nil
+	}
+
+	output := visualizer.RenderHTML()
+
+	if strings.HasSuffix(outputPath, ".svg") {
+
+		output = visualizer.RenderSVG()
+	}
+
+	return ioutil.WriteFile(outputPath, []byte(output), 0644)
+}
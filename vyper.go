@@ -0,0 +1,843 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// encodings of the Vyper types that are stored differently than the Solidity types
+	EncodingVyperHashMap  = "vyper_hashmap"  // the value of a key is stored at keccak256(slot . key)
+	EncodingVyperDynArray = "vyper_dynarray" // the length is stored at the slot and the elements in the following slots
+	EncodingVyperBytes    = "vyper_bytes"    // the length is stored at the slot and the data in the following slots
+)
+
+// the first line of a struct, flag, enum or interface definition of a Vyper source
+var vyperDefinitionPattern = regexp.MustCompile(`^(struct|flag|enum|interface)\s+([A-Za-z_][A-Za-z0-9_]*)\s*:`)
+
+// struct to represent the definitions of a Vyper source that are not included in the output of vyper -f layout
+type VyperDeclarations struct {
+	Structs    []StructDeclaration `json:"structs,omitempty"`
+	Flags      []EnumDeclaration   `json:"flags,omitempty"` // flags and the enums of older Vyper versions
+	Interfaces []string            `json:"interfaces,omitempty"`
+}
+
+// struct to represent a variable of the output of vyper -f layout
+type vyperLayoutEntry struct {
+	Type   string       `json:"type"`
+	Slot   json.Number  `json:"slot"`
+	NSlots *json.Number `json:"n_slots"`
+}
+
+// struct that holds the state of the import of a Vyper storage layout
+type vyperLayoutBuilder struct {
+	declarations *VyperDeclarations
+	layout       *StorageLayout
+	visiting     map[string]bool
+}
+
+// function to parse the struct, flag and interface definitions of a Vyper source. The members of a definition are
+// the indented lines that follow it
+func ParseVyperDeclarations(source string) (*VyperDeclarations, error) {
+
+	declarations := &VyperDeclarations{}
+	kind := ""
+
+	for number, line := range strings.Split(source, "\n") {
+
+		if index := strings.Index(line, "#"); index != -1 {
+
+			line = line[:index]
+		}
+
+		if strings.TrimSpace(line) == "" {
+
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+
+			kind = ""
+			match := vyperDefinitionPattern.FindStringSubmatch(line)
+
+			if match == nil {
+
+				continue
+			}
+
+			kind = match[1]
+
+			if kind == "struct" {
+
+				declarations.Structs = append(declarations.Structs, StructDeclaration{Name: match[2], Members: []VariableDeclaration{}})
+
+			} else if kind == "interface" {
+
+				declarations.Interfaces = append(declarations.Interfaces, match[2])
+
+			} else {
+
+				declarations.Flags = append(declarations.Flags, EnumDeclaration{Name: match[2], Members: []string{}})
+			}
+
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+
+		if kind == "struct" {
+
+			separator := strings.Index(line, ":")
+
+			if separator == -1 {
+
+				return nil, errors.New("Invalid Struct Member In Line " + strconv.Itoa(number+1) + ": " + line)
+			}
+
+			structDeclaration := &declarations.Structs[len(declarations.Structs)-1]
+			structDeclaration.Members = append(structDeclaration.Members, VariableDeclaration{
+				Name: strings.TrimSpace(line[:separator]),
+				Type: strings.TrimSpace(line[separator+1:]),
+			})
+
+		} else if kind == "flag" || kind == "enum" {
+
+			if !isIdentifier(line) {
+
+				return nil, errors.New("Invalid Flag Member In Line " + strconv.Itoa(number+1) + ": " + line)
+			}
+
+			flagDeclaration := &declarations.Flags[len(declarations.Flags)-1]
+			flagDeclaration.Members = append(flagDeclaration.Members, line)
+		}
+	}
+
+	return declarations, nil
+}
+
+// function to split the arguments of a Vyper type, e.g. "address, DynArray[uint256, 3]", at the commas that are not
+// nested in brackets
+func splitVyperArguments(arguments string) []string {
+
+	parts := make([]string, 0)
+	depth := 0
+	start := 0
+
+	for i := 0; i < len(arguments); i++ {
+
+		if arguments[i] == '[' {
+
+			depth++
+
+		} else if arguments[i] == ']' {
+
+			depth--
+
+		} else if arguments[i] == ',' && depth == 0 {
+
+			parts = append(parts, strings.TrimSpace(arguments[start:i]))
+			start = i + 1
+		}
+	}
+
+	return append(parts, strings.TrimSpace(arguments[start:]))
+}
+
+// function to parse the length of a Vyper array, Bytes or String type
+func parseVyperLength(length, typeName string) (uint64, error) {
+
+	value, err := strconv.ParseUint(length, 10, 64)
+
+	if err != nil || value == 0 {
+
+		return 0, errors.New("Invalid Length In Vyper Type " + typeName)
+	}
+
+	return value, nil
+}
+
+// function to add a type to the layout and return its id and its number of slots
+func (b *vyperLayoutBuilder) addType(typeId string, typeDescription TypeDescription, numberOfSlots uint64) (string, uint64, error) {
+
+	typeDescription.NumberOfBytes = strconv.FormatUint(numberOfSlots*32, 10)
+	b.layout.Types[typeId] = typeDescription
+
+	return typeId, numberOfSlots, nil
+}
+
+// function to add a Vyper type and the types it uses to the layout. Vyper does not pack variables, so every value
+// type takes a whole slot and every struct member and array element starts at a new slot
+func (b *vyperLayoutBuilder) resolveType(typeName string) (string, uint64, error) {
+
+	typeName = strings.TrimSpace(typeName)
+
+	if strings.HasSuffix(typeName, "]") {
+
+		open := -1
+		depth := 0
+
+		// find the bracket that matches the last bracket
+		for i := len(typeName) - 1; i >= 0; i-- {
+
+			if typeName[i] == ']' {
+
+				depth++
+
+			} else if typeName[i] == '[' {
+
+				depth--
+
+				if depth == 0 {
+
+					open = i
+					break
+				}
+			}
+		}
+
+		if open <= 0 {
+
+			return "", 0, errors.New("Invalid Vyper Type " + typeName)
+		}
+
+		prefix := strings.TrimSpace(typeName[:open])
+		arguments := splitVyperArguments(typeName[open+1 : len(typeName)-1])
+
+		if prefix == "HashMap" {
+
+			if len(arguments) != 2 {
+
+				return "", 0, errors.New("Invalid Vyper Type " + typeName)
+			}
+
+			keyId, _, err := b.resolveType(arguments[0])
+
+			if err != nil {
+
+				return "", 0, err
+			}
+
+			valueId, _, err := b.resolveType(arguments[1])
+
+			if err != nil {
+
+				return "", 0, err
+			}
+
+			return b.addType("t_hashmap("+keyId+","+valueId+")", TypeDescription{
+				Encoding: EncodingVyperHashMap,
+				Label:    "HashMap[" + b.layout.Types[keyId].Label + ", " + b.layout.Types[valueId].Label + "]",
+				Key:      keyId,
+				Value:    valueId,
+			}, 1)
+
+		} else if prefix == "DynArray" {
+
+			if len(arguments) != 2 {
+
+				return "", 0, errors.New("Invalid Vyper Type " + typeName)
+			}
+
+			baseId, baseSlots, err := b.resolveType(arguments[0])
+
+			if err != nil {
+
+				return "", 0, err
+			}
+
+			length, err := parseVyperLength(arguments[1], typeName)
+
+			if err != nil {
+
+				return "", 0, err
+			}
+
+			return b.addType("t_dynarray("+baseId+")"+arguments[1]+"_storage", TypeDescription{
+				Encoding: EncodingVyperDynArray,
+				Label:    "DynArray[" + b.layout.Types[baseId].Label + ", " + arguments[1] + "]",
+				Base:     baseId,
+			}, 1+length*baseSlots)
+
+		} else if prefix == "Bytes" || prefix == "String" {
+
+			if len(arguments) != 1 {
+
+				return "", 0, errors.New("Invalid Vyper Type " + typeName)
+			}
+
+			length, err := parseVyperLength(arguments[0], typeName)
+
+			if err != nil {
+
+				return "", 0, err
+			}
+
+			return b.addType("t_"+strings.ToLower(prefix)+"("+arguments[0]+")_storage", TypeDescription{
+				Encoding: EncodingVyperBytes,
+				Label:    prefix + "[" + arguments[0] + "]",
+			}, 1+(length+31)/32)
+		}
+
+		// a fixed size array, e.g. uint256[3]
+		if len(arguments) != 1 {
+
+			return "", 0, errors.New("Invalid Vyper Type " + typeName)
+		}
+
+		baseId, baseSlots, err := b.resolveType(prefix)
+
+		if err != nil {
+
+			return "", 0, err
+		}
+
+		length, err := parseVyperLength(arguments[0], typeName)
+
+		if err != nil {
+
+			return "", 0, err
+		}
+
+		return b.addType("t_array("+baseId+")"+arguments[0]+"_storage", TypeDescription{
+			Encoding: "inplace",
+			Label:    b.layout.Types[baseId].Label + "[" + arguments[0] + "]",
+			Base:     baseId,
+		}, length*baseSlots)
+	}
+
+	if expressionType, ok := ParseTypeName(typeName); ok && expressionType.Kind != ExpressionBytes && expressionType.Kind != ExpressionString && typeName != "uint" && typeName != "int" {
+
+		return b.addType("t_"+typeName, TypeDescription{Encoding: "inplace", Label: typeName}, 1)
+
+	} else if typeName == "decimal" {
+
+		return b.addType("t_decimal", TypeDescription{Encoding: "inplace", Label: typeName}, 1)
+	}
+
+	if b.declarations != nil {
+
+		for i := range b.declarations.Structs {
+
+			if b.declarations.Structs[i].Name == typeName {
+
+				return b.resolveStruct(&b.declarations.Structs[i])
+			}
+		}
+
+		for _, flagDeclaration := range b.declarations.Flags {
+
+			if flagDeclaration.Name == typeName {
+
+				// flags are bit sets, so their values are copied instead of being translated like Solidity enums
+				return b.addType("t_flag("+typeName+")", TypeDescription{Encoding: "inplace", Label: "flag " + typeName}, 1)
+			}
+		}
+
+		for _, interfaceName := range b.declarations.Interfaces {
+
+			if interfaceName == typeName {
+
+				return b.addType("t_contract("+typeName+")", TypeDescription{Encoding: "inplace", Label: "contract " + typeName}, 1)
+			}
+		}
+	}
+
+	return "", 0, errors.New("Unknown Vyper Type " + typeName + ", The Source Defining It Is Required")
+}
+
+// function to add a Vyper struct to the layout. Its members are placed one after another, each at a new slot
+func (b *vyperLayoutBuilder) resolveStruct(structDeclaration *StructDeclaration) (string, uint64, error) {
+
+	if b.visiting[structDeclaration.Name] {
+
+		return "", 0, errors.New("Recursive Struct " + structDeclaration.Name)
+	}
+
+	b.visiting[structDeclaration.Name] = true
+	defer delete(b.visiting, structDeclaration.Name)
+
+	members := make([]StorageItem, 0, len(structDeclaration.Members))
+	numberOfSlots := uint64(0)
+
+	for _, member := range structDeclaration.Members {
+
+		memberId, memberSlots, err := b.resolveType(member.Type)
+
+		if err != nil {
+
+			return "", 0, err
+		}
+
+		if b.layout.Types[memberId].Encoding == EncodingVyperHashMap {
+
+			return "", 0, errors.New("HashMap Member " + member.Name + " Of Struct " + structDeclaration.Name + " Is Not Allowed In Vyper")
+		}
+
+		members = append(members, StorageItem{Label: member.Name, Slot: strconv.FormatUint(numberOfSlots, 10), Type: memberId})
+		numberOfSlots += memberSlots
+	}
+
+	return b.addType("t_struct("+structDeclaration.Name+")_storage", TypeDescription{
+		Encoding: "inplace",
+		Label:    "struct " + structDeclaration.Name,
+		Members:  members,
+	}, numberOfSlots)
+}
+
+// function to flatten the variables of the output of vyper -f layout. The variables of the modules used by a contract
+// are nested in an object named after the module, their labels are prefixed with the name of the module
+func flattenVyperLayout(data json.RawMessage, prefix string, entries map[string]vyperLayoutEntry) error {
+
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+
+		return err
+	}
+
+	for name, field := range fields {
+
+		var entry map[string]json.RawMessage
+
+		if err := json.Unmarshal(field, &entry); err != nil {
+
+			return errors.New("Invalid Vyper Layout Entry " + prefix + name)
+		}
+
+		if entry["type"] == nil {
+
+			if err := flattenVyperLayout(field, prefix+name+".", entries); err != nil {
+
+				return err
+			}
+
+			continue
+		}
+
+		var variable vyperLayoutEntry
+
+		if err := json.Unmarshal(field, &variable); err != nil {
+
+			return errors.New("Invalid Vyper Layout Entry " + prefix + name + ": " + err.Error())
+		}
+
+		entries[prefix+name] = variable
+	}
+
+	return nil
+}
+
+// converts the output of vyper -f layout into a storage layout like the one generated by solc --storage-layout, so the
+// plan of a Vyper contract is generated and executed like the plan of a Solidity contract. Vyper does not include the
+// definitions of structs, flags and interfaces in the layout, they are read from the declarations of the source
+func ImportVyperLayout(data []byte, declarations *VyperDeclarations) (*StorageLayout, error) {
+
+	var output struct {
+		StorageLayout json.RawMessage `json:"storage_layout"`
+	}
+
+	if err := json.Unmarshal(data, &output); err != nil {
+
+		return nil, err
+	}
+
+	if output.StorageLayout == nil {
+
+		return nil, errors.New("Vyper Layout Has No storage_layout")
+	}
+
+	entries := make(map[string]vyperLayoutEntry)
+
+	if err := flattenVyperLayout(output.StorageLayout, "", entries); err != nil {
+
+		return nil, err
+	}
+
+	builder := &vyperLayoutBuilder{
+		declarations: declarations,
+		layout:       &StorageLayout{Storage: []StorageItem{}, Types: make(map[string]TypeDescription)},
+		visiting:     make(map[string]bool),
+	}
+
+	slots := make(map[string]*big.Int)
+
+	for label, entry := range entries {
+
+		slot, ok := new(big.Int).SetString(entry.Slot.String(), 10)
+
+		if !ok {
+
+			return nil, errors.New("Invalid Slot Of " + label + ": " + entry.Slot.String())
+		}
+
+		typeName := entry.Type
+
+		// the reentrancy lock is a variable of the compiler that holds a single word
+		if typeName == "nonreentrant lock" {
+
+			typeName = "uint256"
+		}
+
+		typeId, numberOfSlots, err := builder.resolveType(typeName)
+
+		if err != nil {
+
+			return nil, errors.New("Invalid Type Of " + label + ": " + err.Error())
+		}
+
+		if entry.NSlots != nil && entry.NSlots.String() != strconv.FormatUint(numberOfSlots, 10) {
+
+			return nil, errors.New(fmt.Sprintf("Vyper Layout Reserves %s Slots For %s Instead Of %d", entry.NSlots.String(), label, numberOfSlots))
+		}
+
+		slots[label] = slot
+		builder.layout.Storage = append(builder.layout.Storage, StorageItem{Label: label, Slot: slot.String(), Type: typeId})
+	}
+
+	// the variables are ordered by their slots like the variables of a layout generated by solc
+	sort.Slice(builder.layout.Storage, func(i, j int) bool {
+
+		first, second := builder.layout.Storage[i], builder.layout.Storage[j]
+
+		if comparison := slots[first.Label].Cmp(slots[second.Label]); comparison != 0 {
+
+			return comparison < 0
+		}
+
+		return first.Label < second.Label
+	})
+
+	return builder.layout, nil
+}
+
+// reads the definitions of a Vyper source
+func ReadVyperDeclarationsFromFile(filePath string) (*VyperDeclarations, error) {
+
+	byteVal, err := ioutil.ReadFile(filePath)
+
+	if err != nil {
+		fmt.Println(red + err.Error() + reset)
+		return nil, err
+	}
+
+	return ParseVyperDeclarations(string(byteVal))
+}
+
+// reads the output of vyper -f layout and converts it with the definitions of the given Vyper source, which may be
+// empty if the contract uses no structs, flags or interfaces
+func ReadVyperLayoutFromFile(layoutPath, sourcePath string) (*StorageLayout, error) {
+
+	var declarations *VyperDeclarations
+
+	if sourcePath != "" {
+
+		var err error
+
+		if declarations, err = ReadVyperDeclarationsFromFile(sourcePath); err != nil {
+
+			return nil, err
+		}
+	}
+
+	byteVal, err := ioutil.ReadFile(layoutPath)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	return ImportVyperLayout(byteVal, declarations)
+}
+
+// function to check if the encoding of a data type stores the values of keys at hashed slots
+func IsMappingEncoding(encoding string) bool {
+
+	return encoding == "mapping" || encoding == EncodingVyperHashMap
+}
+
+// function to check if the encoding of a data type is one of the encodings of Vyper types
+func (s *StorageReorganizer) IsEncodingVyper(dataType string) (bool, error) {
+
+	if data, found := s.dataTypes[dataType]; found {
+
+		return data.Encoding == EncodingVyperHashMap || data.Encoding == EncodingVyperDynArray || data.Encoding == EncodingVyperBytes, nil
+
+	} else {
+
+		return false, errors.New("Type not found")
+	}
+}
+
+// Reorganizes data types with the encodings of Vyper types
+func (s *StorageReorganizer) ReorganizeVyper(reorgMessage ReorgInfo) error {
+
+	switch s.dataTypes[reorgMessage.Type].Encoding {
+
+	case EncodingVyperHashMap:
+		return s.ReorganizeVyperHashMap(reorgMessage)
+	case EncodingVyperDynArray:
+		return s.ReorganizeVyperDynArray(reorgMessage)
+	case EncodingVyperBytes:
+		return s.ReorganizeVyperBytes(reorgMessage)
+	}
+
+	return errors.New("Not implemented yet")
+}
+
+// function to encode the key of a Vyper HashMap. Value types are stored in a whole word, Bytes and String keys are
+// hashed
+func (s *StorageReorganizer) EncodeVyperHashMapKey(keyTypeName string, key interface{}) ([]byte, error) {
+
+	dataType, found := s.dataTypes[keyTypeName]
+
+	if !found {
+
+		return nil, errors.New("Type not found " + keyTypeName)
+	}
+
+	if dataType.Encoding == EncodingVyperBytes {
+
+		data, ok := key.([]byte)
+
+		if !ok {
+
+			return nil, errors.New("Expected Bytes For Key Of Type " + dataType.Label)
+		}
+
+		return crypto.Keccak256(data), nil
+	}
+
+	integer, err := ParseInteger(key)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	// flags are stored as uint256
+	keyType, ok := ParseTypeName(GetEncodingLabel(dataType))
+
+	if !ok {
+
+		keyType = ExpressionType{Kind: ExpressionInt, Bits: 256}
+	}
+
+	if !fitsExpressionType(integer, keyType) {
+
+		return nil, errors.New("Key " + integer.String() + " Does Not Fit In " + dataType.Label)
+	}
+
+	// negative keys of signed integers are sign extended to 32 bytes
+	if integer.Sign() < 0 {
+
+		integer = new(big.Int).Add(integer, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+
+	// fixed size bytes are aligned to the left
+	if keyType.Kind == ExpressionFixedBytes {
+
+		integer = new(big.Int).Lsh(integer, 256-keyType.Bits)
+	}
+
+	return common.BigToHash(integer).Bytes(), nil
+}
+
+// function to get the slot of the value of a Vyper HashMap key, which is keccak256(slot . key)
+func GetVyperHashMapValueSlot(encodedKey []byte, slot common.Hash) common.Hash {
+
+	return common.BytesToHash(crypto.Keccak256(slot[:], encodedKey))
+}
+
+// function to add a number of slots to a slot
+func addSlots(slot common.Hash, numberOfSlots uint64) common.Hash {
+
+	return common.BigToHash(new(big.Int).Add(slot.Big(), new(big.Int).SetUint64(numberOfSlots)))
+}
+
+// function to copy whole slots from the old storage to the reorganized storage
+func (s *StorageReorganizer) copySlots(prevSlot, newSlot common.Hash, numberOfSlots uint64) {
+
+	for i := uint64(0); i < numberOfSlots; i++ {
+
+		key := addSlots(newSlot, i)
+
+		s.SetModifiedState(key, s.GetCommitedState(addSlots(prevSlot, i)))
+		s.MarkWritten(key, 0, 32)
+	}
+}
+
+// Reorganizes a Vyper DynArray. The length is stored at the slot of the array and the elements follow it, so only the
+// slots of the elements that are in use are reorganized
+func (s *StorageReorganizer) ReorganizeVyperDynArray(reorgMessage ReorgInfo) error {
+
+	dataType, found := s.dataTypes[reorgMessage.Type]
+
+	if !found {
+
+		return errors.New("Type not found " + reorgMessage.Type)
+	}
+
+	prevElementSize, newElementSize, err := s.GetNumberOfBytes(dataType.Base)
+
+	if err != nil {
+
+		return err
+	}
+
+	length := s.GetCommitedState(reorgMessage.PrevSlot).Big()
+	capacity := (dataType.PrevNumberOfBytes/32 - 1) / (prevElementSize / 32)
+
+	if length.Cmp(new(big.Int).SetUint64(capacity)) > 0 {
+
+		return errors.New("Length " + length.String() + " Of " + reorgMessage.Label + " Exceeds The Bound Of " + dataType.Label)
+	}
+
+	s.copySlots(reorgMessage.PrevSlot, reorgMessage.NewSlot, 1)
+
+	for i := uint64(0); i < length.Uint64(); i++ {
+
+		err := s.ReorganizeElement(ReorgInfo{
+			Label:    fmt.Sprintf("%s[%d]", reorgMessage.Label, i),
+			Type:     dataType.Base,
+			PrevSlot: addSlots(reorgMessage.PrevSlot, 1+i*(prevElementSize/32)),
+			NewSlot:  addSlots(reorgMessage.NewSlot, 1+i*(newElementSize/32)),
+		})
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reorganizes a Vyper Bytes or String. The length is stored at the slot and the data in the following slots
+func (s *StorageReorganizer) ReorganizeVyperBytes(reorgMessage ReorgInfo) error {
+
+	dataType, found := s.dataTypes[reorgMessage.Type]
+
+	if !found {
+
+		return errors.New("Type not found " + reorgMessage.Type)
+	}
+
+	length := s.GetCommitedState(reorgMessage.PrevSlot).Big()
+	capacity := (dataType.PrevNumberOfBytes/32 - 1) * 32
+
+	if length.Cmp(new(big.Int).SetUint64(capacity)) > 0 {
+
+		return errors.New("Length " + length.String() + " Of " + reorgMessage.Label + " Exceeds The Bound Of " + dataType.Label)
+	}
+
+	s.copySlots(reorgMessage.PrevSlot, reorgMessage.NewSlot, 1+(length.Uint64()+31)/32)
+
+	return nil
+}
+
+// Reorganizes the values of the keys of a Vyper HashMap that are listed in the reorganization message. Like Solidity,
+// Vyper does not store the keys, so the values of keys that are not listed are not moved, see IsMappingKept
+func (s *StorageReorganizer) ReorganizeVyperHashMap(reorgMessage ReorgInfo) error {
+
+	dataType, found := s.dataTypes[reorgMessage.Type]
+
+	if !found {
+
+		return errors.New("Type not found " + reorgMessage.Type)
+	}
+
+	if kept, err := s.IsMappingKept(reorgMessage); err != nil {
+
+		return err
+
+	} else if kept {
+
+		s.keepsMappings = true
+		return nil
+	}
+
+	valueDataType, found := s.dataTypes[dataType.Value]
+
+	if !found {
+
+		return errors.New("Type not found " + dataType.Value)
+	}
+
+	if valueDataType.Encoding == EncodingVyperHashMap {
+
+		return errors.New("Nested Mappings Are Not Supported")
+	}
+
+	for _, rawKey := range reorgMessage.Keys {
+
+		key, err := s.ParseValue(dataType.Key, rawKey)
+
+		if err != nil {
+
+			return errors.New("Invalid Key Of " + reorgMessage.Label + ": " + err.Error())
+		}
+
+		encodedKey, err := s.EncodeVyperHashMapKey(dataType.Key, key)
+
+		if err != nil {
+
+			return errors.New("Invalid Key Of " + reorgMessage.Label + ": " + err.Error())
+		}
+
+		err = s.ReorganizeElement(ReorgInfo{
+			Label:    reorgMessage.Label + "[" + string(rawKey) + "]",
+			Type:     dataType.Value,
+			PrevSlot: GetVyperHashMapValueSlot(encodedKey, reorgMessage.PrevSlot),
+			NewSlot:  GetVyperHashMapValueSlot(encodedKey, reorgMessage.NewSlot),
+		})
+
+		if err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// converts the output of vyper -f layout into a storage layout and prints it or writes it to the output file
+func runVyperLayout(layoutPath, sourcePath, outputPath string) error {
+
+	layout, err := ReadVyperLayoutFromFile(layoutPath, sourcePath)
+
+	if err != nil {
+
+		return err
+	}
+
+	data, err := json.MarshalIndent(layout, "", "  ")
+
+	if err != nil {
+
+		return err
+	}
+
+	if outputPath == "" {
+
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if err := ioutil.WriteFile(outputPath, data, 0644); err != nil {
+
+		return err
+	}
+
+	fmt.Println(green + fmt.Sprintf("Layout with %d variables written to %s", len(layout.Storage), outputPath) + reset)
+	return nil
+}